@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/idlab-discover/concap/internal/controller"
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	"github.com/idlab-discover/concap/internal/scenarios"
+)
+
+// cleanSelectors returns the label selectors of the pods selected by the clean command
+func cleanSelectors(command CleanCommand) ([]string, error) {
+	if command.All {
+		if command.Scenario != "" || command.Processing {
+			return nil, errors.New("--all cannot be combined with --scenario or --processing")
+		}
+		return []string{scenarios.AllPodsSelector}, nil
+	}
+	var selectors []string
+	if command.Scenario != "" {
+		selectors = append(selectors, scenarios.ScenarioPodsSelector(command.Scenario))
+	}
+	if command.Processing {
+		selectors = append(selectors, scenarios.ProcessingPodsSelector)
+	}
+	if len(selectors) == 0 {
+		return nil, errors.New("select the pods to delete with --all, --scenario or --processing")
+	}
+	return selectors, nil
+}
+
+// runClean deletes the concap pods selected by the clean command
+func runClean(ctx context.Context) error {
+	selectors, err := cleanSelectors(cleanCommand)
+	if err != nil {
+		return err
+	}
+	if err := kubeapi.Init(ctx); err != nil {
+		return fmt.Errorf("initialize Kubernetes client: %w", err)
+	}
+
+	deleted := 0
+	var errs []error
+	for _, selector := range selectors {
+		podNames, err := scenarios.DeletePodsBySelector(ctx, selector)
+		if len(podNames) > 0 {
+			log.Printf("Pods matching %q: %v", selector, podNames)
+		}
+		deleted += len(podNames)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("delete pods: %w", err)
+	}
+	log.Printf("Deleted %d pods", deleted)
+	return nil
+}
+
+// removeStalePods deletes the attacker and target pods that controllers which were killed before they could
+// clean up left behind, so that they do not collide with the pods of this run. Only pods of sessions in the
+// journal that are gone are deleted, pods of other running controllers are kept. Processing pods are reused.
+func removeStalePods(ctx context.Context) error {
+	sessions := controller.StaleSessions()
+	if len(sessions) == 0 {
+		return nil
+	}
+	podNames, err := scenarios.DeletePodsBySelector(ctx, scenarios.SessionPodsSelector(sessions))
+	if len(podNames) > 0 {
+		log.Printf("Removing %d stale scenario pods: %v", len(podNames), podNames)
+	}
+	if err != nil {
+		return fmt.Errorf("remove stale scenario pods: %w", err)
+	}
+	return nil
+}
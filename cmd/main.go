@@ -10,36 +10,138 @@ import (
 	"path/filepath"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/idlab-discover/concap/internal/config"
 	"github.com/idlab-discover/concap/internal/controller"
 	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	"github.com/idlab-discover/concap/internal/metrics"
+	"github.com/idlab-discover/concap/internal/scenarios"
 	"github.com/jessevdk/go-flags"
 )
 
 type FlagStore struct {
-	Directory       string `short:"d" long:"dir" description:"The mount path on the host" required:"true"`
-	Scenario        string `short:"s" long:"scenario" description:"The scenario's to run, default=all" default:"all"`
-	NumberOfWorkers int    `short:"w" long:"workers" description:"The number of concurrent workers that will execute scenarios. If NumberOfWorkers is greater than the number of scenarios, a maximum of 1 worker per scenario will be spawned." default:"1"`
+	Directory       string        `short:"d" long:"dir" description:"The mount path on the host" required:"true"`
+	Scenario        string        `short:"s" long:"scenario" description:"The scenario's to run, default=all" default:"all"`
+	NumberOfWorkers int           `short:"w" long:"workers" description:"The number of concurrent workers that will execute scenarios. If NumberOfWorkers is greater than the number of scenarios, a maximum of 1 worker per scenario will be spawned." default:"1"`
+	Repeat          int           `short:"r" long:"repeat" description:"The number of times every scenario is captured, overrides the repeat field of the scenario files. 0 uses the scenario files" default:"0"`
+	Resume          bool          `long:"resume" description:"Skip scenarios whose output in the completed directory is complete and re-run the ones that are partial or failed"`
+	Retries         int           `long:"retries" description:"The number of times a scenario is retried after a transient failure such as a pod scheduling timeout, a broken exec stream or a failed file copy" default:"0"`
+	RetryBackoff    time.Duration `long:"retry-backoff" description:"The wait before the first retry of a scenario, doubled for every following retry" default:"30s"`
+	PodReadyTimeout time.Duration `long:"pod-ready-timeout" description:"How long every pod may take to be scheduled, pull its images and become ready. Pods that fail to pull an image, crash or cannot be scheduled fail immediately" default:"10m"`
+	MetricsAddr     string        `long:"metrics-addr" description:"The address, e.g. :9090, to expose Prometheus metrics on at /metrics while scenarios run. Disabled when empty"`
+	Config          string        `long:"config" description:"A YAML file with the cluster settings: namespace, pull secret, registry, kubeconfig, context, in-cluster and node selector. The flags below override it"`
+	Namespace       string        `long:"namespace" description:"The namespace of all concap pods (default: concap)"`
+	Kubeconfig      string        `long:"kubeconfig" description:"The kubeconfig file to connect with (default: KUBECONFIG or ~/.kube/config)"`
+	Context         string        `long:"context" description:"The kubeconfig context to connect with (default: the current context)"`
+	InCluster       bool          `long:"in-cluster" description:"Connect with the service account of the pod concap runs in"`
+	PullSecret      string        `long:"pull-secret" description:"The image pull secret of all concap pods (default: ghcr-creds)"`
+	Registry        string        `long:"registry" description:"The registry host the pull secret must hold credentials for (default: ghcr.io)"`
+	NodeRoleLabel   string        `long:"node-role-label" description:"The node label that selects the nodes of attackers and targets (default: concap-role)"`
+	AttackerRole    string        `long:"attacker-node-role" description:"The value of the node role label on attacker nodes (default: attacker)"`
+	TargetRole      string        `long:"target-node-role" description:"The value of the node role label on target nodes (default: target)"`
 }
 
 var flagstore FlagStore
 
-func parseFlags() error {
-	_, err := flags.Parse(&flagstore)
-	if err != nil {
-		return fmt.Errorf("parse flags: %w", err)
+// ValidateCommand checks the scenarios and processing pods without connecting to the cluster
+type ValidateCommand struct{}
+
+// RenderCommand prints the pod manifests of the scenarios and processing pods without connecting to the cluster
+type RenderCommand struct{}
+
+// ServeCommand keeps the processing pods deployed and accepts scenarios over a REST API
+type ServeCommand struct {
+	Listen string `long:"listen" description:"The address to serve the scenario API on. Use e.g. :8080 to accept connections from other hosts" default:"127.0.0.1:8080"`
+	Token  string `long:"token" env:"CONCAP_API_TOKEN" description:"The bearer token that every API request except the health check requires"`
+}
+
+// CleanCommand deletes the pods concap left in the cluster
+type CleanCommand struct {
+	All        bool   `long:"all" description:"Delete every concap pod, including the processing pods"`
+	Scenario   string `long:"scenario" description:"Delete the attacker and target pods of the scenario with this name"`
+	Processing bool   `long:"processing" description:"Delete the processing pods"`
+}
+
+var (
+	validateCommand ValidateCommand
+	renderCommand   RenderCommand
+	serveCommand    ServeCommand
+	cleanCommand    CleanCommand
+)
+
+func parseFlags() (*flags.Parser, error) {
+	parser := flags.NewParser(&flagstore, flags.Default)
+	parser.SubcommandsOptional = true
+	if _, err := parser.AddCommand("validate", "Validate scenarios and processing pods",
+		"Loads every scenario and processing pod in the directory and reports all problems found, without deploying anything.",
+		&validateCommand); err != nil {
+		return nil, fmt.Errorf("add validate command: %w", err)
 	}
-	return nil
+	if _, err := parser.AddCommand("render", "Render the Kubernetes manifests of scenarios and processing pods",
+		"Prints the pod manifests generated for every scenario and processing pod in the directory as YAML, without deploying anything.",
+		&renderCommand); err != nil {
+		return nil, fmt.Errorf("add render command: %w", err)
+	}
+	if _, err := parser.AddCommand("serve", "Serve a REST API to submit and track scenarios",
+		"Deploys the processing pods once and executes the scenarios submitted over HTTP on the scenario workers until interrupted. "+
+			"The API listens on 127.0.0.1:8080 by default, and every request except GET /healthz requires the bearer token set with --token or CONCAP_API_TOKEN.",
+		&serveCommand); err != nil {
+		return nil, fmt.Errorf("add serve command: %w", err)
+	}
+	if _, err := parser.AddCommand("clean", "Delete concap pods from the cluster",
+		"Deletes the attacker and target pods of a scenario, the processing pods or every concap pod, selected by the labels concap sets on them.",
+		&cleanCommand); err != nil {
+		return nil, fmt.Errorf("add clean command: %w", err)
+	}
+	if _, err := parser.Parse(); err != nil {
+		return nil, fmt.Errorf("parse flags: %w", err)
+	}
+	return parser, nil
 }
 
 func main() {
-	if err := parseFlags(); err != nil {
+	parser, err := parseFlags()
+	if err != nil {
+		if flags.WroteHelp(err) {
+			os.Exit(0)
+		}
 		log.Fatal(err)
 	}
+	if err := applyConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if flagstore.PodReadyTimeout <= 0 {
+		log.Fatal("--pod-ready-timeout must be positive")
+	}
+	kubeapi.PodReadyTimeout = flagstore.PodReadyTimeout
+	if parser.Active != nil && (parser.Active.Name == "validate" || parser.Active.Name == "render") {
+		var err error
+		switch parser.Active.Name {
+		case "validate":
+			err = runValidate(os.Stdout)
+		case "render":
+			err = runRender(os.Stdout)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	if err := run(ctx); err != nil {
+	runner := run
+	if parser.Active != nil {
+		switch parser.Active.Name {
+		case "serve":
+			runner = runServe
+		case "clean":
+			runner = runClean
+		}
+	}
+	if err := runner(ctx); err != nil {
 		if errors.Is(err, context.Canceled) {
 			log.Printf("Shutdown complete: %v", err)
 			os.Exit(1)
@@ -49,6 +151,7 @@ func main() {
 }
 
 func run(ctx context.Context) error {
+	startTime := time.Now()
 	if err := kubeapi.Init(ctx); err != nil {
 		return fmt.Errorf("initialize Kubernetes client: %w", err)
 	}
@@ -56,6 +159,12 @@ func run(ctx context.Context) error {
 	runCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	if flagstore.MetricsAddr != "" {
+		if err := metrics.Serve(runCtx, flagstore.MetricsAddr); err != nil {
+			return fmt.Errorf("serve metrics: %w", err)
+		}
+	}
+
 	watcherErrCh := make(chan error, 1)
 	go func() {
 		for err := range kubeapi.WatchErrors() {
@@ -83,48 +192,63 @@ func run(ctx context.Context) error {
 		return fmt.Errorf("scenario directory does not exist: %s", scenarioDir)
 	}
 
-	processingPodPaths, err := readDir(processingDir)
+	processingPodPaths, err := readProcessingPodPaths(processingDir)
 	if err != nil {
-		return fmt.Errorf("read processing pod directory %s: %w", processingDir, err)
-	}
-	if len(processingPodPaths) == 0 {
-		return fmt.Errorf("no processing pods found in %s", processingDir)
+		return err
 	}
 
-	scenarioPaths, err := readDir(scenarioDir)
+	scenarioPaths, err := selectScenarioPaths(scenarioDir)
 	if err != nil {
-		return fmt.Errorf("read scenario directory %s: %w", scenarioDir, err)
+		return err
 	}
 	if len(scenarioPaths) == 0 {
 		return fmt.Errorf("no scenarios found")
 	}
-
 	if flagstore.Scenario != "all" {
-		scenarioPath := filepath.Join(scenarioDir, flagstore.Scenario)
 		log.Printf("Scenario %s selected to be run", flagstore.Scenario)
-		if _, err := os.Stat(scenarioPath); err != nil {
-			return fmt.Errorf("open specified scenario %s: %w", scenarioPath, err)
+	}
+
+	// Expand scenario matrices into concrete scenarios
+	var scenarioSources []scenarios.ScenarioSource
+	for _, scenarioPath := range scenarioPaths {
+		sources, err := scenarios.LoadScenarioSources(scenarioPath)
+		if err != nil {
+			return fmt.Errorf("load scenario %s: %w", scenarioPath, err)
 		}
-		scenarioPaths = []string{scenarioPath}
+		scenarioSources = append(scenarioSources, sources...)
+	}
+	scenarioSources, err = scenarios.RepeatScenarioSources(scenarioSources, flagstore.Repeat)
+	if err != nil {
+		return fmt.Errorf("repeat scenarios: %w", err)
 	}
 
-	log.Printf("Number of scenarios found: %d", len(scenarioPaths))
+	closeJournal, err := openJournal(runCtx, completedDir)
+	if err != nil {
+		return err
+	}
+	defer closeJournal()
+	if err := removeStalePods(runCtx); err != nil {
+		return err
+	}
+
+	log.Printf("Number of scenarios found: %d", len(scenarioSources))
 	if err := controller.DeployFlowExtractionPods(runCtx, processingPodPaths); err != nil {
 		return fmt.Errorf("deploy flow extraction pods: %w", err)
 	}
 
 	scenarioChannel := make(chan controller.ScenarioScheduleRequest)
-	scenarioResults := make(chan error, len(scenarioPaths))
+	scenarioResults := make(chan controller.ScenarioResult, len(scenarioSources))
 
 	var wg sync.WaitGroup
-	numWorkers := min(flagstore.NumberOfWorkers, len(scenarioPaths))
+	numWorkers := min(flagstore.NumberOfWorkers, len(scenarioSources))
 	log.Printf("Starting %d scenario workers", numWorkers)
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go controller.ScheduleScenarioWorker(runCtx, scenarioChannel, scenarioResults, &wg)
 	}
 
-	sendErr := enqueueScenarios(runCtx, scenarioChannel, scenarioPaths, completedDir)
+	metrics.ScenariosQueued.Set(float64(len(scenarioSources)))
+	sendErr := enqueueScenarios(runCtx, scenarioChannel, scenarioSources, completedDir)
 	wg.Wait()
 	close(scenarioResults)
 
@@ -132,8 +256,17 @@ func run(ctx context.Context) error {
 	if sendErr != nil {
 		errs = append(errs, sendErr)
 	}
-	for err := range scenarioResults {
-		errs = append(errs, err)
+	var results []controller.ScenarioResult
+	for result := range scenarioResults {
+		results = append(results, result)
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	if err := controller.WriteRunReport(completedDir, controller.NewRunReport(startTime, results)); err != nil {
+		errs = append(errs, fmt.Errorf("write run report: %w", err))
+	} else {
+		log.Printf("Run report written to %s", filepath.Join(completedDir, controller.RunReportHTMLFileName))
 	}
 	select {
 	case err := <-watcherErrCh:
@@ -148,16 +281,21 @@ func run(ctx context.Context) error {
 	return nil
 }
 
-func enqueueScenarios(ctx context.Context, scenarioChannel chan<- controller.ScenarioScheduleRequest, scenarioPaths []string, outputDir string) error {
+func enqueueScenarios(ctx context.Context, scenarioChannel chan<- controller.ScenarioScheduleRequest, scenarioSources []scenarios.ScenarioSource, outputDir string) error {
 	defer close(scenarioChannel)
 
-	for _, scenarioPath := range scenarioPaths {
+	for _, scenarioSource := range scenarioSources {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case scenarioChannel <- controller.ScenarioScheduleRequest{
-			ScenarioPath: scenarioPath,
-			OutputDir:    outputDir,
+			Source:    scenarioSource,
+			OutputDir: outputDir,
+			Resume:    flagstore.Resume,
+			Retry: controller.RetryPolicy{
+				Retries: flagstore.Retries,
+				Backoff: flagstore.RetryBackoff,
+			},
 		}:
 		}
 	}
@@ -165,6 +303,86 @@ func enqueueScenarios(ctx context.Context, scenarioChannel chan<- controller.Sce
 	return nil
 }
 
+// applyConfig loads the config file, overrides it with the cluster flags that are set and applies the result
+func applyConfig() error {
+	cfg := config.Default()
+	if flagstore.Config != "" {
+		var err error
+		if cfg, err = config.Load(flagstore.Config); err != nil {
+			return err
+		}
+	}
+	override := func(value *string, flag string) {
+		if flag != "" {
+			*value = flag
+		}
+	}
+	override(&cfg.Namespace, flagstore.Namespace)
+	override(&cfg.Kubeconfig, flagstore.Kubeconfig)
+	override(&cfg.Context, flagstore.Context)
+	override(&cfg.PullSecret, flagstore.PullSecret)
+	override(&cfg.Registry, flagstore.Registry)
+	override(&cfg.NodeSelector.Key, flagstore.NodeRoleLabel)
+	override(&cfg.NodeSelector.Attacker, flagstore.AttackerRole)
+	override(&cfg.NodeSelector.Target, flagstore.TargetRole)
+	if flagstore.InCluster {
+		cfg.InCluster = true
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	cfg.Apply()
+	return nil
+}
+
+// openJournal opens the run-state journal in the completed directory and deletes the pods that earlier runs
+// left behind. The returned function closes the journal.
+func openJournal(ctx context.Context, completedDir string) (func(), error) {
+	states, err := controller.OpenJournal(completedDir)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	closeJournal := func() {
+		if err := controller.CloseJournal(); err != nil {
+			log.Printf("Error: failed to close journal: %v", err)
+		}
+	}
+	controller.SummarizeStates(states)
+	if err := controller.RecoverInterrupted(ctx, states); err != nil {
+		closeJournal()
+		return nil, fmt.Errorf("clean up interrupted scenarios: %w", err)
+	}
+	return closeJournal, nil
+}
+
+// selectScenarioPaths returns the scenario files in the directory, or only the one selected with --scenario
+func selectScenarioPaths(scenarioDir string) ([]string, error) {
+	if flagstore.Scenario != "all" {
+		scenarioPath := filepath.Join(scenarioDir, flagstore.Scenario)
+		if _, err := os.Stat(scenarioPath); err != nil {
+			return nil, fmt.Errorf("open specified scenario %s: %w", scenarioPath, err)
+		}
+		return []string{scenarioPath}, nil
+	}
+	scenarioPaths, err := readDir(scenarioDir)
+	if err != nil {
+		return nil, fmt.Errorf("read scenario directory %s: %w", scenarioDir, err)
+	}
+	return scenarioPaths, nil
+}
+
+// readProcessingPodPaths returns the processing pod files in the directory, a run needs at least one
+func readProcessingPodPaths(processingDir string) ([]string, error) {
+	processingPodPaths, err := readDir(processingDir)
+	if err != nil {
+		return nil, fmt.Errorf("read processing pod directory %s: %w", processingDir, err)
+	}
+	if len(processingPodPaths) == 0 {
+		return nil, fmt.Errorf("no processing pods found in %s", processingDir)
+	}
+	return processingPodPaths, nil
+}
+
 func readDir(dir string) ([]string, error) {
 	dirEntries, err := os.ReadDir(dir)
 	if err != nil {
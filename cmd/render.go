@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/idlab-discover/concap/internal/scenarios"
+)
+
+// runRender writes the pod manifests of the scenarios and processing pods in the directory.
+// Scenarios with validation errors are not rendered since building their pods could fail.
+func runRender(w io.Writer) error {
+	scenarioDir := filepath.Join(flagstore.Directory, "scenarios")
+	processingDir := filepath.Join(flagstore.Directory, "processingpods")
+
+	scenarioPaths, err := selectScenarioPaths(scenarioDir)
+	if err != nil {
+		return err
+	}
+	processingPodPaths, err := readDir(processingDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read processing pod directory %s: %w", processingDir, err)
+	}
+
+	for _, scenarioPath := range scenarioPaths {
+		if problems := scenarios.ValidateScenarioFile(scenarioPath); scenarios.HasErrors(problems) {
+			return fmt.Errorf("scenario %s is invalid, run the validate command for details", scenarioPath)
+		}
+		sources, err := scenarios.LoadScenarioSources(scenarioPath)
+		if err != nil {
+			return fmt.Errorf("load scenario %s: %w", scenarioPath, err)
+		}
+		sources, err = scenarios.RepeatScenarioSources(sources, flagstore.Repeat)
+		if err != nil {
+			return fmt.Errorf("repeat scenario %s: %w", scenarioPath, err)
+		}
+		for _, source := range sources {
+			scenario, err := scenarios.CreateScenarioFromSource(source)
+			if err != nil {
+				return fmt.Errorf("create scenario %s: %w", source.Name, err)
+			}
+			if err := scenarios.RenderScenario(w, scenario); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, processingPodPath := range processingPodPaths {
+		if problems := scenarios.ValidateProcessingPodFile(processingPodPath); scenarios.HasErrors(problems) {
+			return fmt.Errorf("processing pod %s is invalid, run the validate command for details", processingPodPath)
+		}
+		processingPod, err := scenarios.ReadProcessingPod(processingPodPath)
+		if err != nil {
+			return fmt.Errorf("read processing pod %s: %w", processingPodPath, err)
+		}
+		if err := scenarios.RenderProcessingPod(w, processingPod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
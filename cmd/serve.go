@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/idlab-discover/concap/internal/controller"
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	"github.com/idlab-discover/concap/internal/metrics"
+	"github.com/idlab-discover/concap/internal/server"
+)
+
+// runServe deploys the processing pods and serves the scenario API until the context is done.
+// Submitted scenarios are executed on the same worker pool as a regular run.
+func runServe(ctx context.Context) error {
+	// Submitted scenarios can run privileged pods with any image and command
+	if serveCommand.Token == "" {
+		return errors.New("serve requires a bearer token, set --token or CONCAP_API_TOKEN")
+	}
+	if err := kubeapi.Init(ctx); err != nil {
+		return fmt.Errorf("initialize Kubernetes client: %w", err)
+	}
+
+	serveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		for err := range kubeapi.WatchErrors() {
+			if err == nil {
+				continue
+			}
+			log.Printf("Error: pod watcher failed: %v", err)
+			cancel()
+			return
+		}
+	}()
+
+	dataDir, err := filepath.Abs(flagstore.Directory)
+	if err != nil {
+		return fmt.Errorf("resolve output directory %s: %w", flagstore.Directory, err)
+	}
+	processingPodPaths, err := readProcessingPodPaths(filepath.Join(dataDir, "processingpods"))
+	if err != nil {
+		return err
+	}
+	closeJournal, err := openJournal(serveCtx, filepath.Join(dataDir, "completed"))
+	if err != nil {
+		return err
+	}
+	defer closeJournal()
+	if err := removeStalePods(serveCtx); err != nil {
+		return err
+	}
+	if err := controller.DeployFlowExtractionPods(serveCtx, processingPodPaths); err != nil {
+		return fmt.Errorf("deploy flow extraction pods: %w", err)
+	}
+	if flagstore.MetricsAddr != "" {
+		if err := metrics.Serve(serveCtx, flagstore.MetricsAddr); err != nil {
+			return fmt.Errorf("serve metrics: %w", err)
+		}
+	}
+
+	requests := make(chan controller.ScenarioScheduleRequest)
+	// Every worker can hand in the result of its last scenario after the server stopped reading
+	results := make(chan controller.ScenarioResult, flagstore.NumberOfWorkers)
+	var wg sync.WaitGroup
+	log.Printf("Starting %d scenario workers", flagstore.NumberOfWorkers)
+	for i := 0; i < flagstore.NumberOfWorkers; i++ {
+		wg.Add(1)
+		go controller.ScheduleScenarioWorker(serveCtx, requests, results, &wg)
+	}
+
+	srv := server.New(server.Options{
+		DataDir: dataDir,
+		Repeat:  flagstore.Repeat,
+		Retry: controller.RetryPolicy{
+			Retries: flagstore.Retries,
+			Backoff: flagstore.RetryBackoff,
+		},
+		Token: serveCommand.Token,
+	}, requests)
+	go srv.Run(serveCtx, results)
+
+	serveErr := srv.ListenAndServe(serveCtx, serveCommand.Listen)
+	cancel()
+	wg.Wait()
+	if serveErr != nil {
+		return fmt.Errorf("serve scenario API: %w", serveErr)
+	}
+	log.Println("Scenario API stopped")
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/idlab-discover/concap/internal/scenarios"
+)
+
+// runValidate validates the scenarios and processing pods in the directory and writes every
+// problem found. It returns an error if any of the problems is an error.
+func runValidate(w io.Writer) error {
+	scenarioDir := filepath.Join(flagstore.Directory, "scenarios")
+	processingDir := filepath.Join(flagstore.Directory, "processingpods")
+
+	scenarioPaths, err := selectScenarioPaths(scenarioDir)
+	if err != nil {
+		return err
+	}
+
+	processingPodPaths, err := readDir(processingDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read processing pod directory %s: %w", processingDir, err)
+	}
+
+	var problems []scenarios.Problem
+	for _, scenarioPath := range scenarioPaths {
+		problems = append(problems, scenarios.ValidateScenarioFile(scenarioPath)...)
+	}
+	for _, processingPodPath := range processingPodPaths {
+		problems = append(problems, scenarios.ValidateProcessingPodFile(processingPodPath)...)
+	}
+
+	errorCount := 0
+	for _, problem := range problems {
+		if problem.Severity == scenarios.SeverityError {
+			errorCount++
+		}
+		fmt.Fprintln(w, problem)
+	}
+	fmt.Fprintf(w, "Validated %d scenario files and %d processing pods: %d errors, %d warnings\n",
+		len(scenarioPaths), len(processingPodPaths), errorCount, len(problems)-errorCount)
+
+	if errorCount > 0 {
+		return fmt.Errorf("validation failed with %d errors", errorCount)
+	}
+	return nil
+}
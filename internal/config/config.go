@@ -0,0 +1,101 @@
+// Package config holds the cluster settings of concap: which cluster and namespace it runs in, the image pull
+// secret of its pods and the node roles they are scheduled on. The settings are read from a YAML file and can be
+// overridden with flags.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	"github.com/idlab-discover/concap/internal/scenarios"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Config is the cluster configuration of concap
+type Config struct {
+	// Namespace contains every pod concap creates
+	Namespace string `yaml:"namespace"`
+	// PullSecret is the image pull secret of every pod
+	PullSecret string `yaml:"pullSecret"`
+	// Registry is the registry host the pull secret must hold credentials for, e.g. ghcr.io
+	Registry string `yaml:"registry"`
+	// Kubeconfig and Context select the cluster, defaulting to KUBECONFIG or ~/.kube/config and its current context
+	Kubeconfig string `yaml:"kubeconfig"`
+	Context    string `yaml:"context"`
+	// InCluster connects with the service account of the pod concap runs in
+	InCluster    bool         `yaml:"inCluster"`
+	NodeSelector NodeSelector `yaml:"nodeSelector"`
+}
+
+// NodeSelector places attackers and targets on nodes labeled with a role
+type NodeSelector struct {
+	// Key is the node label holding the role
+	Key      string `yaml:"key"`
+	Attacker string `yaml:"attacker"`
+	Target   string `yaml:"target"`
+}
+
+// Default returns the configuration concap uses without a config file or flags
+func Default() Config {
+	return Config{
+		Namespace:  kubeapi.WorkloadNamespace,
+		PullSecret: kubeapi.ImagePullSecretName,
+		Registry:   kubeapi.RegistryHost,
+		NodeSelector: NodeSelector{
+			Key:      scenarios.NodeRoleLabel,
+			Attacker: scenarios.NodeRoleAttacker,
+			Target:   scenarios.NodeRoleTarget,
+		},
+	}
+}
+
+// Load reads a config file. Settings the file leaves out keep their default.
+func Load(path string) (Config, error) {
+	config := Default()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("read config file %s: %w", path, err)
+	}
+	if err := yaml.UnmarshalStrict(b, &config); err != nil {
+		return config, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks that the names in the configuration are valid Kubernetes names
+func (c Config) Validate() error {
+	var problems []string
+	check := func(field string, errs []string) {
+		for _, err := range errs {
+			problems = append(problems, fmt.Sprintf("%s: %s", field, err))
+		}
+	}
+	check("namespace", validation.IsDNS1123Label(c.Namespace))
+	check("pullSecret", validation.IsDNS1123Subdomain(c.PullSecret))
+	check("nodeSelector.key", validation.IsQualifiedName(c.NodeSelector.Key))
+	check("nodeSelector.attacker", validation.IsValidLabelValue(c.NodeSelector.Attacker))
+	check("nodeSelector.target", validation.IsValidLabelValue(c.NodeSelector.Target))
+	if c.InCluster && (c.Kubeconfig != "" || c.Context != "") {
+		problems = append(problems, "inCluster cannot be combined with kubeconfig or context")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Apply makes the configuration the one used to connect to the cluster and to build pods
+func (c Config) Apply() {
+	kubeapi.WorkloadNamespace = c.Namespace
+	kubeapi.ImagePullSecretName = c.PullSecret
+	kubeapi.RegistryHost = c.Registry
+	kubeapi.Kubeconfig = c.Kubeconfig
+	kubeapi.KubeContext = c.Context
+	kubeapi.InCluster = c.InCluster
+	scenarios.NodeRoleLabel = c.NodeSelector.Key
+	scenarios.NodeRoleAttacker = c.NodeSelector.Attacker
+	scenarios.NodeRoleTarget = c.NodeSelector.Target
+}
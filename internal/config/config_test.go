@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	"github.com/idlab-discover/concap/internal/scenarios"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "concap.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadKeepsDefaultsForMissingSettings(t *testing.T) {
+	config, err := Load(writeConfig(t, `
+namespace: team-a
+registry: ""
+nodeSelector:
+  key: lab.example.com/role
+`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := Default()
+	want.Namespace = "team-a"
+	want.Registry = ""
+	want.NodeSelector.Key = "lab.example.com/role"
+	if config != want {
+		t.Fatalf("Load() = %+v, want %+v", config, want)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+}
+
+func TestLoadRejectsUnknownSettings(t *testing.T) {
+	if _, err := Load(writeConfig(t, "namespaces: team-a\n")); err == nil {
+		t.Fatal("Load() error = nil, want an error for the unknown field")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"invalid namespace", func(c *Config) { c.Namespace = "Team_A" }, "namespace:"},
+		{"empty pull secret", func(c *Config) { c.PullSecret = "" }, "pullSecret:"},
+		{"invalid node label", func(c *Config) { c.NodeSelector.Key = "role with spaces" }, "nodeSelector.key:"},
+		{"invalid node role", func(c *Config) { c.NodeSelector.Target = "-target" }, "nodeSelector.target:"},
+		{"in-cluster with context", func(c *Config) { c.InCluster = true; c.Context = "lab" }, "inCluster cannot be combined"},
+	}
+	for _, tt := range tests {
+		config := Default()
+		tt.modify(&config)
+		err := config.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Validate() error = %v, want substring %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	original := Default()
+	defer original.Apply()
+
+	config := Default()
+	config.Namespace = "team-a"
+	config.NodeSelector = NodeSelector{Key: "role", Attacker: "generator", Target: "victim"}
+	config.Apply()
+
+	pod := scenarios.BuildTargetPod(scenarios.TargetConfig{
+		Name:       "target",
+		Image:      "example/target:latest",
+		CPURequest: "100m",
+		MemRequest: "128Mi",
+	}, "scenario-a", 0)
+	if pod.Namespace != "team-a" || kubeapi.WorkloadNamespace != "team-a" {
+		t.Fatalf("pod namespace = %q, want team-a", pod.Namespace)
+	}
+	if got := pod.Spec.NodeSelector["role"]; got != "victim" {
+		t.Fatalf("node selector = %v, want role=victim", pod.Spec.NodeSelector)
+	}
+}
@@ -4,17 +4,30 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	"github.com/idlab-discover/concap/internal/metrics"
 	"github.com/idlab-discover/concap/internal/scenarios"
+	"github.com/idlab-discover/concap/internal/state"
 )
 
 type ScenarioScheduleRequest struct {
-	ScenarioPath string
-	OutputDir    string
+	// ID identifies the request in its ScenarioResult
+	ID        string
+	Source    scenarios.ScenarioSource
+	OutputDir string
+	// Resume skips the scenario if its output directory holds the complete output of a previous run
+	Resume bool
+	// Retry runs the scenario again when it fails with a transient error
+	Retry RetryPolicy
+	// Context cancels this scenario alone when it is done, the worker context cancels all scenarios
+	Context context.Context
 }
 
 var (
@@ -62,8 +75,8 @@ func DeployFlowExtractionPods(ctx context.Context, processingPodPaths []string)
 	return nil
 }
 
-// Goroutine receiving scenario requests and scheduling them for execution.
-func ScheduleScenarioWorker(ctx context.Context, ch <-chan ScenarioScheduleRequest, results chan<- error, wg *sync.WaitGroup) {
+// Goroutine receiving scenario requests and scheduling them for execution. The result of every request is sent on results.
+func ScheduleScenarioWorker(ctx context.Context, ch <-chan ScenarioScheduleRequest, results chan<- ScenarioResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for {
 		select {
@@ -73,29 +86,200 @@ func ScheduleScenarioWorker(ctx context.Context, ch <-chan ScenarioScheduleReque
 			if !ok {
 				return
 			}
-			if err := processScenarioRequest(ctx, sceneRequest); err != nil {
-				results <- err
+			// The worker owns the queued gauge, every request leaves the queue here even when it is dropped
+			metrics.ScenariosQueued.Dec()
+			if sceneRequest.Context != nil && sceneRequest.Context.Err() != nil {
+				// Cancelled before a worker picked it up
+				continue
 			}
+			metrics.ScenariosRunning.Inc()
+			requestCtx, cancel := context.WithCancel(ctx)
+			stop := func() bool { return false }
+			if sceneRequest.Context != nil {
+				stop = context.AfterFunc(sceneRequest.Context, cancel)
+			}
+			result := processScenarioRequest(requestCtx, sceneRequest)
+			stop()
+			cancel()
+			metrics.ScenariosRunning.Dec()
+			observeResult(result)
+			results <- result
 		}
 	}
 }
 
-// processScenarioRequest processes a scenario request.
-func processScenarioRequest(ctx context.Context, sceneRequest ScenarioScheduleRequest) error {
-	// Read the scenario
-	scenario, err := scenarios.CreateScenario(sceneRequest.ScenarioPath)
-	if err != nil {
-		return fmt.Errorf("read scenario %s: %w", sceneRequest.ScenarioPath, err)
+// observeResult updates the scenario and capture metrics with the outcome of a scenario
+func observeResult(result ScenarioResult) {
+	switch result.Status {
+	case ScenarioCompleted:
+		metrics.ScenariosSucceeded.Inc()
+	case ScenarioFailed:
+		metrics.ScenariosFailed.Inc()
+	case ScenarioSkipped:
+		metrics.ScenariosSkipped.Inc()
+		return
+	}
+	for _, target := range result.Targets {
+		metrics.CapturedPackets.Add(float64(target.Packets))
+		metrics.CapturedBytes.Add(float64(target.Bytes))
 	}
+}
 
-	scenarioName := scenario.GetName()
-	log.Printf("Scenario loaded: %s\n", scenarioName)
+// processScenarioRequest processes a scenario request and summarizes its outcome for the run report.
+func processScenarioRequest(ctx context.Context, sceneRequest ScenarioScheduleRequest) ScenarioResult {
+	scenarioOutputFolder := filepath.Join(sceneRequest.OutputDir, sceneRequest.Source.OutputDir())
+	result := ScenarioResult{
+		ID:        sceneRequest.ID,
+		Scenario:  sceneRequest.Source.Name,
+		Source:    sceneRequest.Source.Path,
+		OutputDir: scenarioOutputFolder,
+		Status:    ScenarioCompleted,
+		StartTime: time.Now(),
+	}
+	result.Err = executeScenarioRequest(withPodJournal(ctx, scenarioOutputFolder), sceneRequest, scenarioOutputFolder, &result)
+	if result.Err != nil {
+		result.Status = ScenarioFailed
+		result.Error = result.Err.Error()
+	}
+	if result.Status != ScenarioSkipped {
+		result.FinishTime = time.Now()
+		recordEvent(state.Event{
+			Time:      result.FinishTime,
+			Type:      state.EventFinished,
+			OutputDir: scenarioOutputFolder,
+			Status:    string(result.Status),
+			Error:     result.Error,
+			Artifacts: artifactPaths(scenarioOutputFolder),
+		})
+	}
+	result.Targets = collectTargetResults(sceneRequest.Source, scenarioOutputFolder, ProcessingPods)
+	return result
+}
+
+// executeScenarioRequest runs a scenario request and records its outcome in a manifest.
+func executeScenarioRequest(ctx context.Context, sceneRequest ScenarioScheduleRequest, scenarioOutputFolder string, result *ScenarioResult) error {
+	if sceneRequest.Resume {
+		err := VerifyOutput(scenarioOutputFolder, sceneRequest.Source)
+		if err == nil {
+			log.Printf("Skipping scenario %s, output in %s is complete", sceneRequest.Source.Name, scenarioOutputFolder)
+			result.Status = ScenarioSkipped
+			if manifest, err := ReadManifest(scenarioOutputFolder); err == nil {
+				result.StartTime = manifest.StartTime
+				result.FinishTime = manifest.FinishTime
+			}
+			// Report the phases of the run that produced the output
+			if previous, ok := previousStates[scenarioOutputFolder]; ok && previous.Status == state.StatusCompleted {
+				result.Attempts = previous.Attempts
+				result.Phases = phaseResults(previous.Phases)
+			}
+			recordEvent(state.Event{Type: state.EventSkipped, OutputDir: scenarioOutputFolder, Scenario: sceneRequest.Source.Name, ID: sceneRequest.ID})
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Re-running scenario %s: %v", sceneRequest.Source.Name, err)
+		}
+		// Start over from an empty directory so that no partial artifacts end up in the new manifest
+		if err := os.RemoveAll(scenarioOutputFolder); err != nil {
+			return fmt.Errorf("clear output directory for scenario %s: %w", sceneRequest.Source.Name, err)
+		}
+	}
+
+	recordEvent(state.Event{Type: state.EventStarted, OutputDir: scenarioOutputFolder, Scenario: sceneRequest.Source.Name, ID: sceneRequest.ID})
 
 	// Create the output directory
-	scenarioOutputFolder := filepath.Join(sceneRequest.OutputDir, scenarioName)
 	if err := os.MkdirAll(scenarioOutputFolder, 0777); err != nil {
-		return fmt.Errorf("create output directory for scenario %s: %w", scenarioName, err)
+		return fmt.Errorf("create output directory for scenario %s: %w", sceneRequest.Source.Name, err)
+	}
+	if err := removeManifest(scenarioOutputFolder); err != nil {
+		return fmt.Errorf("remove previous manifest for scenario %s: %w", sceneRequest.Source.Name, err)
+	}
+	if err := removeAttempts(scenarioOutputFolder); err != nil {
+		return fmt.Errorf("remove previous attempts for scenario %s: %w", sceneRequest.Source.Name, err)
+	}
+
+	manifest := Manifest{
+		Scenario:     sceneRequest.Source.Name,
+		Source:       sceneRequest.Source.Path,
+		SourceSHA256: sourceChecksum(sceneRequest.Source),
+		Status:       ManifestCompleted,
+		StartTime:    time.Now(),
+	}
+	phases := &phaseRecorder{}
+	runErr := runAttempts(ctx, sceneRequest.Source.Name, scenarioOutputFolder, sceneRequest.Retry, func(ctx context.Context) error {
+		result.Attempts++
+		phases.reset()
+		observer := func(phase string, duration time.Duration) {
+			phases.observe(phase, duration)
+			metrics.PhaseDuration.Observe(duration.Seconds(), phase)
+			recordEvent(state.Event{Type: state.EventPhase, OutputDir: scenarioOutputFolder, Phase: phase, Seconds: duration.Seconds()})
+		}
+		return runScenario(scenarios.WithPhaseObserver(ctx, observer), sceneRequest.Source, scenarioOutputFolder)
+	})
+	result.Phases = phases.results()
+	if runErr != nil {
+		manifest.Status = ManifestFailed
+		manifest.Error = runErr.Error()
 	}
+	manifest.FinishTime = time.Now()
+
+	if err := WriteManifest(scenarioOutputFolder, manifest); err != nil {
+		return errors.Join(runErr, fmt.Errorf("write manifest for scenario %s: %w", sceneRequest.Source.Name, err))
+	}
+	return runErr
+}
+
+// runAttempts runs a scenario until it succeeds, fails with an error that is not transient or runs out of
+// retries. The artifacts of every retried attempt are kept under attempt-<n>/ and all attempts are recorded
+// in the output directory.
+func runAttempts(ctx context.Context, scenarioName, scenarioOutputFolder string, policy RetryPolicy, run func(context.Context) error) error {
+	var attempts []Attempt
+	var runErr error
+	for attempt := 1; ; attempt++ {
+		record := Attempt{Attempt: attempt, StartTime: time.Now()}
+		recordEvent(state.Event{Time: record.StartTime, Type: state.EventAttempt, OutputDir: scenarioOutputFolder, Attempt: attempt})
+		runErr = run(ctx)
+		record.FinishTime = time.Now()
+		if runErr != nil {
+			record.Error = runErr.Error()
+			record.Transient = kubeapi.IsTransient(runErr)
+		}
+
+		retry := runErr != nil && record.Transient && attempt <= policy.Retries && ctx.Err() == nil
+		if retry {
+			archiveDir, err := archiveAttempt(scenarioOutputFolder, attempt)
+			if err != nil {
+				runErr = errors.Join(runErr, fmt.Errorf("archive attempt %d: %w", attempt, err))
+				retry = false
+			}
+			record.ArtifactDir = archiveDir
+		}
+		attempts = append(attempts, record)
+		if !retry {
+			break
+		}
+		log.Printf("Attempt %d of scenario %s failed with a transient error, retrying in %s: %v", attempt, scenarioName, policy.delay(attempt+1), runErr)
+		if err := sleepContext(ctx, policy.delay(attempt+1)); err != nil {
+			runErr = errors.Join(runErr, err)
+			break
+		}
+	}
+
+	if err := writeAttempts(scenarioOutputFolder, attempts); err != nil {
+		return errors.Join(runErr, fmt.Errorf("record attempts for scenario %s: %w", scenarioName, err))
+	}
+	return runErr
+}
+
+// runScenario executes a scenario and processes and labels its results in the output directory.
+func runScenario(ctx context.Context, source scenarios.ScenarioSource, scenarioOutputFolder string) error {
+	// Read the scenario
+	scenario, err := scenarios.CreateScenarioFromSource(source)
+	if err != nil {
+		return fmt.Errorf("read scenario %s from %s: %w", source.Name, source.Path, err)
+	}
+
+	scenarioName := scenario.GetName()
+	log.Printf("Scenario loaded: %s\n", scenarioName)
 
 	// Execute the scenario
 	err = scenario.Execute(ctx, scenarioOutputFolder)
@@ -105,12 +289,20 @@ func processScenarioRequest(ctx context.Context, sceneRequest ScenarioScheduleRe
 
 	// Process the results of the scenario
 	log.Printf("Analyzing traffic for scenario %v...", scenarioName)
+	start := time.Now()
 	err = scenario.ProcessResults(ctx, scenarioOutputFolder, ProcessingPods)
+	scenarios.ObservePhase(ctx, scenarios.PhaseProcessing, start)
 	if err != nil {
 		return fmt.Errorf("process results for scenario %s: %w", scenarioName, err)
 	}
 	log.Println("Traffic analysis completed for all targets in scenario:", scenarioName)
 
+	// Label the processor outputs with the scenario identity and target labels
+	err = scenario.LabelResults(scenarioOutputFolder, ProcessingPods)
+	if err != nil {
+		return fmt.Errorf("label results for scenario %s: %w", scenarioName, err)
+	}
+
 	log.Printf("Scenario finished: %s\n", scenarioName)
 	return nil
 }
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	"github.com/idlab-discover/concap/internal/scenarios"
+	"github.com/idlab-discover/concap/internal/state"
+)
+
+var (
+	// journal records the lifecycle of the scenarios of this run, nothing is recorded when it is nil
+	journal *state.Journal
+	// previousStates are the scenario states of earlier runs by output directory, read when the journal was opened
+	previousStates map[string]state.ScenarioState
+	// sessions are the sessions that recorded events in the journal, read when the journal was opened
+	sessions map[string]state.Session
+	// stopHeartbeat stops recording heartbeats and waits until the last one is written
+	stopHeartbeat func()
+	// deletePod deletes the pods left behind by interrupted scenarios
+	deletePod = kubeapi.DeletePod
+)
+
+// OpenJournal reads the journal in the output directory and opens it to record the scenarios of this run.
+// It returns the scenario states of earlier runs. Call it before starting the scenario workers.
+func OpenJournal(outputDir string) ([]state.ScenarioState, error) {
+	if err := os.MkdirAll(outputDir, 0777); err != nil {
+		return nil, fmt.Errorf("create output directory: %w", err)
+	}
+	path := filepath.Join(outputDir, state.FileName)
+	states, err := state.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	readSessions, err := state.ReadSessions(path)
+	if err != nil {
+		return nil, err
+	}
+	j, err := state.Open(path, uuid.NewString())
+	if err != nil {
+		return nil, err
+	}
+
+	journal = j
+	sessions = readSessions
+	previousStates = make(map[string]state.ScenarioState, len(states))
+	for _, s := range states {
+		previousStates[s.OutputDir] = s
+	}
+	stopHeartbeat = recordHeartbeats(j)
+	scenarios.Session = j.Session()
+	return states, nil
+}
+
+// recordHeartbeats records a heartbeat in the journal every state.HeartbeatInterval, so that other
+// controllers on the same output directory know the session is alive. The returned function stops it.
+func recordHeartbeats(j *state.Journal) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(state.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := j.Record(state.Event{Type: state.EventHeartbeat}); err != nil {
+					log.Printf("Error: failed to record heartbeat in the journal: %v", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// CloseJournal closes the journal opened by OpenJournal
+func CloseJournal() error {
+	if stopHeartbeat != nil {
+		stopHeartbeat()
+		stopHeartbeat = nil
+	}
+	err := journal.Close()
+	journal = nil
+	previousStates = nil
+	sessions = nil
+	scenarios.Session = ""
+	return err
+}
+
+// StaleSessions returns the sessions of earlier runs that are gone and may have left scenario pods behind,
+// because a scenario of theirs never finished or a pod of theirs was never deleted
+func StaleSessions() []string {
+	stale := make(map[string]bool)
+	for _, s := range previousStates {
+		if s.Session != "" && (s.Unfinished() || len(s.Pods) > 0) && !sessionAlive(s.Session) {
+			stale[s.Session] = true
+		}
+	}
+	result := make([]string, 0, len(stale))
+	for session := range stale {
+		result = append(result, session)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// sessionAlive reports whether a session other than the one of this process may still be running,
+// according to the journal when it was opened
+func sessionAlive(session string) bool {
+	return session != journal.Session() && sessions[session].Alive(time.Now())
+}
+
+// recordEvent appends an event to the journal. Failing to record an event is logged and does not fail the scenario.
+func recordEvent(event state.Event) {
+	if err := journal.Record(event); err != nil {
+		log.Printf("Error: failed to record %s event of %s in the journal: %v", event.Type, event.OutputDir, err)
+	}
+}
+
+// withPodJournal returns a context that records the pods created and deleted for a scenario in the journal
+func withPodJournal(ctx context.Context, scenarioOutputFolder string) context.Context {
+	return kubeapi.WithPodObserver(ctx, func(event kubeapi.PodEvent, podName string) {
+		eventType := state.EventPodCreated
+		if event == kubeapi.PodDeleted {
+			eventType = state.EventPodDeleted
+		}
+		recordEvent(state.Event{Type: eventType, OutputDir: scenarioOutputFolder, Pod: podName})
+	})
+}
+
+// RecoverInterrupted deletes the pods that scenarios of earlier runs left behind and marks the scenarios
+// that were still running when their controller stopped as interrupted. Scenarios of sessions that are
+// still alive, such as a concap serve on the same directory, are left alone.
+func RecoverInterrupted(ctx context.Context, states []state.ScenarioState) error {
+	var errs []error
+	for _, s := range states {
+		if len(s.Pods) == 0 && !s.Unfinished() {
+			continue
+		}
+		if sessionAlive(s.Session) {
+			log.Printf("Scenario %s in %s belongs to the running session %s, not recovering it", s.Scenario, s.OutputDir, s.Session)
+			continue
+		}
+		if s.Unfinished() {
+			log.Printf("Scenario %s in %s was interrupted, it started at %s", s.Scenario, s.OutputDir, s.StartTime.Format(time.RFC3339))
+		}
+		scenarioCtx := withPodJournal(ctx, s.OutputDir)
+		for _, pod := range s.Pods {
+			log.Printf("Deleting pod %s left behind by scenario %s", pod, s.Scenario)
+			if err := deletePod(scenarioCtx, pod); err != nil {
+				errs = append(errs, fmt.Errorf("delete pod %s of scenario %s: %w", pod, s.Scenario, err))
+			}
+		}
+		if s.Unfinished() {
+			recordEvent(state.Event{Type: state.EventInterrupted, OutputDir: s.OutputDir, Scenario: s.Scenario})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SummarizeStates logs how the scenarios of earlier runs ended
+func SummarizeStates(states []state.ScenarioState) {
+	if len(states) == 0 {
+		return
+	}
+	counts := make(map[string]int)
+	for _, s := range states {
+		counts[s.Status]++
+	}
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	summary := ""
+	for i, status := range statuses {
+		if i > 0 {
+			summary += ", "
+		}
+		summary += fmt.Sprintf("%d %s", counts[status], status)
+	}
+	log.Printf("Journal holds %d scenarios of earlier runs: %s", len(states), summary)
+}
+
+// artifactPaths returns the files in the output directory of a scenario, relative to it
+func artifactPaths(scenarioOutputFolder string) []string {
+	var paths []string
+	filepath.WalkDir(scenarioOutputFolder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+		if relPath, err := filepath.Rel(scenarioOutputFolder, path); err == nil {
+			paths = append(paths, filepath.ToSlash(relPath))
+		}
+		return nil
+	})
+	return paths
+}
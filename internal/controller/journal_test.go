@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/idlab-discover/concap/internal/scenarios"
+	"github.com/idlab-discover/concap/internal/state"
+)
+
+func openTestJournal(t *testing.T, dir string) []state.ScenarioState {
+	t.Helper()
+	states, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+	t.Cleanup(func() { CloseJournal() })
+	return states
+}
+
+func TestRecoverInterruptedDeletesLeftoverPods(t *testing.T) {
+	dir := t.TempDir()
+	openTestJournal(t, dir)
+	recordEvent(state.Event{Type: state.EventStarted, OutputDir: "/out/scan", Scenario: "scan"})
+	recordEvent(state.Event{Type: state.EventPodCreated, OutputDir: "/out/scan", Pod: "scan-target"})
+	recordEvent(state.Event{Type: state.EventPodCreated, OutputDir: "/out/scan", Pod: "scan-attacker"})
+	recordEvent(state.Event{Type: state.EventStarted, OutputDir: "/out/done", Scenario: "done"})
+	recordEvent(state.Event{Type: state.EventFinished, OutputDir: "/out/done", Status: state.StatusCompleted})
+	if err := CloseJournal(); err != nil {
+		t.Fatal(err)
+	}
+
+	var deleted []string
+	originalDeletePod := deletePod
+	deletePod = func(ctx context.Context, podName string) error {
+		deleted = append(deleted, podName)
+		if podName == "scan-attacker" {
+			return errors.New("forbidden")
+		}
+		// The real DeletePod reports the deletion to the pod observer of the context
+		recordEvent(state.Event{Type: state.EventPodDeleted, OutputDir: "/out/scan", Pod: podName})
+		return nil
+	}
+	defer func() { deletePod = originalDeletePod }()
+
+	states := openTestJournal(t, dir)
+	err := RecoverInterrupted(context.Background(), states)
+	if err == nil {
+		t.Fatal("RecoverInterrupted() error = nil, want the failed deletion")
+	}
+	if !reflect.DeepEqual(deleted, []string{"scan-target", "scan-attacker"}) {
+		t.Fatalf("deleted pods = %v, want the pods of the interrupted scenario", deleted)
+	}
+	CloseJournal()
+
+	states, err = state.Read(filepath.Join(dir, state.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := states[1]
+	if scan.Status != state.StatusInterrupted {
+		t.Fatalf("scan status = %s, want %s", scan.Status, state.StatusInterrupted)
+	}
+	if !reflect.DeepEqual(scan.Pods, []string{"scan-attacker"}) {
+		t.Fatalf("scan pods = %v, want the pod that could not be deleted", scan.Pods)
+	}
+	if states[0].Status != state.StatusCompleted {
+		t.Fatalf("done status = %s, want it untouched", states[0].Status)
+	}
+}
+
+func TestRecoverInterruptedKeepsPodsOfLiveSessions(t *testing.T) {
+	dir := t.TempDir()
+	// Another controller, such as concap serve, is running a scenario on the same directory
+	live, err := state.Open(filepath.Join(dir, state.FileName), "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	live.Record(state.Event{Type: state.EventStarted, OutputDir: "/out/scan", Scenario: "scan"})
+	live.Record(state.Event{Type: state.EventPodCreated, OutputDir: "/out/scan", Pod: "scan-target"})
+
+	originalDeletePod := deletePod
+	deletePod = func(ctx context.Context, podName string) error {
+		t.Fatalf("deleted pod %s of a live session", podName)
+		return nil
+	}
+	defer func() { deletePod = originalDeletePod }()
+
+	states := openTestJournal(t, dir)
+	if err := RecoverInterrupted(context.Background(), states); err != nil {
+		t.Fatalf("RecoverInterrupted() error = %v", err)
+	}
+	CloseJournal()
+
+	states, err = state.Read(filepath.Join(dir, state.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || !states[0].Unfinished() || !reflect.DeepEqual(states[0].Pods, []string{"scan-target"}) {
+		t.Fatalf("journal states = %+v, want the scenario of the live session still running", states)
+	}
+}
+
+func TestStaleSessionsSkipsLiveSessions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, state.FileName)
+	crashed, err := state.Open(path, "crashed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed.Record(state.Event{Type: state.EventStarted, OutputDir: "/out/brute", Scenario: "brute"})
+	crashed.Close() // Closing marks the session as gone, like a crash after SessionTimeout
+	live, err := state.Open(path, "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	live.Record(state.Event{Type: state.EventStarted, OutputDir: "/out/scan", Scenario: "scan"})
+	live.Record(state.Event{Type: state.EventPodCreated, OutputDir: "/out/scan", Pod: "scan-target"})
+
+	openTestJournal(t, dir)
+	if got := StaleSessions(); !reflect.DeepEqual(got, []string{"crashed"}) {
+		t.Fatalf("StaleSessions() = %v, want only the session that is gone", got)
+	}
+	if scenarios.Session == "" || scenarios.Session == "serve" {
+		t.Fatalf("scenarios.Session = %q, want the session of this process", scenarios.Session)
+	}
+}
+
+func TestRunAttemptsRecordsJournal(t *testing.T) {
+	dir := t.TempDir()
+	openTestJournal(t, dir)
+	err := runAttempts(context.Background(), "scan", dir, RetryPolicy{}, func(context.Context) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("runAttempts() error = %v", err)
+	}
+	CloseJournal()
+
+	states, err := state.Read(filepath.Join(dir, state.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Attempts != 1 {
+		t.Fatalf("journal states = %+v, want one attempt of scan", states)
+	}
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/idlab-discover/concap/internal/scenarios"
+)
+
+// ManifestFileName is the completion marker written to the output directory of every scenario
+const ManifestFileName = "manifest.json"
+
+// ManifestStatus is the outcome of a scenario run
+type ManifestStatus string
+
+const (
+	ManifestCompleted ManifestStatus = "completed"
+	ManifestFailed    ManifestStatus = "failed"
+)
+
+// Manifest records the outcome of a scenario run and the files it produced, so that a resumed
+// batch can tell complete output apart from partial or corrupted output.
+type Manifest struct {
+	Scenario string `json:"scenario"`
+	Source   string `json:"source"`
+	// SourceSHA256 is the checksum of the scenario definition, output of an edited definition is stale
+	SourceSHA256 string         `json:"sourceSha256"`
+	Status       ManifestStatus `json:"status"`
+	Error        string         `json:"error,omitempty"`
+	StartTime    time.Time      `json:"startTime"`
+	FinishTime   time.Time      `json:"finishTime"`
+	Files        []ManifestFile `json:"files"`
+}
+
+// ManifestFile is an output file of a scenario run, with its path relative to the output directory
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// sourceChecksum returns the checksum of a scenario definition
+func sourceChecksum(source scenarios.ScenarioSource) string {
+	sum := sha256.Sum256(source.YAML)
+	return hex.EncodeToString(sum[:])
+}
+
+// WriteManifest records the files in the output directory and writes the manifest next to them.
+// The manifest is written to a temporary file first so that a crash never leaves a partial marker.
+func WriteManifest(outputDir string, manifest Manifest) error {
+	files, err := checksumFiles(outputDir)
+	if err != nil {
+		return fmt.Errorf("checksum output files: %w", err)
+	}
+	manifest.Files = files
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	tmpPath := filepath.Join(outputDir, ManifestFileName+".tmp")
+	if err := os.WriteFile(tmpPath, b, 0644); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(outputDir, ManifestFileName)); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest reads the manifest from an output directory
+func ReadManifest(outputDir string) (Manifest, error) {
+	var manifest Manifest
+	b, err := os.ReadFile(filepath.Join(outputDir, ManifestFileName))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return manifest, fmt.Errorf("parse manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// VerifyOutput checks that the output directory holds the complete output of the scenario source:
+// the run completed, the definition is unchanged and every recorded file is intact.
+func VerifyOutput(outputDir string, source scenarios.ScenarioSource) error {
+	manifest, err := ReadManifest(outputDir)
+	if err != nil {
+		return err
+	}
+	if manifest.Status != ManifestCompleted {
+		return fmt.Errorf("previous run %s: %s", manifest.Status, manifest.Error)
+	}
+	if manifest.SourceSHA256 != sourceChecksum(source) {
+		return fmt.Errorf("scenario definition changed since the previous run")
+	}
+
+	files, err := checksumFiles(outputDir)
+	if err != nil {
+		return fmt.Errorf("checksum output files: %w", err)
+	}
+	current := make(map[string]ManifestFile, len(files))
+	for _, file := range files {
+		current[file.Path] = file
+	}
+	for _, file := range manifest.Files {
+		if got, ok := current[file.Path]; !ok {
+			return fmt.Errorf("output file %s is missing", file.Path)
+		} else if got != file {
+			return fmt.Errorf("output file %s changed since the previous run", file.Path)
+		}
+	}
+	return nil
+}
+
+// removeManifest removes the completion marker so that an interrupted run is never taken for complete
+func removeManifest(outputDir string) error {
+	err := os.Remove(filepath.Join(outputDir, ManifestFileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// checksumFiles returns the size and checksum of every file below dir except the manifest
+func checksumFiles(dir string) ([]ManifestFile, error) {
+	var files []ManifestFile
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == ManifestFileName || relPath == ManifestFileName+".tmp" {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		hash := sha256.New()
+		size, err := io.Copy(hash, file)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		files = append(files, ManifestFile{
+			Path:   filepath.ToSlash(relPath),
+			Size:   size,
+			SHA256: hex.EncodeToString(hash.Sum(nil)),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idlab-discover/concap/internal/scenarios"
+)
+
+func writeOutputFile(t *testing.T, dir, name, contents string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("create output directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("write output file: %v", err)
+	}
+}
+
+func completedOutput(t *testing.T, source scenarios.ScenarioSource) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeOutputFile(t, dir, "dump.pcap", "pcap")
+	writeOutputFile(t, dir, "scenario.yaml", "name: scan")
+	writeOutputFile(t, dir, "web/rustiflow.csv", "flows")
+	err := WriteManifest(dir, Manifest{
+		Scenario:     source.Name,
+		SourceSHA256: sourceChecksum(source),
+		Status:       ManifestCompleted,
+		StartTime:    time.Now(),
+		FinishTime:   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("WriteManifest() error = %v", err)
+	}
+	return dir
+}
+
+func TestWriteManifestRecordsOutputFiles(t *testing.T) {
+	source := scenarios.ScenarioSource{Name: "scan", YAML: []byte("type: single-target")}
+	dir := completedOutput(t, source)
+
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("ReadManifest() error = %v", err)
+	}
+	var paths []string
+	for _, file := range manifest.Files {
+		paths = append(paths, file.Path)
+	}
+	if got, want := strings.Join(paths, ","), "dump.pcap,scenario.yaml,web/rustiflow.csv"; got != want {
+		t.Fatalf("manifest files = %q, want %q", got, want)
+	}
+	if manifest.Files[0].Size != 4 || len(manifest.Files[0].SHA256) != 64 {
+		t.Fatalf("manifest file = %+v, want size 4 and a sha256 checksum", manifest.Files[0])
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManifestFileName+".tmp")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("temporary manifest left behind: %v", err)
+	}
+}
+
+func TestVerifyOutput(t *testing.T) {
+	source := scenarios.ScenarioSource{Name: "scan", YAML: []byte("type: single-target")}
+
+	tests := []struct {
+		name    string
+		modify  func(t *testing.T, dir string)
+		source  scenarios.ScenarioSource
+		wantErr string
+	}{
+		{
+			name:   "complete",
+			modify: func(t *testing.T, dir string) {},
+			source: source,
+		},
+		{
+			name:   "extra files are ignored",
+			modify: func(t *testing.T, dir string) { writeOutputFile(t, dir, "notes.txt", "notes") },
+			source: source,
+		},
+		{
+			name:    "missing file",
+			modify:  func(t *testing.T, dir string) { os.Remove(filepath.Join(dir, "dump.pcap")) },
+			source:  source,
+			wantErr: "dump.pcap is missing",
+		},
+		{
+			name:    "truncated file",
+			modify:  func(t *testing.T, dir string) { writeOutputFile(t, dir, "web/rustiflow.csv", "flo") },
+			source:  source,
+			wantErr: "web/rustiflow.csv changed",
+		},
+		{
+			name:    "changed definition",
+			modify:  func(t *testing.T, dir string) {},
+			source:  scenarios.ScenarioSource{Name: "scan", YAML: []byte("type: multi-target")},
+			wantErr: "definition changed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := completedOutput(t, source)
+			tt.modify(t, dir)
+
+			err := VerifyOutput(dir, tt.source)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifyOutput() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("VerifyOutput() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyOutputRejectsFailedAndMissingRuns(t *testing.T) {
+	source := scenarios.ScenarioSource{Name: "scan", YAML: []byte("type: single-target")}
+
+	if err := VerifyOutput(t.TempDir(), source); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("VerifyOutput() without manifest error = %v, want fs.ErrNotExist", err)
+	}
+
+	dir := t.TempDir()
+	writeOutputFile(t, dir, "partial-dump.pcap", "pcap")
+	err := WriteManifest(dir, Manifest{
+		Scenario:     source.Name,
+		SourceSHA256: sourceChecksum(source),
+		Status:       ManifestFailed,
+		Error:        "attack timed out",
+	})
+	if err != nil {
+		t.Fatalf("WriteManifest() error = %v", err)
+	}
+	if err := VerifyOutput(dir, source); err == nil || !strings.Contains(err.Error(), "attack timed out") {
+		t.Fatalf("VerifyOutput() error = %v, want failed run", err)
+	}
+}
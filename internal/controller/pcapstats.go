@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Magic numbers of the capture file formats written by tcpdump and reordercap
+const (
+	pcapMagicMicros = 0xa1b2c3d4
+	pcapMagicNanos  = 0xa1b23c4d
+	pcapngMagic     = 0x0a0d0d0a
+	// pcapngByteOrderMagic is the byte-order magic of a pcapng section header block
+	pcapngByteOrderMagic = 0x1a2b3c4d
+)
+
+// CaptureStats are the number of packets in a capture file and their length on the wire
+type CaptureStats struct {
+	Packets int64 `json:"packets"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// CountCapture reads a pcap or pcapng file and counts its packets and bytes
+func CountCapture(path string) (CaptureStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return CaptureStats{}, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	header, err := r.Peek(4)
+	if err != nil {
+		return CaptureStats{}, fmt.Errorf("read capture header: %w", err)
+	}
+	if binary.LittleEndian.Uint32(header) == pcapngMagic {
+		return countPcapng(r)
+	}
+	return countPcap(r)
+}
+
+func countPcap(r io.Reader) (CaptureStats, error) {
+	var stats CaptureStats
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return stats, fmt.Errorf("read pcap header: %w", err)
+	}
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint32(header) == pcapMagicMicros || binary.LittleEndian.Uint32(header) == pcapMagicNanos:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == pcapMagicMicros || binary.BigEndian.Uint32(header) == pcapMagicNanos:
+		order = binary.BigEndian
+	default:
+		return stats, fmt.Errorf("not a pcap file")
+	}
+
+	record := make([]byte, 16)
+	for {
+		// A capture cut off while tcpdump was stopped still counts up to the last complete packet
+		if _, err := io.ReadFull(r, record); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return stats, nil
+			}
+			return stats, err
+		}
+		capturedLength := order.Uint32(record[8:12])
+		if _, err := io.CopyN(io.Discard, r, int64(capturedLength)); err != nil {
+			if errors.Is(err, io.EOF) {
+				return stats, nil
+			}
+			return stats, err
+		}
+		stats.Packets++
+		stats.Bytes += int64(order.Uint32(record[12:16]))
+	}
+}
+
+func countPcapng(r io.Reader) (CaptureStats, error) {
+	var stats CaptureStats
+	var order binary.ByteOrder = binary.LittleEndian
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return stats, nil
+			}
+			return stats, err
+		}
+
+		// Every section header block sets the byte order of the blocks that follow it, its type reads the same in both
+		blockType := order.Uint32(header[:4])
+		headerLength := int64(8)
+		if blockType == pcapngMagic {
+			byteOrder := make([]byte, 4)
+			if _, err := io.ReadFull(r, byteOrder); err != nil {
+				return stats, fmt.Errorf("read pcapng section header: %w", err)
+			}
+			switch {
+			case binary.LittleEndian.Uint32(byteOrder) == pcapngByteOrderMagic:
+				order = binary.LittleEndian
+			case binary.BigEndian.Uint32(byteOrder) == pcapngByteOrderMagic:
+				order = binary.BigEndian
+			default:
+				return stats, fmt.Errorf("invalid pcapng byte-order magic")
+			}
+			headerLength = 12
+		}
+
+		blockLength := int64(order.Uint32(header[4:8]))
+		if blockLength < headerLength+4 || blockLength%4 != 0 {
+			return stats, fmt.Errorf("invalid pcapng block length %d", blockLength)
+		}
+		body := make([]byte, blockLength-headerLength)
+		if _, err := io.ReadFull(r, body); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return stats, nil
+			}
+			return stats, err
+		}
+		switch {
+		case blockType == 6 && len(body) >= 20: // Enhanced packet block, the original length follows the interface, timestamp and captured length
+			stats.Packets++
+			stats.Bytes += int64(order.Uint32(body[16:20]))
+		case blockType == 3 && len(body) >= 4: // Simple packet block
+			stats.Packets++
+			stats.Bytes += int64(order.Uint32(body[0:4]))
+		}
+	}
+}
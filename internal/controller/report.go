@@ -0,0 +1,324 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/idlab-discover/concap/internal/scenarios"
+)
+
+// File names of the run report written to the output directory at the end of a run
+const (
+	RunReportJSONFileName = "run-report.json"
+	RunReportHTMLFileName = "run-report.html"
+)
+
+// ScenarioStatus is the outcome of a scenario in a run
+type ScenarioStatus string
+
+const (
+	ScenarioCompleted ScenarioStatus = "completed"
+	ScenarioFailed    ScenarioStatus = "failed"
+	// ScenarioSkipped scenarios were not run because --resume found their output complete
+	ScenarioSkipped ScenarioStatus = "skipped"
+)
+
+// reportPhases are the phases listed in the report, in execution order
+var reportPhases = []string{
+	scenarios.PhaseDeploy,
+	scenarios.PhaseCapture,
+	scenarios.PhaseAttack,
+	scenarios.PhaseDownload,
+	scenarios.PhaseProcessing,
+}
+
+// ScenarioResult is the outcome of a scenario request
+type ScenarioResult struct {
+	ID         string         `json:"id,omitempty"`
+	Scenario   string         `json:"scenario"`
+	Source     string         `json:"source"`
+	OutputDir  string         `json:"outputDir"`
+	Status     ScenarioStatus `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	StartTime  time.Time      `json:"startTime"`
+	FinishTime time.Time      `json:"finishTime"`
+	Attempts   int            `json:"attempts,omitempty"`
+	// Phases are the durations of the phases of the last attempt
+	Phases  []PhaseResult  `json:"phases,omitempty"`
+	Targets []TargetResult `json:"targets,omitempty"`
+	// Err is the error of a failed scenario
+	Err error `json:"-"`
+}
+
+// PhaseResult is the duration of a phase of a scenario run
+type PhaseResult struct {
+	Phase   string  `json:"phase"`
+	Seconds float64 `json:"seconds"`
+}
+
+// TargetResult summarizes the capture of a target and the flows the processors extracted from it
+type TargetResult struct {
+	Name string `json:"name"`
+	CaptureStats
+	// Error explains why the capture could not be counted
+	Error string          `json:"error,omitempty"`
+	Flows []ProcessorFlow `json:"flows,omitempty"`
+}
+
+// ProcessorFlow is the number of flows a processing pod extracted from a target capture
+type ProcessorFlow struct {
+	Processor string `json:"processor"`
+	Flows     int    `json:"flows"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RunReport summarizes every scenario of a run
+type RunReport struct {
+	StartTime  time.Time        `json:"startTime"`
+	FinishTime time.Time        `json:"finishTime"`
+	Completed  int              `json:"completed"`
+	Failed     int              `json:"failed"`
+	Skipped    int              `json:"skipped"`
+	Scenarios  []ScenarioResult `json:"scenarios"`
+}
+
+// NewRunReport summarizes the results of a run that started at startTime, ordered by output directory
+func NewRunReport(startTime time.Time, results []ScenarioResult) RunReport {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].OutputDir < results[j].OutputDir
+	})
+	report := RunReport{
+		StartTime:  startTime,
+		FinishTime: time.Now(),
+		Scenarios:  results,
+	}
+	for _, result := range results {
+		switch result.Status {
+		case ScenarioCompleted:
+			report.Completed++
+		case ScenarioFailed:
+			report.Failed++
+		case ScenarioSkipped:
+			report.Skipped++
+		}
+	}
+	return report
+}
+
+// WriteRunReport writes the run report to the output directory as JSON and as a static HTML page
+func WriteRunReport(outputDir string, report RunReport) error {
+	if err := os.MkdirAll(outputDir, 0777); err != nil {
+		return fmt.Errorf("create output directory: %w", err)
+	}
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal run report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, RunReportJSONFileName), b, 0644); err != nil {
+		return fmt.Errorf("write run report: %w", err)
+	}
+
+	file, err := os.Create(filepath.Join(outputDir, RunReportHTMLFileName))
+	if err != nil {
+		return fmt.Errorf("write run report: %w", err)
+	}
+	defer file.Close()
+	if err := renderRunReport(file, report); err != nil {
+		return fmt.Errorf("render run report: %w", err)
+	}
+	return file.Close()
+}
+
+// phaseRecorder collects the phase durations of a scenario attempt
+type phaseRecorder struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+}
+
+func (r *phaseRecorder) observe(phase string, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.durations == nil {
+		r.durations = make(map[string]time.Duration)
+	}
+	r.durations[phase] += duration
+}
+
+// reset forgets the durations of a previous attempt
+func (r *phaseRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.durations = nil
+}
+
+// results returns the recorded phases in execution order
+func (r *phaseRecorder) results() []PhaseResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seconds := make(map[string]float64, len(r.durations))
+	for phase, duration := range r.durations {
+		seconds[phase] = duration.Seconds()
+	}
+	return phaseResults(seconds)
+}
+
+// phaseResults returns phase durations in seconds, as recorded in the journal, in execution order
+func phaseResults(seconds map[string]float64) []PhaseResult {
+	var phases []PhaseResult
+	for _, phase := range reportPhases {
+		if s, ok := seconds[phase]; ok {
+			phases = append(phases, PhaseResult{Phase: phase, Seconds: s})
+		}
+	}
+	return phases
+}
+
+// collectTargetResults counts the packets of every target capture and the flows of every processor output
+// in the output directory of a scenario
+func collectTargetResults(source scenarios.ScenarioSource, scenarioOutputFolder string, processingPods []*scenarios.ProcessingPod) []TargetResult {
+	scenario, err := scenarios.CreateScenarioFromSource(source)
+	if err != nil {
+		return nil
+	}
+
+	var targets []TargetResult
+	for _, output := range scenarios.TargetOutputs(scenario, scenarioOutputFolder) {
+		target := TargetResult{Name: output.Name}
+		stats, err := CountCapture(filepath.Join(output.Dir, "dump.pcap"))
+		if err != nil {
+			target.Error = describeMissing(err, "no capture")
+		}
+		target.CaptureStats = stats
+
+		for _, pod := range processingPods {
+			flows := ProcessorFlow{Processor: pod.Name}
+			count, err := countFlows(filepath.Join(output.Dir, pod.Name+".csv"))
+			if err != nil {
+				flows.Error = describeMissing(err, "no output")
+			}
+			flows.Flows = count
+			target.Flows = append(target.Flows, flows)
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// describeMissing returns missing for a file that does not exist and the error message otherwise
+func describeMissing(err error, missing string) string {
+	if errors.Is(err, fs.ErrNotExist) {
+		return missing
+	}
+	return err.Error()
+}
+
+// countFlows returns the number of records in a processor CSV, not counting the header
+func countFlows(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records := 0
+	for {
+		_, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+		}
+		records++
+	}
+	if records == 0 {
+		return 0, nil
+	}
+	return records - 1, nil
+}
+
+var runReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"seconds": func(seconds float64) string {
+		return (time.Duration(seconds * float64(time.Second))).Round(time.Second).String()
+	},
+	"duration": func(start, finish time.Time) string {
+		return finish.Sub(start).Round(time.Second).String()
+	},
+	"timestamp": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+	"phase": func(phases []PhaseResult, name string) *PhaseResult {
+		for i := range phases {
+			if phases[i].Phase == name {
+				return &phases[i]
+			}
+		}
+		return nil
+	},
+	"phases": func() []string {
+		return reportPhases
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>ConCap run report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+td.number { text-align: right; }
+.completed { color: #1a7f37; }
+.failed { color: #cf222e; }
+.skipped { color: #6e7781; }
+.error { color: #cf222e; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>ConCap run report</h1>
+<p>Started {{timestamp .StartTime}}, finished {{timestamp .FinishTime}} ({{duration .StartTime .FinishTime}}).</p>
+<p><span class="completed">{{.Completed}} completed</span>, <span class="failed">{{.Failed}} failed</span>, <span class="skipped">{{.Skipped}} skipped</span>.</p>
+<h2>Scenarios</h2>
+<table>
+<tr><th>Scenario</th><th>Status</th><th>Attempts</th><th>Duration</th>{{range phases}}<th>{{.}}</th>{{end}}<th>Error</th></tr>
+{{range .Scenarios}}{{$phases := .Phases}}<tr>
+<td><a href="#{{.Scenario}}">{{.Scenario}}</a></td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td class="number">{{.Attempts}}</td>
+<td class="number">{{duration .StartTime .FinishTime}}</td>
+{{range phases}}<td class="number">{{with phase $phases .}}{{seconds .Seconds}}{{end}}</td>{{end}}
+<td class="error">{{.Error}}</td>
+</tr>
+{{end}}</table>
+<h2>Targets</h2>
+{{range .Scenarios}}{{if .Targets}}<h3 id="{{.Scenario}}">{{.Scenario}}</h3>
+<p>Output: <code>{{.OutputDir}}</code></p>
+<table>
+<tr><th>Target</th><th>Packets</th><th>Bytes</th><th>Flows</th></tr>
+{{range .Targets}}<tr>
+<td>{{.Name}}</td>
+{{if .Error}}<td colspan="2" class="error">{{.Error}}</td>{{else}}<td class="number">{{.Packets}}</td><td class="number">{{.Bytes}}</td>{{end}}
+<td>{{range .Flows}}{{.Processor}}: {{if .Error}}<span class="error">{{.Error}}</span>{{else}}{{.Flows}}{{end}}<br>{{end}}</td>
+</tr>
+{{end}}</table>
+{{end}}{{end}}</body>
+</html>
+`))
+
+func renderRunReport(w io.Writer, report RunReport) error {
+	return runReportTemplate.Execute(w, report)
+}
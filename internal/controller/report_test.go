@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idlab-discover/concap/internal/scenarios"
+)
+
+// pcapFile returns a little-endian pcap file holding packets with the given captured and original lengths
+func pcapFile(packets ...[2]uint32) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, []uint32{pcapMagicMicros, 0x00040002, 0, 0, 65535, 1})
+	for _, packet := range packets {
+		binary.Write(&b, binary.LittleEndian, []uint32{0, 0, packet[0], packet[1]})
+		b.Write(make([]byte, packet[0]))
+	}
+	return b.Bytes()
+}
+
+// pcapngFile returns a big-endian pcapng file holding enhanced packet blocks with the given captured and original lengths
+func pcapngFile(packets ...[2]uint32) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, []uint32{pcapngMagic, 28, pcapngByteOrderMagic, 0x00010000, 0xffffffff, 0xffffffff, 28})
+	binary.Write(&b, binary.BigEndian, []uint32{1, 20, 0x00010000, 65535, 20})
+	for _, packet := range packets {
+		padded := (packet[0] + 3) &^ 3
+		length := 32 + padded
+		binary.Write(&b, binary.BigEndian, []uint32{6, length, 0, 0, 0, packet[0], packet[1]})
+		b.Write(make([]byte, padded))
+		binary.Write(&b, binary.BigEndian, length)
+	}
+	return b.Bytes()
+}
+
+func TestCountCapture(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents []byte
+		want     CaptureStats
+	}{
+		{"pcap", pcapFile([2]uint32{60, 60}, [2]uint32{96, 1514}), CaptureStats{Packets: 2, Bytes: 1574}},
+		{"empty pcap", pcapFile(), CaptureStats{}},
+		{"truncated pcap", pcapFile([2]uint32{60, 60}, [2]uint32{96, 1514})[:24+16+60+16+10], CaptureStats{Packets: 1, Bytes: 60}},
+		{"pcapng", pcapngFile([2]uint32{42, 42}, [2]uint32{61, 1500}), CaptureStats{Packets: 2, Bytes: 1542}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "dump.pcap")
+			if err := os.WriteFile(path, tt.contents, 0644); err != nil {
+				t.Fatalf("write capture: %v", err)
+			}
+			got, err := CountCapture(path)
+			if err != nil {
+				t.Fatalf("CountCapture() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("CountCapture() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountCaptureRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.pcap")
+	if err := os.WriteFile(path, []byte("not a capture file at all"), 0644); err != nil {
+		t.Fatalf("write capture: %v", err)
+	}
+	if _, err := CountCapture(path); err == nil {
+		t.Fatal("CountCapture() error = nil, want an error for a file that is not a capture")
+	}
+}
+
+func TestCollectTargetResults(t *testing.T) {
+	sources, err := scenarios.LoadScenarioSources(filepath.Join("..", "..", "example", "scenarios", "nmap-multi-target-scan.yaml"))
+	if err != nil {
+		t.Fatalf("LoadScenarioSources() error = %v", err)
+	}
+	dir := t.TempDir()
+	writeOutputFile(t, dir, "web-server-1/dump.pcap", string(pcapFile([2]uint32{60, 60}, [2]uint32{60, 74})))
+	writeOutputFile(t, dir, "web-server-1/rustiflow.csv", "src,dst\n10.0.0.1,10.0.1.1\n10.0.0.1,10.0.1.2\n")
+	writeOutputFile(t, dir, "web-server-2/dump.pcap", string(pcapFile()))
+
+	pods := []*scenarios.ProcessingPod{{Name: "rustiflow"}}
+	targets := collectTargetResults(sources[0], dir, pods)
+	if len(targets) != 3 {
+		t.Fatalf("collected %d targets, want 3", len(targets))
+	}
+	if got := targets[0]; got.Name != "web-server-1" || got.Packets != 2 || got.Bytes != 134 || got.Error != "" {
+		t.Fatalf("first target = %+v, want 2 packets and 134 bytes", got)
+	}
+	if got := targets[0].Flows; len(got) != 1 || got[0].Flows != 2 || got[0].Error != "" {
+		t.Fatalf("first target flows = %+v, want 2 rustiflow flows", got)
+	}
+	if got := targets[1].Flows[0].Error; got != "no output" {
+		t.Fatalf("second target flow error = %q, want %q", got, "no output")
+	}
+	if got := targets[2].Error; got != "no capture" {
+		t.Fatalf("third target error = %q, want %q", got, "no capture")
+	}
+}
+
+func TestWriteRunReport(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	report := NewRunReport(start, []ScenarioResult{
+		{
+			Scenario:  "scan-b",
+			OutputDir: filepath.Join(dir, "scan-b"),
+			Status:    ScenarioFailed,
+			Error:     "execute scenario scan-b: <timeout>",
+			Err:       errors.New("execute scenario scan-b: <timeout>"),
+			Attempts:  2,
+		},
+		{
+			Scenario:  "scan-a",
+			OutputDir: filepath.Join(dir, "scan-a"),
+			Status:    ScenarioCompleted,
+			Attempts:  1,
+			Phases:    []PhaseResult{{Phase: scenarios.PhaseDeploy, Seconds: 12}, {Phase: scenarios.PhaseAttack, Seconds: 60}},
+			Targets:   []TargetResult{{Name: "web", CaptureStats: CaptureStats{Packets: 10, Bytes: 1000}, Flows: []ProcessorFlow{{Processor: "rustiflow", Flows: 3}}}},
+		},
+		{Scenario: "scan-c", OutputDir: filepath.Join(dir, "scan-c"), Status: ScenarioSkipped},
+	})
+	if report.Completed != 1 || report.Failed != 1 || report.Skipped != 1 {
+		t.Fatalf("report counts = %d completed, %d failed, %d skipped, want 1 of each", report.Completed, report.Failed, report.Skipped)
+	}
+	if err := WriteRunReport(dir, report); err != nil {
+		t.Fatalf("WriteRunReport() error = %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, RunReportJSONFileName))
+	if err != nil {
+		t.Fatalf("read JSON report: %v", err)
+	}
+	var written RunReport
+	if err := json.Unmarshal(b, &written); err != nil {
+		t.Fatalf("parse JSON report: %v", err)
+	}
+	var names []string
+	for _, result := range written.Scenarios {
+		names = append(names, result.Scenario)
+	}
+	if got, want := strings.Join(names, ","), "scan-a,scan-b,scan-c"; got != want {
+		t.Fatalf("report scenarios = %q, want %q", got, want)
+	}
+	if got := written.Scenarios[0].Targets[0]; got.Packets != 10 || got.Flows[0].Flows != 3 {
+		t.Fatalf("report target = %+v, want 10 packets and 3 flows", got)
+	}
+
+	html, err := os.ReadFile(filepath.Join(dir, RunReportHTMLFileName))
+	if err != nil {
+		t.Fatalf("read HTML report: %v", err)
+	}
+	for _, want := range []string{"scan-a", "1m0s", "rustiflow: 3", "&lt;timeout&gt;", "1 completed"} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("HTML report does not contain %q", want)
+		}
+	}
+}
+
+func TestPhaseRecorderKeepsLastAttempt(t *testing.T) {
+	recorder := &phaseRecorder{}
+	recorder.observe(scenarios.PhaseDeploy, time.Minute)
+	recorder.reset()
+	recorder.observe(scenarios.PhaseAttack, 2*time.Second)
+	recorder.observe(scenarios.PhaseDeploy, time.Second)
+	recorder.observe(scenarios.PhaseDownload, time.Second)
+	recorder.observe(scenarios.PhaseDownload, time.Second)
+
+	got := recorder.results()
+	want := []PhaseResult{{scenarios.PhaseDeploy, 1}, {scenarios.PhaseAttack, 2}, {scenarios.PhaseDownload, 2}}
+	if len(got) != len(want) {
+		t.Fatalf("results() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("results() = %+v, want %+v", got, want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AttemptsFileName is the record of every attempt written to the output directory of a scenario
+const AttemptsFileName = "attempts.json"
+
+// attemptDirPrefix prefixes the directories holding the partial artifacts of earlier attempts
+const attemptDirPrefix = "attempt-"
+
+// RetryPolicy decides how often a scenario that failed with a transient error is run again.
+// Failures of the attack itself are never retried.
+type RetryPolicy struct {
+	// Retries is the number of extra attempts after the first one
+	Retries int
+	// Backoff is the wait before the first retry, it doubles for every following retry
+	Backoff time.Duration
+}
+
+// delay returns the wait before the given attempt, attempts are numbered from 1
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	if attempt <= 1 || p.Backoff <= 0 {
+		return 0
+	}
+	return p.Backoff << (attempt - 2)
+}
+
+// Attempt records a single run of a scenario
+type Attempt struct {
+	Attempt    int       `json:"attempt"`
+	StartTime  time.Time `json:"startTime"`
+	FinishTime time.Time `json:"finishTime"`
+	Error      string    `json:"error,omitempty"`
+	Transient  bool      `json:"transient,omitempty"`
+	// ArtifactDir is the directory the partial artifacts of a retried attempt were moved to
+	ArtifactDir string `json:"artifactDir,omitempty"`
+}
+
+// writeAttempts records the attempts of a scenario run in its output directory
+func writeAttempts(outputDir string, attempts []Attempt) error {
+	b, err := json.MarshalIndent(attempts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal attempts: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, AttemptsFileName), b, 0644); err != nil {
+		return fmt.Errorf("write attempts: %w", err)
+	}
+	return nil
+}
+
+// archiveAttempt moves the artifacts of a failed attempt to attempt-<n>/ so that the next attempt
+// starts from an empty output directory. It returns the name of the archive directory.
+func archiveAttempt(outputDir string, attempt int) (string, error) {
+	archiveName := attemptDirPrefix + strconv.Itoa(attempt)
+	archiveDir := filepath.Join(outputDir, archiveName)
+	if err := os.RemoveAll(archiveDir); err != nil {
+		return "", err
+	}
+	if err := os.Mkdir(archiveDir, 0777); err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if isAttemptRecord(entry) {
+			continue
+		}
+		if err := os.Rename(filepath.Join(outputDir, entry.Name()), filepath.Join(archiveDir, entry.Name())); err != nil {
+			return "", err
+		}
+	}
+	return archiveName, nil
+}
+
+// isAttemptRecord reports whether entry is an attempt-<n> archive directory or the attempts record
+// itself. Other artifacts that happen to share the prefix, such as attempt-web/, are left alone.
+func isAttemptRecord(entry fs.DirEntry) bool {
+	name := entry.Name()
+	if !entry.IsDir() {
+		return name == AttemptsFileName
+	}
+	number, ok := strings.CutPrefix(name, attemptDirPrefix)
+	if !ok || number == "" {
+		return false
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// removeAttempts removes the attempt records of a previous run of the scenario
+func removeAttempts(outputDir string) error {
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if !isAttemptRecord(entry) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(outputDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sleepContext waits for the given duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
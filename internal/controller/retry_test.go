@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	kubeexec "k8s.io/client-go/util/exec"
+)
+
+func readAttempts(t *testing.T, dir string) []Attempt {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, AttemptsFileName))
+	if err != nil {
+		t.Fatalf("read attempts: %v", err)
+	}
+	var attempts []Attempt
+	if err := json.Unmarshal(b, &attempts); err != nil {
+		t.Fatalf("parse attempts: %v", err)
+	}
+	return attempts
+}
+
+func TestRunAttemptsRetriesTransientFailures(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	err := runAttempts(context.Background(), "scan", dir, RetryPolicy{Retries: 2, Backoff: time.Millisecond}, func(context.Context) error {
+		calls++
+		writeOutputFile(t, dir, "dump.pcap", fmt.Sprintf("attempt %d", calls))
+		if calls == 1 {
+			return fmt.Errorf("download results: %w", &kubeapi.CopyError{Direction: "download", PodName: "target", Path: "/dump.pcap", Err: errors.New("exit status 1")})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("runAttempts() error = %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("scenario ran %d times, want 2", calls)
+	}
+
+	archived, err := os.ReadFile(filepath.Join(dir, "attempt-1", "dump.pcap"))
+	if err != nil || string(archived) != "attempt 1" {
+		t.Fatalf("archived artifact = %q, %v, want the output of the first attempt", archived, err)
+	}
+	current, err := os.ReadFile(filepath.Join(dir, "dump.pcap"))
+	if err != nil || string(current) != "attempt 2" {
+		t.Fatalf("artifact = %q, %v, want the output of the second attempt", current, err)
+	}
+
+	attempts := readAttempts(t, dir)
+	if len(attempts) != 2 {
+		t.Fatalf("recorded %d attempts, want 2", len(attempts))
+	}
+	if !attempts[0].Transient || attempts[0].ArtifactDir != "attempt-1" || attempts[0].Error == "" {
+		t.Fatalf("first attempt = %+v, want a transient failure archived in attempt-1", attempts[0])
+	}
+	if attempts[1].Error != "" || attempts[1].ArtifactDir != "" {
+		t.Fatalf("second attempt = %+v, want a success", attempts[1])
+	}
+}
+
+func TestRunAttemptsDoesNotRetryAttackFailures(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	attackErr := fmt.Errorf("execute attack: %w", kubeexec.CodeExitError{Err: errors.New("command terminated with exit code 124"), Code: 124})
+	err := runAttempts(context.Background(), "scan", dir, RetryPolicy{Retries: 3}, func(context.Context) error {
+		calls++
+		return attackErr
+	})
+	if !errors.Is(err, attackErr) {
+		t.Fatalf("runAttempts() error = %v, want the attack failure", err)
+	}
+	if calls != 1 {
+		t.Fatalf("scenario ran %d times, want 1", calls)
+	}
+	attempts := readAttempts(t, dir)
+	if len(attempts) != 1 || attempts[0].Transient {
+		t.Fatalf("attempts = %+v, want a single permanent failure", attempts)
+	}
+}
+
+func TestRunAttemptsGivesUpAfterRetries(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	err := runAttempts(context.Background(), "scan", dir, RetryPolicy{Retries: 2}, func(context.Context) error {
+		calls++
+		return &kubeapi.PodNotReadyError{PodName: "target", Timeout: time.Minute}
+	})
+	if !kubeapi.IsTransient(err) {
+		t.Fatalf("runAttempts() error = %v, want the last transient failure", err)
+	}
+	if calls != 3 {
+		t.Fatalf("scenario ran %d times, want 3", calls)
+	}
+	attempts := readAttempts(t, dir)
+	if len(attempts) != 3 || attempts[2].ArtifactDir != "" {
+		t.Fatalf("attempts = %+v, want 3 attempts with the last one left in place", attempts)
+	}
+}
+
+func TestAttemptRecordsKeepArtifactsSharingThePrefix(t *testing.T) {
+	dir := t.TempDir()
+	writeOutputFile(t, dir, "attempt-web/dump.pcap", "web")
+	writeOutputFile(t, dir, "attempt-notes.txt", "notes")
+	writeOutputFile(t, dir, "attempt-2/dump.pcap", "old")
+	writeOutputFile(t, dir, AttemptsFileName, "[]")
+
+	if err := removeAttempts(dir); err != nil {
+		t.Fatalf("removeAttempts() error = %v", err)
+	}
+	for _, name := range []string{"attempt-2", AttemptsFileName} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s still exists after removeAttempts, err = %v", name, err)
+		}
+	}
+	for _, name := range []string{"attempt-web/dump.pcap", "attempt-notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("removeAttempts removed artifact %s: %v", name, err)
+		}
+	}
+
+	if _, err := archiveAttempt(dir, 1); err != nil {
+		t.Fatalf("archiveAttempt() error = %v", err)
+	}
+	for _, name := range []string{"attempt-web/dump.pcap", "attempt-notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, "attempt-1", name)); err != nil {
+			t.Errorf("archiveAttempt did not archive artifact %s: %v", name, err)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Retries: 3, Backoff: time.Second}
+	for attempt, want := range map[int]time.Duration{1: 0, 2: time.Second, 3: 2 * time.Second, 4: 4 * time.Second} {
+		if got := policy.delay(attempt); got != want {
+			t.Errorf("delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
@@ -4,22 +4,19 @@ package kubernetes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os/exec"
-	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 	"k8s.io/client-go/util/retry"
 )
 
@@ -33,18 +30,21 @@ type RunningPodSpec struct {
 var kubeConfig *rest.Config
 var kubeClient kubernetes.Clientset
 var podsClient v1.PodInterface
-var podWatcher PodWatcher
+var eventsClient v1.EventInterface
+var podWatcher *PodWatcher
 var podWatcherErrs <-chan error
 var initOnce sync.Once
 var initErr error
 
+// PodReadyTimeout bounds how long CreateReadyPod waits for a pod to be scheduled, pull its images and become ready
+var PodReadyTimeout = 10 * time.Minute
+
 // Init initializes the Kubernetes API clients and starts the shared pod watcher.
 func Init(ctx context.Context) error {
 	initOnce.Do(func() {
-		kubeconfig := filepath.Join(homedir.HomeDir(), ".kube", "config")
-		kubeConf, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		kubeConf, err := restConfig()
 		if err != nil {
-			initErr = fmt.Errorf("build kubeconfig from %s: %w", kubeconfig, err)
+			initErr = err
 			return
 		}
 
@@ -61,7 +61,8 @@ func Init(ctx context.Context) error {
 		kubeConfig = kubeConf
 		kubeClient = *clientset
 		podsClient = kubeClient.CoreV1().Pods(WorkloadNamespace)
-		podWatcher = NewPodWatcher(podsClient)
+		eventsClient = kubeClient.CoreV1().Events(WorkloadNamespace)
+		podWatcher = NewPodWatcher(podsClient, ManagedPodsSelector)
 		podWatcherErrs = podWatcher.Start(ctx)
 	})
 
@@ -97,6 +98,7 @@ func CreatePod(ctx context.Context, pod *apiv1.Pod) (*apiv1.Pod, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pod after retries: %w", err)
 	}
+	observePod(ctx, PodCreated, result.Name)
 	return result, nil
 }
 
@@ -116,8 +118,27 @@ func CreateReadyPod(ctx context.Context, pod *apiv1.Pod) (RunningPodSpec, error)
 	}
 
 	log.Printf("Waiting for pod %s to be running...", pod.Name)
-	result, err = podWatcher.WaitForPodReady(ctx, result.Name)
+	readyCtx, cancel := context.WithTimeout(ctx, PodReadyTimeout)
+	defer cancel()
+	result, err = podWatcher.WaitForPodReady(readyCtx, result.Name)
 	if err != nil {
+		if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			err = &PodNotReadyError{PodName: pod.Name, Timeout: PodReadyTimeout}
+		}
+		// Remove the pod that never became ready so that a retry can create it again. Diagnostics get their own
+		// deadline so that they cannot use up the time to delete the pod.
+		if dir := diagnosticsDir(ctx); dir != "" {
+			diagnosticsCtx, diagnosticsCancel := context.WithTimeout(context.WithoutCancel(ctx), DiagnosticsTimeout)
+			if diagErr := CollectPodDiagnostics(diagnosticsCtx, pod.Name, dir); diagErr != nil {
+				log.Printf("Error: failed to collect diagnostics of pod %s: %v", pod.Name, diagErr)
+			}
+			diagnosticsCancel()
+		}
+		cleanupCtx, cleanupCancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cleanupCancel()
+		if deleteErr := DeletePod(cleanupCtx, pod.Name); deleteErr != nil {
+			log.Printf("Error: failed to delete pod %s that did not become ready: %v", pod.Name, deleteErr)
+		}
 		return RunningPodSpec{}, err
 	}
 
@@ -169,6 +190,7 @@ func DeletePod(ctx context.Context, podName string) error {
 	if err := waitForPodDeletion(ctx, podName); err != nil {
 		return fmt.Errorf("wait for pod %s deletion: %w", podName, err)
 	}
+	observePod(ctx, PodDeleted, podName)
 	return nil
 }
 
@@ -204,88 +226,39 @@ func PodExists(ctx context.Context, podName string) (bool, error) {
 	return result != nil, nil
 }
 
-// CopyFileFromPod is a function that copies a file from a specified Pod and container to the local filesystem.
-// Parameters:
-//   - podName: A string containing the name of the Pod from which the file should be copied.
-//   - containerName: A string containing the name of the container from which the file should be copied.
-//   - sourcePath: A string containing the path to the file in the Pod that should be copied.
-//   - destPath: A string containing the path to the destination file on the local filesystem.
-//   - keepFile: A boolean value indicating whether the file should be kept in the Pod after copying.
+// ListPods returns the names of the Pods in the workload namespace that match a label selector.
 //
-// Returns:
-//   - An error if there were any issues encountered during the file copy process.
-func CopyFileFromPod(ctx context.Context, podName string, containerName string, sourcePath string, destPath string, keepFile bool) error {
-	// Construct the kubectl cp command
-	cmd := exec.CommandContext(ctx, "kubectl", "cp", "--retries=10", fmt.Sprintf("%s/%s:%s", WorkloadNamespace, podName, sourcePath), destPath, "-c", containerName)
-
-	// Set the environment variables if needed (e.g., KUBECONFIG)
-	// cmd.Env = append(os.Environ(), "KUBECONFIG=/path/to/kubeconfig")
-
-	// Execute the command on the machine running concap
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Error: %v\n", err)
-		log.Printf("Output: %s\n", output)
-		return err
-	}
-
-	// Delete the file from the Pod if keepFile is set to false
-	if !keepFile {
-		// Execute the rm command in the Pod to delete the file
-		_, stde, err := ExecCommandInContainer(ctx, WorkloadNamespace, podName, containerName, "rm", sourcePath)
-		if err != nil {
-			log.Println("Error deleting file from Pod: ", err)
-		}
-		if stde != "" {
-			log.Println("Error deleting file from Pod: ", stde)
-		}
-	}
-
-	log.Printf("File %s downloaded successfully", sourcePath)
-
-	return nil
-}
-
-// CopyFileToPod is a function that copies a file to a specified Pod and container from the local filesystem.
 // Parameters:
-//   - podName: A string containing the name of the Pod to which the file should be copied.
-//   - containerName: A string containing the name of the container to which the file should be copied.
-//   - sourcePath: A string containing the path to the source file on the local filesystem.
-//   - destPath: A string containing the path to the destination file in the Pod.
+//   - labelSelector: A string containing a Kubernetes label selector, such as "concap=target-pod".
 //
 // Returns:
-//   - An error if there were any issues encountered during the file copy process.
-func CopyFileToPod(ctx context.Context, podName string, containerName string, sourcePath string, destPath string) error {
-	// Construct the kubectl cp command
-	cmd := exec.CommandContext(ctx, "kubectl", "cp", "--retries=10", sourcePath, fmt.Sprintf("%s/%s:%s", WorkloadNamespace, podName, destPath), "-c", containerName)
-
-	// Set the environment variables if needed (e.g., KUBECONFIG)
-	// cmd.Env = append(os.Environ(), "KUBECONFIG=/path/to/kubeconfig")
-
-	// Execute the command on the machine running concap
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Error: %v\n", err)
-		log.Printf("Output: %s\n", output)
+//   - The names of the matching Pods, sorted by name.
+//   - An error if there were any issues encountered while listing the Pods.
+func ListPods(ctx context.Context, labelSelector string) ([]string, error) {
+	var result *apiv1.PodList
+	err := retry.OnError(retry.DefaultBackoff, shouldRetry, func() error {
+		var err error
+		result, err = podsClient.List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+		if shouldRetry(err) {
+			log.Printf("Failed to list pods: %v. Retrying...", err)
+		}
 		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods after retries: %w", err)
 	}
 
-	log.Printf("File %s uploaded successfully", sourcePath)
-
-	return nil
+	names := make([]string, 0, len(result.Items))
+	for _, pod := range result.Items {
+		names = append(names, pod.Name)
+	}
+	sort.Strings(names)
+	return names, nil
 }
 
+// waitForPodDeletion blocks until the pod watcher sees that the pod is gone
 func waitForPodDeletion(ctx context.Context, podName string) error {
-	return wait.PollUntilContextCancel(ctx, 250*time.Millisecond, true, func(ctx context.Context) (bool, error) {
-		_, err := podsClient.Get(ctx, podName, metav1.GetOptions{})
-		if apierrors.IsNotFound(err) {
-			return true, nil
-		}
-		if err != nil {
-			return false, err
-		}
-		return false, nil
-	})
+	return podWatcher.WaitForPodDeleted(ctx, podName)
 }
 
 func shouldRetry(err error) bool {
@@ -10,39 +10,25 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	kubefake "k8s.io/client-go/kubernetes/fake"
 	clienttesting "k8s.io/client-go/testing"
 )
 
 func TestDeletePodWaitsForPodToDisappear(t *testing.T) {
 	clientset := kubefake.NewSimpleClientset()
-	originalPodsClient := podsClient
-	podsClient = clientset.CoreV1().Pods(WorkloadNamespace)
-	defer func() {
-		podsClient = originalPodsClient
-	}()
-
-	if _, err := podsClient.Create(context.Background(), &apiv1.Pod{
-		ObjectMeta: metav1.ObjectMeta{Name: "pod-a"},
-	}, metav1.CreateOptions{}); err != nil {
-		t.Fatalf("create test pod: %v", err)
-	}
+	useFakeCluster(t, clientset)
+	createTestPod(t, testPod("pod-a", apiv1.PodRunning, true))
+	waitForCachedPod(t, podWatcher, "pod-a")
 
-	var getCalls int32
-	clientset.PrependReactor("get", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
-		if action.(clienttesting.GetAction).GetName() != "pod-a" {
-			return false, nil, nil
-		}
-
-		call := atomic.AddInt32(&getCalls, 1)
-		if call < 3 {
-			return true, &apiv1.Pod{
-				ObjectMeta: metav1.ObjectMeta{Name: "pod-a"},
-			}, nil
-		}
-
-		return true, nil, apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "pod-a")
+	// Keep the pod while it terminates and remove it later, as the API server does with a grace period
+	var removed atomic.Bool
+	clientset.PrependReactor("delete", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			removed.Store(true)
+			clientset.Tracker().Delete(action.GetResource(), action.GetNamespace(), "pod-a")
+		}()
+		return true, nil, nil
 	})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -51,18 +37,14 @@ func TestDeletePodWaitsForPodToDisappear(t *testing.T) {
 	if err := DeletePod(ctx, "pod-a"); err != nil {
 		t.Fatalf("DeletePod returned error: %v", err)
 	}
-	if got := atomic.LoadInt32(&getCalls); got < 3 {
-		t.Fatalf("DeletePod returned before the pod disappeared, get calls = %d", got)
+	if !removed.Load() {
+		t.Fatal("DeletePod returned before the pod disappeared")
 	}
 }
 
 func TestDeletePodTreatsMissingPodAsDeleted(t *testing.T) {
 	clientset := kubefake.NewSimpleClientset()
-	originalPodsClient := podsClient
-	podsClient = clientset.CoreV1().Pods(WorkloadNamespace)
-	defer func() {
-		podsClient = originalPodsClient
-	}()
+	useFakeCluster(t, clientset)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
@@ -133,17 +115,10 @@ func TestCreatePodDoesNotRetryPermanentErrors(t *testing.T) {
 
 func TestDeletePodRetriesTransientErrors(t *testing.T) {
 	clientset := kubefake.NewSimpleClientset()
-	originalPodsClient := podsClient
-	podsClient = clientset.CoreV1().Pods(WorkloadNamespace)
-	defer func() {
-		podsClient = originalPodsClient
-	}()
+	useFakeCluster(t, clientset)
 
-	if _, err := podsClient.Create(context.Background(), &apiv1.Pod{
-		ObjectMeta: metav1.ObjectMeta{Name: "pod-a"},
-	}, metav1.CreateOptions{}); err != nil {
-		t.Fatalf("create test pod: %v", err)
-	}
+	createTestPod(t, testPod("pod-a", apiv1.PodRunning, true))
+	waitForCachedPod(t, podWatcher, "pod-a")
 
 	var deleteCalls int32
 	clientset.PrependReactor("delete", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
@@ -164,3 +139,46 @@ func TestDeletePodRetriesTransientErrors(t *testing.T) {
 		t.Fatalf("DeletePod attempts = %d, want 2", got)
 	}
 }
+
+func TestPodObserverSeesCreatedAndDeletedPods(t *testing.T) {
+	clientset := kubefake.NewSimpleClientset()
+	useFakeCluster(t, clientset)
+
+	var events []string
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ctx = WithPodObserver(ctx, func(event PodEvent, podName string) {
+		events = append(events, string(event)+" "+podName)
+	})
+
+	if _, err := CreatePod(ctx, &apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-a"}}); err != nil {
+		t.Fatalf("CreatePod returned error: %v", err)
+	}
+	if err := DeletePod(ctx, "pod-a"); err != nil {
+		t.Fatalf("DeletePod returned error: %v", err)
+	}
+	if len(events) != 2 || events[0] != "created pod-a" || events[1] != "deleted pod-a" {
+		t.Fatalf("observed events = %v, want the creation and deletion of pod-a", events)
+	}
+}
+
+func TestListPodsFiltersByLabelSelector(t *testing.T) {
+	clientset := kubefake.NewSimpleClientset(
+		&apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "scan-T", Namespace: WorkloadNamespace, Labels: map[string]string{"concap": "target-pod"}}},
+		&apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "scan-A", Namespace: WorkloadNamespace, Labels: map[string]string{"concap": "attacker-pod"}}},
+		&apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cicflowmeter", Namespace: WorkloadNamespace, Labels: map[string]string{"concap": "processing-pod"}}},
+	)
+	originalPodsClient := podsClient
+	podsClient = clientset.CoreV1().Pods(WorkloadNamespace)
+	defer func() {
+		podsClient = originalPodsClient
+	}()
+
+	names, err := ListPods(context.Background(), "concap in (attacker-pod,target-pod)")
+	if err != nil {
+		t.Fatalf("ListPods returned error: %v", err)
+	}
+	if len(names) != 2 || names[0] != "scan-A" || names[1] != "scan-T" {
+		t.Fatalf("ListPods = %v, want the scenario pods sorted by name", names)
+	}
+}
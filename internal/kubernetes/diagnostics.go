@@ -0,0 +1,167 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"sigs.k8s.io/yaml"
+)
+
+// DiagnosticsDirName is the directory in the output of a scenario holding the state of its pods
+const DiagnosticsDirName = "k8s"
+
+// DiagnosticsTimeout bounds the time saving the diagnostics of the pods of a scenario may take, so that slow log
+// streams do not delay the deletion of the pods
+var DiagnosticsTimeout = 30 * time.Second
+
+type diagnosticsDirKey struct{}
+
+// WithDiagnosticsDir returns a context that saves the diagnostics of pods that fail to become ready to dir
+// before they are deleted
+func WithDiagnosticsDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, diagnosticsDirKey{}, dir)
+}
+
+// diagnosticsDir returns the diagnostics directory of the context, or an empty string if it has none
+func diagnosticsDir(ctx context.Context) string {
+	dir, _ := ctx.Value(diagnosticsDirKey{}).(string)
+	return dir
+}
+
+// CollectPodDiagnostics saves the state of a pod to <dir>/<pod>/: its status as pod.yaml, its events as
+// events.txt and the logs of every init container and container as <container>.log. The logs of the previous
+// instance of a restarted container are saved as <container>.previous.log. It saves as much as it can and
+// returns the errors it encountered.
+func CollectPodDiagnostics(ctx context.Context, podName, dir string) error {
+	pod, err := podsClient.Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get pod %s: %w", podName, err)
+	}
+	podDir := filepath.Join(dir, podName)
+	if err := os.MkdirAll(podDir, 0755); err != nil {
+		return fmt.Errorf("create diagnostics directory: %w", err)
+	}
+
+	var errs []error
+	if err := writePodYAML(pod, filepath.Join(podDir, "pod.yaml")); err != nil {
+		errs = append(errs, err)
+	}
+	if err := writePodEvents(ctx, pod, filepath.Join(podDir, "events.txt")); err != nil {
+		errs = append(errs, err)
+	}
+	statuses := append(append([]apiv1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		// A container that never started has no logs
+		if status.State.Waiting != nil && status.RestartCount == 0 {
+			continue
+		}
+		if err := writeContainerLog(ctx, podName, status.Name, false, filepath.Join(podDir, status.Name+".log")); err != nil {
+			errs = append(errs, err)
+		}
+		if status.RestartCount > 0 {
+			if err := writeContainerLog(ctx, podName, status.Name, true, filepath.Join(podDir, status.Name+".previous.log")); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writePodYAML writes a pod, including its final status, as a manifest
+func writePodYAML(pod *apiv1.Pod, path string) error {
+	pod = pod.DeepCopy()
+	pod.APIVersion, pod.Kind = "v1", "Pod"
+	pod.ManagedFields = nil
+	b, err := yaml.Marshal(pod)
+	if err != nil {
+		return fmt.Errorf("marshal pod %s: %w", pod.Name, err)
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("write status of pod %s: %w", pod.Name, err)
+	}
+	return nil
+}
+
+// writePodEvents writes the events of a pod as a table, oldest first
+func writePodEvents(ctx context.Context, pod *apiv1.Pod, path string) error {
+	list, err := eventsClient.List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.name", pod.Name).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("list events of pod %s: %w", pod.Name, err)
+	}
+	var events []apiv1.Event
+	for _, event := range list.Items {
+		if event.InvolvedObject.Name == pod.Name && (event.InvolvedObject.UID == "" || event.InvolvedObject.UID == pod.UID) {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(events[i]).Before(eventTime(events[j]))
+	})
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+	for _, event := range events {
+		object := event.InvolvedObject.Name
+		if event.InvolvedObject.FieldPath != "" {
+			object += " " + event.InvolvedObject.FieldPath
+		}
+		count := event.Count
+		if count == 0 {
+			count = 1
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", eventTime(event).UTC().Format(time.RFC3339),
+			event.Type, event.Reason, object, count, strings.TrimSpace(event.Message))
+	}
+	w.Flush()
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("write events of pod %s: %w", pod.Name, err)
+	}
+	return nil
+}
+
+// eventTime returns the last time an event occurred
+func eventTime(event apiv1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.FirstTimestamp.Time
+	}
+}
+
+// writeContainerLog streams the log of a container, or of its previous instance, to a file
+func writeContainerLog(ctx context.Context, podName, containerName string, previous bool, path string) error {
+	stream, err := podsClient.GetLogs(podName, &apiv1.PodLogOptions{Container: containerName, Previous: previous}).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("get logs of container %s of pod %s: %w", containerName, podName, err)
+	}
+	defer stream.Close()
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create log of container %s of pod %s: %w", containerName, podName, err)
+	}
+	_, err = io.Copy(file, stream)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write logs of container %s of pod %s: %w", containerName, podName, err)
+	}
+	return nil
+}
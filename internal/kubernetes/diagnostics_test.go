@@ -0,0 +1,108 @@
+package kubernetes
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func TestCollectPodDiagnostics(t *testing.T) {
+	clientset := kubefake.NewSimpleClientset()
+	originalPodsClient, originalEventsClient := podsClient, eventsClient
+	podsClient = clientset.CoreV1().Pods(WorkloadNamespace)
+	eventsClient = clientset.CoreV1().Events(WorkloadNamespace)
+	defer func() {
+		podsClient, eventsClient = originalPodsClient, originalEventsClient
+	}()
+
+	ctx := context.Background()
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "scenario-a-T-0", UID: "uid-a"},
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodRunning,
+			InitContainerStatuses: []apiv1.ContainerStatus{
+				{Name: "init-tc", State: apiv1.ContainerState{Terminated: &apiv1.ContainerStateTerminated{ExitCode: 0}}},
+			},
+			ContainerStatuses: []apiv1.ContainerStatus{
+				{Name: "target", RestartCount: 1, State: apiv1.ContainerState{Running: &apiv1.ContainerStateRunning{}}},
+				{Name: "tcpdump", State: apiv1.ContainerState{Waiting: &apiv1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+			},
+		},
+	}
+	if _, err := podsClient.Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create test pod: %v", err)
+	}
+	for _, event := range []apiv1.Event{
+		{
+			ObjectMeta:     metav1.ObjectMeta{Name: "event-b"},
+			InvolvedObject: apiv1.ObjectReference{Name: "scenario-a-T-0", UID: "uid-a", FieldPath: "spec.containers{tcpdump}"},
+			Type:           apiv1.EventTypeWarning,
+			Reason:         "Failed",
+			Message:        "Back-off pulling image",
+			LastTimestamp:  metav1.Unix(200, 0),
+		},
+		{
+			ObjectMeta:     metav1.ObjectMeta{Name: "event-a"},
+			InvolvedObject: apiv1.ObjectReference{Name: "scenario-a-T-0", UID: "uid-a"},
+			Type:           apiv1.EventTypeNormal,
+			Reason:         "Scheduled",
+			Message:        "Successfully assigned concap/scenario-a-T-0 to nuccore",
+			LastTimestamp:  metav1.Unix(100, 0),
+		},
+		{
+			ObjectMeta:     metav1.ObjectMeta{Name: "event-other"},
+			InvolvedObject: apiv1.ObjectReference{Name: "scenario-a-A"},
+			Reason:         "Scheduled",
+		},
+	} {
+		if _, err := eventsClient.Create(ctx, &event, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create test event: %v", err)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := CollectPodDiagnostics(ctx, "scenario-a-T-0", dir); err != nil {
+		t.Fatalf("CollectPodDiagnostics returned error: %v", err)
+	}
+
+	podDir := filepath.Join(dir, "scenario-a-T-0")
+	b, err := os.ReadFile(filepath.Join(podDir, "pod.yaml"))
+	if err != nil {
+		t.Fatalf("read pod.yaml: %v", err)
+	}
+	var saved apiv1.Pod
+	if err := yaml.Unmarshal(b, &saved); err != nil {
+		t.Fatalf("parse pod.yaml: %v", err)
+	}
+	if saved.Kind != "Pod" || len(saved.Status.ContainerStatuses) != 2 {
+		t.Fatalf("pod.yaml has kind %q and %d container statuses, want Pod and 2", saved.Kind, len(saved.Status.ContainerStatuses))
+	}
+
+	b, err = os.ReadFile(filepath.Join(podDir, "events.txt"))
+	if err != nil {
+		t.Fatalf("read events.txt: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "Scheduled") || !strings.Contains(lines[2], "Back-off pulling image") {
+		t.Fatalf("events.txt =\n%s\nwant a header and the two events of the pod, oldest first", b)
+	}
+
+	for name, want := range map[string]bool{
+		"init-tc.log":         true,
+		"target.log":          true,
+		"target.previous.log": true,
+		"tcpdump.log":         false,
+	} {
+		_, err := os.Stat(filepath.Join(podDir, name))
+		if got := err == nil; got != want {
+			t.Errorf("%s exists = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	kubeexec "k8s.io/client-go/util/exec"
+)
+
+// CopyError is returned when copying a file between the machine running concap and a pod fails
+type CopyError struct {
+	// Direction is either "download" or "upload"
+	Direction string
+	PodName   string
+	Path      string
+	// Output is the standard error of the command in the container
+	Output string
+	Err    error
+}
+
+func (e *CopyError) Error() string {
+	preposition := "from"
+	if e.Direction == "upload" {
+		preposition = "to"
+	}
+	msg := fmt.Sprintf("%s %s %s pod %s: %v", e.Direction, e.Path, preposition, e.PodName, e.Err)
+	if output := strings.TrimSpace(e.Output); output != "" {
+		msg += ": " + output
+	}
+	return msg
+}
+
+func (e *CopyError) Unwrap() error {
+	return e.Err
+}
+
+// ChecksumError is returned when a copied file differs from the file it was copied from
+type ChecksumError struct {
+	Path string
+	Want string
+	Got  string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s: want sha256 %s, got %s", e.Path, e.Want, e.Got)
+}
+
+// PodNotReadyError is returned when a pod does not become ready within PodReadyTimeout
+type PodNotReadyError struct {
+	PodName string
+	Timeout time.Duration
+}
+
+func (e *PodNotReadyError) Error() string {
+	return fmt.Sprintf("pod %s not ready after %s", e.PodName, e.Timeout)
+}
+
+// PodStartupError is returned as soon as a pod reaches a state it will not become ready from, such as an image
+// that cannot be pulled, a crashing container or no node to schedule it on
+type PodStartupError struct {
+	PodName string
+	// Container is the failing container, empty when the pod as a whole failed
+	Container string
+	// Reason is the Kubernetes reason, e.g. ImagePullBackOff, CrashLoopBackOff or Unschedulable
+	Reason  string
+	Message string
+}
+
+func (e *PodStartupError) Error() string {
+	msg := fmt.Sprintf("pod %s cannot start", e.PodName)
+	if e.Container != "" {
+		msg += fmt.Sprintf(": container %s", e.Container)
+	}
+	msg += ": " + e.Reason
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// transientStartupReasons are the startup failures caused by the cluster rather than by the pod definition
+var transientStartupReasons = map[string]bool{
+	"Unschedulable":    true,
+	"ErrImagePull":     true,
+	"ImagePullBackOff": true,
+}
+
+// streamResetMessages are fragments of the errors returned when an exec stream or its connection to the API server breaks
+var streamResetMessages = []string{
+	"stream reset",
+	"connection reset by peer",
+	"broken pipe",
+	"unexpected EOF",
+	"http2: client connection lost",
+	"error dialing backend",
+	"use of closed network connection",
+}
+
+// IsTransient reports whether err is caused by the cluster rather than by the workload: a pod that could not
+// be scheduled or pull its image, a broken exec stream or a failed file copy. A command that ran and exited with a
+// non-zero status is never transient.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	// A failed copy is transient even when the tar command in the container exited with an error
+	var copyErr *CopyError
+	if errors.As(err, &copyErr) {
+		return true
+	}
+	var exitErr kubeexec.ExitError
+	if errors.As(err, &exitErr) {
+		return false
+	}
+	var notReadyErr *PodNotReadyError
+	if errors.As(err, &notReadyErr) {
+		return true
+	}
+	var startupErr *PodStartupError
+	if errors.As(err, &startupErr) {
+		return transientStartupReasons[startupErr.Reason]
+	}
+	msg := err.Error()
+	for _, fragment := range streamResetMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	kubeexec "k8s.io/client-go/util/exec"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"copy", fmt.Errorf("download results: %w", &CopyError{Direction: "download", PodName: "target", Path: "/dump.pcap", Err: errors.New("exit status 1")}), true},
+		{"copy exit", &CopyError{Direction: "download", PodName: "target", Path: "/dump.pcap", Err: kubeexec.CodeExitError{Err: errors.New("command terminated with exit code 2"), Code: 2}}, true},
+		{"unschedulable", &PodStartupError{PodName: "target", Reason: "Unschedulable"}, true},
+		{"image pull backoff", &PodStartupError{PodName: "target", Container: "target", Reason: "ImagePullBackOff"}, true},
+		{"crash loop", &PodStartupError{PodName: "target", Container: "target", Reason: "CrashLoopBackOff"}, false},
+		{"pod not ready", &PodNotReadyError{PodName: "target", Timeout: time.Minute}, true},
+		{"stream reset", errors.New("error reading from error stream: stream error: stream ID 3; INTERNAL_ERROR; received from peer: stream reset"), true},
+		{"connection reset", errors.New("read tcp 10.0.0.1:443: read: connection reset by peer"), true},
+		{"attack timeout", fmt.Errorf("execute attack: %w", kubeexec.CodeExitError{Err: errors.New("command terminated with exit code 124"), Code: 124}), false},
+		{"attack failure", kubeexec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}, false},
+		{"cancelled", context.Canceled, false},
+		{"invalid scenario", errors.New("unknown scenario type"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Fatalf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
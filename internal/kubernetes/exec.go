@@ -43,23 +43,17 @@ func ExecWithOptions(options ExecOptions) (string, string, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	req := kubeClient.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(options.PodName).
-		Namespace(options.Namespace).
-		SubResource("exec").
-		Param("container", options.ContainerName)
-	req.VersionedParams(&apiv1.PodExecOptions{
+	url := execURL(options.Namespace, options.PodName, &apiv1.PodExecOptions{
 		Container: options.ContainerName,
 		Command:   options.Command,
 		Stdin:     options.Stdin != nil,
 		Stdout:    options.CaptureStdout,
 		Stderr:    options.CaptureStderr,
 		TTY:       tty,
-	}, scheme.ParameterCodec)
+	})
 
 	var stdout, stderr bytes.Buffer
-	err := execute(ctx, "POST", req.URL(), kubeConfig, options.Stdin, &stdout, &stderr, tty)
+	err := execute(ctx, "POST", url, kubeConfig, options.Stdin, &stdout, &stderr, tty)
 
 	if options.PreserveWhitespace {
 		return stdout.String(), stderr.String(), err
@@ -68,6 +62,31 @@ func ExecWithOptions(options ExecOptions) (string, string, error) {
 	return strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()), err
 }
 
+// ExecStream executes a command in a container and streams its standard input, output and error without
+// buffering them, which suits commands that transfer large files. Stdin may be nil.
+func ExecStream(ctx context.Context, namespace, podName, containerName string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	url := execURL(namespace, podName, &apiv1.PodExecOptions{
+		Container: containerName,
+		Command:   command,
+		Stdin:     stdin != nil,
+		Stdout:    true,
+		Stderr:    true,
+	})
+	return execute(ctx, "POST", url, kubeConfig, stdin, stdout, stderr, false)
+}
+
+// execURL returns the URL of the exec subresource of a pod for the given options
+func execURL(namespace, podName string, options *apiv1.PodExecOptions) *url.URL {
+	req := kubeClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec").
+		Param("container", options.Container)
+	req.VersionedParams(options, scheme.ParameterCodec)
+	return req.URL()
+}
+
 // ExecCommandInContainerWithFullOutput is a function that executes a command in a specified container and returns the stdout,
 // stderr, and error using the Kubernetes client. It uses the ExecWithOptions function to execute the command at the API level.
 // The function takes the namespace, pod name, container name, and command as input parameters.
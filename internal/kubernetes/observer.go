@@ -0,0 +1,28 @@
+package kubernetes
+
+import "context"
+
+// PodEvent is a change to a pod made through this package
+type PodEvent string
+
+const (
+	PodCreated PodEvent = "created"
+	PodDeleted PodEvent = "deleted"
+)
+
+// PodObserver is called with the name of every pod created or deleted with the context it is attached to
+type PodObserver func(event PodEvent, podName string)
+
+type podObserverKey struct{}
+
+// WithPodObserver returns a context that reports the pods created and deleted with it to observer
+func WithPodObserver(ctx context.Context, observer PodObserver) context.Context {
+	return context.WithValue(ctx, podObserverKey{}, observer)
+}
+
+// observePod reports a pod event to the observer of the context, if any
+func observePod(ctx context.Context, event PodEvent, podName string) {
+	if observer, ok := ctx.Value(podObserverKey{}).(PodObserver); ok {
+		observer(event, podName)
+	}
+}
@@ -9,15 +9,46 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
-const (
+// Runtime settings, set them before calling Init
+var (
 	// WorkloadNamespace contains every pod managed by Concap.
 	WorkloadNamespace = "concap"
-	// ImagePullSecretName is the preconfigured GHCR credential used by Concap pods.
+	// ImagePullSecretName is the preconfigured registry credential used by Concap pods.
 	ImagePullSecretName = "ghcr-creds"
+	// RegistryHost is the registry the image pull secret must hold credentials for, no credentials are checked when empty.
+	RegistryHost = "ghcr.io"
+	// Kubeconfig is the kubeconfig file to connect with. When empty, the KUBECONFIG environment variable or
+	// ~/.kube/config is used, and the service account of the pod when concap runs in the cluster without either.
+	Kubeconfig string
+	// KubeContext is the kubeconfig context to connect with, the current context when empty.
+	KubeContext string
+	// InCluster connects with the service account of the pod concap runs in, ignoring any kubeconfig.
+	InCluster bool
 )
 
+// restConfig returns the client configuration of the cluster selected by the runtime settings
+func restConfig() (*rest.Config, error) {
+	if InCluster {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("load in-cluster config: %w", err)
+		}
+		return config, nil
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: KubeContext}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
+	}
+	return config, nil
+}
+
 func validateRuntimePrerequisites(ctx context.Context, client kubernetes.Interface) error {
 	if _, err := client.CoreV1().Namespaces().Get(ctx, WorkloadNamespace, metav1.GetOptions{}); err != nil {
 		if apierrors.IsNotFound(err) {
@@ -51,12 +82,15 @@ func validateRuntimePrerequisites(ctx context.Context, client kubernetes.Interfa
 	if err := json.Unmarshal(dockerConfigJSON, &dockerConfig); err != nil {
 		return fmt.Errorf("image pull secret %s/%s contains invalid Docker config JSON: %w", WorkloadNamespace, ImagePullSecretName, err)
 	}
-	credentials, ok := dockerConfig.Auths["ghcr.io"]
+	if RegistryHost == "" {
+		return nil
+	}
+	credentials, ok := dockerConfig.Auths[RegistryHost]
 	if !ok {
-		return fmt.Errorf("image pull secret %s/%s has no ghcr.io credentials", WorkloadNamespace, ImagePullSecretName)
+		return fmt.Errorf("image pull secret %s/%s has no %s credentials", WorkloadNamespace, ImagePullSecretName, RegistryHost)
 	}
 	if credentials.Auth == "" && credentials.IdentityToken == "" && (credentials.Username == "" || credentials.Password == "") {
-		return fmt.Errorf("image pull secret %s/%s has empty ghcr.io credentials", WorkloadNamespace, ImagePullSecretName)
+		return fmt.Errorf("image pull secret %s/%s has empty %s credentials", WorkloadNamespace, ImagePullSecretName, RegistryHost)
 	}
 
 	return nil
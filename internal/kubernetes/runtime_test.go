@@ -104,3 +104,38 @@ func TestValidateRuntimePrerequisites(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateRuntimePrerequisitesUsesConfiguredRegistry(t *testing.T) {
+	originalNamespace, originalSecret, originalRegistry := WorkloadNamespace, ImagePullSecretName, RegistryHost
+	defer func() {
+		WorkloadNamespace, ImagePullSecretName, RegistryHost = originalNamespace, originalSecret, originalRegistry
+	}()
+	WorkloadNamespace, ImagePullSecretName = "team-a", "registry-creds"
+	objects := []runtime.Object{
+		&apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		&apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry-creds", Namespace: "team-a"},
+			Type:       apiv1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{apiv1.DockerConfigJsonKey: []byte(`{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`)},
+		},
+	}
+
+	tests := []struct {
+		registry  string
+		wantError string
+	}{
+		{registry: "registry.example.com"},
+		{registry: ""},
+		{registry: "ghcr.io", wantError: "image pull secret team-a/registry-creds has no ghcr.io credentials"},
+	}
+	for _, tt := range tests {
+		RegistryHost = tt.registry
+		err := validateRuntimePrerequisites(context.Background(), kubefake.NewSimpleClientset(objects...))
+		if tt.wantError == "" && err != nil {
+			t.Fatalf("registry %q: validateRuntimePrerequisites returned error: %v", tt.registry, err)
+		}
+		if tt.wantError != "" && (err == nil || !strings.Contains(err.Error(), tt.wantError)) {
+			t.Fatalf("registry %q: validateRuntimePrerequisites error = %v, want substring %q", tt.registry, err, tt.wantError)
+		}
+	}
+}
@@ -0,0 +1,539 @@
+package kubernetes
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idlab-discover/concap/internal/metrics"
+	kubeexec "k8s.io/client-go/util/exec"
+)
+
+// ProgressInterval is how often a running file transfer logs its progress
+var ProgressInterval = 10 * time.Second
+
+// streamExec runs a command in a container of a pod in the workload namespace, tests replace it
+var streamExec = func(ctx context.Context, podName, containerName string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return ExecStream(ctx, WorkloadNamespace, podName, containerName, command, stdin, stdout, stderr)
+}
+
+// errTransferStopped stops the side of a transfer that is still running once the other side is done
+var errTransferStopped = errors.New("transfer stopped")
+
+// checksumScript prints the SHA-256 checksum of every file below the paths passed after the directory it
+// changes to. It exits with 127 when the container has no sha256sum.
+const checksumScript = `command -v sha256sum >/dev/null 2>&1 || exit 127; cd "$1" && shift && find "$@" -type f -exec sha256sum {} +`
+
+// sizeScript prints the size and path of every file below the paths passed after the directory it changes to. It
+// checks transfers with containers that have no sha256sum and exits with 127 when the container has no wc.
+const sizeScript = `command -v wc >/dev/null 2>&1 || exit 127; cd "$1" && shift && find "$@" -type f -exec sh -c 'for f do printf "%s %s\n" "$(wc -c <"$f")" "$f"; done' sh {} +`
+
+// CopyFileFromPod is a function that copies a file from a specified Pod and container to the local filesystem.
+// The file is streamed as a tar archive over the exec API and verified against its SHA-256 checksum in the container.
+// Parameters:
+//   - podName: A string containing the name of the Pod from which the file should be copied.
+//   - containerName: A string containing the name of the container from which the file should be copied.
+//   - sourcePath: A string containing the path to the file in the Pod that should be copied.
+//   - destPath: A string containing the path to the destination file on the local filesystem.
+//   - keepFile: A boolean value indicating whether the file should be kept in the Pod after copying.
+//
+// Returns:
+//   - An error if there were any issues encountered during the file copy process.
+func CopyFileFromPod(ctx context.Context, podName string, containerName string, sourcePath string, destPath string, keepFile bool) error {
+	base := path.Base(sourcePath)
+	err := download(ctx, podName, containerName, sourcePath, func(name string) (string, error) {
+		if name != base {
+			return "", fmt.Errorf("unexpected entry %s in archive", name)
+		}
+		return destPath, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Delete the file from the Pod if keepFile is set to false
+	if !keepFile {
+		var stderr bytes.Buffer
+		if err := streamExec(ctx, podName, containerName, []string{"rm", sourcePath}, nil, io.Discard, &stderr); err != nil {
+			log.Printf("Error deleting file %s from pod %s: %v %s", sourcePath, podName, err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	log.Printf("File %s downloaded successfully", sourcePath)
+	return nil
+}
+
+// CopyFromPod is a function that copies files and directories from a specified Pod and container to a local directory.
+// Every source ends up in the destination directory under its base name, directories with all files below them.
+// Parameters:
+//   - podName: A string containing the name of the Pod from which the files should be copied.
+//   - containerName: A string containing the name of the container from which the files should be copied.
+//   - sourcePaths: The paths to the files and directories in the Pod that should be copied.
+//   - destDir: A string containing the path to the destination directory on the local filesystem.
+//
+// Returns:
+//   - An error if there were any issues encountered during the copy process.
+func CopyFromPod(ctx context.Context, podName string, containerName string, sourcePaths []string, destDir string) error {
+	for _, sourcePath := range sourcePaths {
+		err := download(ctx, podName, containerName, sourcePath, func(name string) (string, error) {
+			return localPath(destDir, name)
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("%s downloaded successfully", sourcePath)
+	}
+	return nil
+}
+
+// CopyFileToPod is a function that copies a file to a specified Pod and container from the local filesystem.
+// The file is streamed as a tar archive over the exec API and verified against its SHA-256 checksum in the container.
+// Parameters:
+//   - podName: A string containing the name of the Pod to which the file should be copied.
+//   - containerName: A string containing the name of the container to which the file should be copied.
+//   - sourcePath: A string containing the path to the source file on the local filesystem.
+//   - destPath: A string containing the path to the destination file in the Pod.
+//
+// Returns:
+//   - An error if there were any issues encountered during the file copy process.
+func CopyFileToPod(ctx context.Context, podName string, containerName string, sourcePath string, destPath string) error {
+	sources := []uploadSource{{localPath: sourcePath, name: path.Base(destPath)}}
+	if err := upload(ctx, podName, containerName, sources, path.Dir(destPath), destPath); err != nil {
+		return err
+	}
+	log.Printf("File %s uploaded successfully", sourcePath)
+	return nil
+}
+
+// CopyToPod is a function that copies local files and directories to a directory in a specified Pod and container.
+// Every source ends up in the destination directory under its base name, directories with all files below them.
+// Parameters:
+//   - podName: A string containing the name of the Pod to which the files should be copied.
+//   - containerName: A string containing the name of the container to which the files should be copied.
+//   - sourcePaths: The paths to the files and directories on the local filesystem.
+//   - destDir: A string containing the path to the destination directory in the Pod, created if needed.
+//
+// Returns:
+//   - An error if there were any issues encountered during the copy process.
+func CopyToPod(ctx context.Context, podName string, containerName string, sourcePaths []string, destDir string) error {
+	sources := make([]uploadSource, len(sourcePaths))
+	for i, sourcePath := range sourcePaths {
+		sources[i] = uploadSource{localPath: sourcePath, name: filepath.Base(sourcePath)}
+	}
+	if err := upload(ctx, podName, containerName, sources, destDir, destDir); err != nil {
+		return err
+	}
+	log.Printf("%d files uploaded successfully to %s", len(sourcePaths), destDir)
+	return nil
+}
+
+// download streams the tar archive of a file or directory in a container to the local paths that target returns
+// for its entries. Every file is written next to its destination first and only moved in place once its size
+// and checksum match the file in the container.
+func download(ctx context.Context, podName, containerName, sourcePath string, target func(name string) (string, error)) error {
+	copyErr := func(err error, output string) error {
+		metrics.FileCopyFailures.Inc("download")
+		return &CopyError{Direction: "download", PodName: podName, Path: sourcePath, Output: output, Err: err}
+	}
+	dir, base := path.Split(path.Clean(sourcePath))
+	if dir == "" {
+		dir = "."
+	}
+	checksums, err := podChecksums(ctx, podName, containerName, dir, []string{base})
+	if err != nil {
+		return copyErr(err, "")
+	}
+	var sizes map[string]int64
+	if checksums == nil {
+		metrics.UnverifiedCopies.Inc("download")
+		if sizes, err = podSizes(ctx, podName, containerName, dir, []string{base}); err != nil {
+			return copyErr(err, "")
+		}
+	}
+
+	reader, writer := io.Pipe()
+	var stderr bytes.Buffer
+	execDone := make(chan error, 1)
+	go func() {
+		err := streamExec(ctx, podName, containerName, []string{"tar", "cf", "-", "-C", dir, base}, nil, writer, &stderr)
+		writer.CloseWithError(err)
+		execDone <- err
+	}()
+
+	progress := &transferProgress{action: "Downloading", preposition: "from", direction: "download", podName: podName}
+	received, extractErr := extractArchive(reader, target, checksums, sizes, progress)
+	if extractErr == nil {
+		// Consume the padding after the end of the archive so that the command can exit
+		_, extractErr = io.Copy(io.Discard, reader)
+	}
+	// Stop the command if the archive could not be read
+	reader.CloseWithError(errTransferStopped)
+	execErr := <-execDone
+
+	// A failing command also fails the extraction, which then wraps its error
+	switch {
+	case extractErr != nil:
+		return copyErr(extractErr, stderr.String())
+	case execErr != nil:
+		return copyErr(execErr, stderr.String())
+	}
+	for name := range checksums {
+		if !received[name] {
+			return copyErr(fmt.Errorf("file %s missing from archive", name), stderr.String())
+		}
+	}
+	for name := range sizes {
+		if !received[name] {
+			return copyErr(fmt.Errorf("file %s missing from archive", name), stderr.String())
+		}
+	}
+	return nil
+}
+
+// uploadSource is a local file or directory and the name it gets in the destination directory
+type uploadSource struct {
+	localPath string
+	name      string
+}
+
+// upload streams local files and directories as a tar archive to a directory in a container and verifies the
+// checksums of the extracted files. reportPath names the upload in errors.
+func upload(ctx context.Context, podName, containerName string, sources []uploadSource, destDir, reportPath string) error {
+	copyErr := func(err error, output string) error {
+		metrics.FileCopyFailures.Inc("upload")
+		return &CopyError{Direction: "upload", PodName: podName, Path: reportPath, Output: output, Err: err}
+	}
+
+	reader, writer := io.Pipe()
+	checksums := make(map[string]string)
+	sizes := make(map[string]int64)
+	writeDone := make(chan error, 1)
+	go func() {
+		progress := &transferProgress{action: "Uploading", preposition: "to", direction: "upload", podName: podName}
+		err := writeArchive(writer, sources, checksums, sizes, progress)
+		writer.CloseWithError(err)
+		writeDone <- err
+	}()
+
+	var stderr bytes.Buffer
+	execErr := streamExec(ctx, podName, containerName, []string{"sh", "-c", `mkdir -p "$1" && tar xf - -C "$1"`, "sh", destDir}, reader, io.Discard, &stderr)
+	// Unblock the archive writer if the command stopped reading
+	reader.CloseWithError(errTransferStopped)
+	writeErr := <-writeDone
+	switch {
+	case writeErr != nil && !errors.Is(writeErr, errTransferStopped):
+		return copyErr(writeErr, stderr.String())
+	case execErr != nil:
+		return copyErr(execErr, stderr.String())
+	}
+
+	names := make([]string, 0, len(checksums))
+	for name := range checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return nil
+	}
+	remote, err := podChecksums(ctx, podName, containerName, destDir, names)
+	if err != nil {
+		return copyErr(err, "")
+	}
+	if remote != nil {
+		for _, name := range names {
+			if remote[name] != checksums[name] {
+				return copyErr(&ChecksumError{Path: name, Want: checksums[name], Got: remote[name]}, "")
+			}
+		}
+		return nil
+	}
+
+	// Without sha256sum, at least check that every file arrived with its size from the archive
+	metrics.UnverifiedCopies.Inc("upload")
+	remoteSizes, err := podSizes(ctx, podName, containerName, destDir, names)
+	if err != nil {
+		return copyErr(err, "")
+	}
+	if remoteSizes == nil {
+		return nil
+	}
+	for _, name := range names {
+		if err := checkSize(name, sizes[name], remoteSizes); err != nil {
+			return copyErr(err, "")
+		}
+	}
+	return nil
+}
+
+// podChecksums returns the SHA-256 checksums of the files below the paths relative to dir in a container, keyed by
+// their path relative to dir. It returns no checksums and no error when the container cannot compute them.
+func podChecksums(ctx context.Context, podName, containerName, dir string, paths []string) (map[string]string, error) {
+	var stdout, stderr bytes.Buffer
+	command := append([]string{"sh", "-c", checksumScript, "sh", dir}, paths...)
+	err := streamExec(ctx, podName, containerName, command, nil, &stdout, &stderr)
+	var exitErr kubeexec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == 127 {
+		log.Printf("Warning: container %s of pod %s has no sha256sum, only the sizes of transferred files are verified", containerName, podName)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("compute checksums: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	checksums := make(map[string]string)
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		// sha256sum prints the checksum, a space and a space or * before the path
+		if len(line) < 66 {
+			continue
+		}
+		checksums[path.Clean(strings.TrimLeft(line[64:], " *"))] = line[:64]
+	}
+	return checksums, nil
+}
+
+// podSizes returns the sizes of the files below the paths relative to dir in a container, keyed by their path
+// relative to dir. It returns no sizes and no error when the container cannot compute them.
+func podSizes(ctx context.Context, podName, containerName, dir string, paths []string) (map[string]int64, error) {
+	var stdout, stderr bytes.Buffer
+	command := append([]string{"sh", "-c", sizeScript, "sh", dir}, paths...)
+	err := streamExec(ctx, podName, containerName, command, nil, &stdout, &stderr)
+	var exitErr kubeexec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == 127 {
+		log.Printf("Warning: container %s of pod %s has no wc, transferred files are not verified", containerName, podName)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("compute sizes: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	sizes := make(map[string]int64)
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		// Some wc implementations pad the size with spaces
+		size, name, ok := strings.Cut(strings.TrimLeft(line, " "), " ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("compute sizes: unexpected line %q", line)
+		}
+		sizes[path.Clean(name)] = n
+	}
+	return sizes, nil
+}
+
+// checkSize reports an error when the file is missing from sizes or has a different size
+func checkSize(name string, size int64, sizes map[string]int64) error {
+	got, ok := sizes[name]
+	if !ok {
+		return fmt.Errorf("file %s not found in container", name)
+	}
+	if got != size {
+		return fmt.Errorf("file %s is %d bytes in the container, want %d", name, got, size)
+	}
+	return nil
+}
+
+// extractArchive writes the files and directories in a tar archive to the local paths target returns for them.
+// Files are verified against checksums, or against sizes when the container has no checksums, unless both are nil.
+// It returns the names of the files written.
+func extractArchive(r io.Reader, target func(name string) (string, error), checksums map[string]string, sizes map[string]int64, progress *transferProgress) (map[string]bool, error) {
+	received := make(map[string]bool)
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return received, nil
+		}
+		if err != nil {
+			return received, fmt.Errorf("read archive: %w", err)
+		}
+
+		name := path.Clean(header.Name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			dest, err := target(name)
+			if err != nil {
+				return received, err
+			}
+			if err := os.MkdirAll(dest, 0777); err != nil {
+				return received, fmt.Errorf("create directory %s: %w", dest, err)
+			}
+		case tar.TypeReg:
+			dest, err := target(name)
+			if err != nil {
+				return received, err
+			}
+			want := ""
+			if checksums != nil {
+				var ok bool
+				if want, ok = checksums[name]; !ok {
+					return received, fmt.Errorf("file %s has no checksum", name)
+				}
+			}
+			if sizes != nil {
+				if err := checkSize(name, header.Size, sizes); err != nil {
+					return received, err
+				}
+			}
+			progress.start(name, header.Size)
+			if err := writeVerifiedFile(dest, archive, header.Size, want, progress); err != nil {
+				return received, err
+			}
+			received[name] = true
+		default:
+			log.Printf("Skipping %s in archive, only files and directories are copied", name)
+		}
+	}
+}
+
+// writeVerifiedFile writes a file of the given size to a temporary file next to dest and moves it to dest once
+// its size and, when want is set, its checksum are correct
+func writeVerifiedFile(dest string, r io.Reader, size int64, want string, progress io.Writer) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return fmt.Errorf("create directory for %s: %w", dest, err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.partial")
+	if err != nil {
+		return fmt.Errorf("create %s: %w", dest, err)
+	}
+	defer os.Remove(file.Name())
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash, progress), r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write %s: %w", dest, err)
+	}
+	if written != size {
+		return fmt.Errorf("write %s: received %d of %d bytes", dest, written, size)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); want != "" && got != want {
+		return &ChecksumError{Path: dest, Want: want, Got: got}
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return fmt.Errorf("write %s: %w", dest, err)
+	}
+	if err := os.Rename(file.Name(), dest); err != nil {
+		return fmt.Errorf("write %s: %w", dest, err)
+	}
+	return nil
+}
+
+// writeArchive writes local files and directories as a tar archive and records the checksum and size of every file
+func writeArchive(w io.Writer, sources []uploadSource, checksums map[string]string, sizes map[string]int64, progress *transferProgress) error {
+	archive := tar.NewWriter(w)
+	for _, source := range sources {
+		err := filepath.WalkDir(source.localPath, func(localPath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(source.localPath, localPath)
+			if err != nil {
+				return err
+			}
+			name := path.Join(source.name, filepath.ToSlash(relPath))
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case entry.IsDir():
+				return archive.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0755, ModTime: info.ModTime()})
+			case !entry.Type().IsRegular():
+				log.Printf("Skipping %s, only files and directories are copied", localPath)
+				return nil
+			}
+
+			file, err := os.Open(localPath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: info.Size(), Mode: 0644, ModTime: info.ModTime()}
+			if err := archive.WriteHeader(header); err != nil {
+				return err
+			}
+			hash := sha256.New()
+			progress.start(name, info.Size())
+			if _, err := io.Copy(io.MultiWriter(archive, hash, progress), file); err != nil {
+				return fmt.Errorf("archive %s: %w", localPath, err)
+			}
+			checksums[name] = hex.EncodeToString(hash.Sum(nil))
+			sizes[name] = info.Size()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// localPath returns the path of an archive entry below dir, rejecting entries that would end up outside of it
+func localPath(dir, name string) (string, error) {
+	relPath := filepath.FromSlash(path.Clean(name))
+	if !filepath.IsLocal(relPath) {
+		return "", fmt.Errorf("archive entry %s is outside of the destination directory", name)
+	}
+	return filepath.Join(dir, relPath), nil
+}
+
+// transferProgress counts the bytes of a file transfer and logs the progress every ProgressInterval
+type transferProgress struct {
+	action      string
+	preposition string
+	direction   string
+	podName     string
+
+	name    string
+	total   int64
+	done    int64
+	lastLog time.Time
+}
+
+// start begins counting the bytes of the next file
+func (p *transferProgress) start(name string, total int64) {
+	p.name, p.total, p.done, p.lastLog = name, total, 0, time.Now()
+}
+
+func (p *transferProgress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	metrics.TransferredBytes.Add(float64(len(b)), p.direction)
+	if time.Since(p.lastLog) >= ProgressInterval {
+		p.lastLog = time.Now()
+		log.Printf("%s %s %s pod %s: %s of %s", p.action, p.name, p.preposition, p.podName, formatBytes(p.done), formatBytes(p.total))
+	}
+	return len(b), nil
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,250 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/idlab-discover/concap/internal/metrics"
+	kubeexec "k8s.io/client-go/util/exec"
+)
+
+// localExec runs the commands of a pod on the local machine
+func localExec(ctx context.Context, podName, containerName string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return kubeexec.CodeExitError{Err: err, Code: exitErr.ExitCode()}
+	}
+	return err
+}
+
+// useStreamExec replaces streamExec for the duration of a test
+func useStreamExec(t *testing.T, fn func(ctx context.Context, podName, containerName string, command []string, stdin io.Reader, stdout, stderr io.Writer) error) {
+	original := streamExec
+	streamExec = fn
+	t.Cleanup(func() {
+		streamExec = original
+	})
+}
+
+// isChecksumCommand reports whether a command computes checksums
+func isChecksumCommand(command []string) bool {
+	return len(command) > 2 && command[2] == checksumScript
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(b)
+}
+
+func TestCopyFileFromPodRenamesAndRemovesFile(t *testing.T) {
+	useStreamExec(t, localExec)
+	pod, local := t.TempDir(), t.TempDir()
+	source := filepath.Join(pod, "dump.pcap")
+	writeTestFile(t, source, strings.Repeat("packet", 1000))
+
+	dest := filepath.Join(local, "out", "capture.pcap")
+	if err := CopyFileFromPod(context.Background(), "target", "tcpdump", source, dest, false); err != nil {
+		t.Fatalf("CopyFileFromPod returned error: %v", err)
+	}
+	if got := readTestFile(t, dest); got != strings.Repeat("packet", 1000) {
+		t.Fatalf("copied file has %d bytes, want %d", len(got), 6000)
+	}
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Fatalf("source file was not removed: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(dest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("destination directory holds %d entries, want only the copied file", len(entries))
+	}
+}
+
+func TestCopyFromPodCopiesDirectories(t *testing.T) {
+	useStreamExec(t, localExec)
+	pod, local := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(pod, "logs", "attacker.log"), "attack")
+	writeTestFile(t, filepath.Join(pod, "logs", "nested", "tcpdump.log"), "capture")
+	writeTestFile(t, filepath.Join(pod, "flows.csv"), "a,b\n")
+
+	sources := []string{filepath.Join(pod, "logs"), filepath.Join(pod, "flows.csv")}
+	if err := CopyFromPod(context.Background(), "target", "tcpdump", sources, local); err != nil {
+		t.Fatalf("CopyFromPod returned error: %v", err)
+	}
+	for path, want := range map[string]string{
+		"logs/attacker.log":       "attack",
+		"logs/nested/tcpdump.log": "capture",
+		"flows.csv":               "a,b\n",
+	} {
+		if got := readTestFile(t, filepath.Join(local, path)); got != want {
+			t.Fatalf("%s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestCopyToPodRoundTrip(t *testing.T) {
+	useStreamExec(t, localExec)
+	pod, local := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(local, "input", "dump.pcap"), "pcap")
+	writeTestFile(t, filepath.Join(local, "input", "sub", "extra.txt"), "extra")
+	writeTestFile(t, filepath.Join(local, "single.txt"), "single")
+
+	destDir := filepath.Join(pod, "data")
+	sources := []string{filepath.Join(local, "input"), filepath.Join(local, "single.txt")}
+	if err := CopyToPod(context.Background(), "processor", "processor", sources, destDir); err != nil {
+		t.Fatalf("CopyToPod returned error: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(destDir, "input", "sub", "extra.txt")); got != "extra" {
+		t.Fatalf("extra.txt = %q, want %q", got, "extra")
+	}
+
+	dest := filepath.Join(pod, "renamed.pcap")
+	if err := CopyFileToPod(context.Background(), "processor", "processor", filepath.Join(local, "input", "dump.pcap"), dest); err != nil {
+		t.Fatalf("CopyFileToPod returned error: %v", err)
+	}
+	if got := readTestFile(t, dest); got != "pcap" {
+		t.Fatalf("renamed.pcap = %q, want %q", got, "pcap")
+	}
+}
+
+func TestCopyFileFromPodRejectsChecksumMismatch(t *testing.T) {
+	useStreamExec(t, func(ctx context.Context, podName, containerName string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		if isChecksumCommand(command) {
+			_, err := io.WriteString(stdout, strings.Repeat("0", 64)+"  dump.pcap\n")
+			return err
+		}
+		return localExec(ctx, podName, containerName, command, stdin, stdout, stderr)
+	})
+	pod, local := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(pod, "dump.pcap"), "pcap")
+
+	dest := filepath.Join(local, "dump.pcap")
+	err := CopyFileFromPod(context.Background(), "target", "tcpdump", filepath.Join(pod, "dump.pcap"), dest, true)
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("CopyFileFromPod error = %v, want a ChecksumError", err)
+	}
+	var copyErr *CopyError
+	if !errors.As(err, &copyErr) || copyErr.Direction != "download" {
+		t.Fatalf("CopyFileFromPod error = %v, want a download CopyError", err)
+	}
+	entries, err := os.ReadDir(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("destination directory holds %d entries after a failed copy, want none", len(entries))
+	}
+}
+
+// withoutSha256sum fails checksum commands like a container without sha256sum and answers size commands with
+// sizeOutput when it is set. Other commands run locally.
+func withoutSha256sum(sizeOutput string) func(ctx context.Context, podName, containerName string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return func(ctx context.Context, podName, containerName string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		switch {
+		case isChecksumCommand(command):
+			return kubeexec.CodeExitError{Err: errors.New("command terminated with exit code 127"), Code: 127}
+		case len(command) > 2 && command[2] == sizeScript && sizeOutput != "":
+			_, err := io.WriteString(stdout, sizeOutput)
+			return err
+		}
+		return localExec(ctx, podName, containerName, command, stdin, stdout, stderr)
+	}
+}
+
+func TestCopyFileFromPodWithoutSha256sum(t *testing.T) {
+	useStreamExec(t, withoutSha256sum(""))
+	pod, local := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(pod, "tcpdump.log"), "log")
+
+	dest := filepath.Join(local, "tcpdump.log")
+	if err := CopyFileFromPod(context.Background(), "target", "tcpdump", filepath.Join(pod, "tcpdump.log"), dest, true); err != nil {
+		t.Fatalf("CopyFileFromPod returned error: %v", err)
+	}
+	if got := readTestFile(t, dest); got != "log" {
+		t.Fatalf("tcpdump.log = %q, want %q", got, "log")
+	}
+	var text strings.Builder
+	if err := metrics.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	if want := `concap_unverified_copies_total{direction="download"}`; !strings.Contains(text.String(), want) {
+		t.Fatalf("metrics do not count the unverified copy, want %s in:\n%s", want, text.String())
+	}
+}
+
+func TestCopyFileFromPodWithoutSha256sumChecksSizes(t *testing.T) {
+	useStreamExec(t, withoutSha256sum("  3 dump.pcap\n"))
+	pod, local := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(pod, "dump.pcap"), "pcap")
+
+	err := CopyFileFromPod(context.Background(), "target", "tcpdump", filepath.Join(pod, "dump.pcap"), filepath.Join(local, "dump.pcap"), true)
+	var copyErr *CopyError
+	if !errors.As(err, &copyErr) || !strings.Contains(err.Error(), "3 bytes in the container") {
+		t.Fatalf("CopyFileFromPod error = %v, want a CopyError for the size mismatch", err)
+	}
+	entries, err := os.ReadDir(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("destination directory holds %d entries after a failed copy, want none", len(entries))
+	}
+}
+
+func TestCopyToPodWithoutSha256sumChecksSizes(t *testing.T) {
+	pod, local := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(local, "input", "dump.pcap"), "pcap")
+	writeTestFile(t, filepath.Join(local, "input", "sub", "extra.txt"), "extra")
+	sources := []string{filepath.Join(local, "input")}
+
+	useStreamExec(t, withoutSha256sum(""))
+	if err := CopyToPod(context.Background(), "processor", "processor", sources, filepath.Join(pod, "data")); err != nil {
+		t.Fatalf("CopyToPod returned error: %v", err)
+	}
+
+	useStreamExec(t, withoutSha256sum("4 input/dump.pcap\n"))
+	err := CopyToPod(context.Background(), "processor", "processor", sources, filepath.Join(pod, "other"))
+	var copyErr *CopyError
+	if !errors.As(err, &copyErr) || !strings.Contains(err.Error(), "input/sub/extra.txt not found") {
+		t.Fatalf("CopyToPod error = %v, want a CopyError for the missing file", err)
+	}
+}
+
+func TestCopyFileFromPodMissingSourceIsTransient(t *testing.T) {
+	useStreamExec(t, localExec)
+	pod, local := t.TempDir(), t.TempDir()
+
+	err := CopyFileFromPod(context.Background(), "target", "tcpdump", filepath.Join(pod, "missing.pcap"), filepath.Join(local, "missing.pcap"), true)
+	var copyErr *CopyError
+	if !errors.As(err, &copyErr) {
+		t.Fatalf("CopyFileFromPod error = %v, want a CopyError", err)
+	}
+	if !IsTransient(err) {
+		t.Fatalf("IsTransient(%v) = false, want true", err)
+	}
+}
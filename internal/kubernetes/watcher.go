@@ -4,81 +4,271 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/idlab-discover/concap/internal/metrics"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
-	toolsWatch "k8s.io/client-go/tools/watch"
 )
 
+// ManagedPodsSelector selects the pods the watcher caches. Every pod concap creates carries the concap label.
+const ManagedPodsSelector = "concap"
+
+// PodResyncPeriod is how often the watcher notifies the subscribers of every pod of its cached state again
+var PodResyncPeriod = 5 * time.Minute
+
+// PodSyncTimeout bounds how long the watcher may take to list the pods when it starts
+var PodSyncTimeout = time.Minute
+
+// podNameIndex indexes the cached pods by name
+const podNameIndex = "name"
+
+// PodWatcher keeps a cache of the pods concap manages, filled by a shared informer that lists and watches the
+// pods matching a label selector, and notifies the subscribers of a pod of every change to it.
 type PodWatcher struct {
-	podsClient v1.PodInterface
-	waiters    map[string]*podWaiter
-	mu         sync.Mutex
+	informer    cache.SharedIndexInformer
+	subscribers map[string]map[*PodSubscription]struct{}
+	mu          sync.Mutex
+}
+
+// PodUpdate is the state of a pod after a change. Deleted is set once the pod is gone, with its last state.
+type PodUpdate struct {
+	Pod     *apiv1.Pod
+	Deleted bool
 }
 
-type podWaiter struct {
-	events chan *apiv1.Pod
-	done   chan struct{}
+// PodSubscription delivers the changes to a pod. Its channel holds only the latest update, so a slow subscriber
+// skips intermediate states but always receives the last one.
+type PodSubscription struct {
+	podName string
+	updates chan PodUpdate
+	done    chan struct{}
+	watcher *PodWatcher
+	once    sync.Once
 }
 
-func NewPodWatcher(podsClient v1.PodInterface) PodWatcher {
-	return PodWatcher{
-		podsClient: podsClient,
-		waiters:    make(map[string]*podWaiter),
+// NewPodWatcher returns a watcher of the pods matching labelSelector. It does not watch until it is started.
+func NewPodWatcher(podsClient v1.PodInterface, labelSelector string) *PodWatcher {
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = labelSelector
+			return podsClient.List(context.Background(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = labelSelector
+			return podsClient.Watch(context.Background(), options)
+		},
 	}
+	informer := cache.NewSharedIndexInformer(listWatch, &apiv1.Pod{}, PodResyncPeriod, cache.Indexers{
+		podNameIndex: func(obj interface{}) ([]string, error) {
+			return []string{obj.(*apiv1.Pod).Name}, nil
+		},
+	})
+	pw := &PodWatcher{
+		informer:    informer,
+		subscribers: make(map[string]map[*PodSubscription]struct{}),
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			pw.notify(PodUpdate{Pod: obj.(*apiv1.Pod)})
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			pw.notify(PodUpdate{Pod: obj.(*apiv1.Pod)})
+		},
+		DeleteFunc: func(obj interface{}) {
+			// The watch may have missed the deletion, the informer then only knows the last state it saw
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*apiv1.Pod); ok {
+				pw.notify(PodUpdate{Pod: pod, Deleted: true})
+			}
+		},
+	})
+	informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		log.Printf("Pod watch failed, restarting it: %v", err)
+	})
+	return pw
 }
 
+// Start runs the informer until the context is done. The returned channel receives an error when the initial
+// list of the pods does not complete within PodSyncTimeout, and is closed when the watcher stops.
 func (pw *PodWatcher) Start(ctx context.Context) <-chan error {
 	errCh := make(chan error, 1)
+	go pw.informer.Run(ctx.Done())
 	go func() {
 		defer close(errCh)
-		if err := pw.WatchPods(ctx); err != nil {
-			errCh <- err
+		syncCtx, cancel := context.WithTimeout(ctx, PodSyncTimeout)
+		defer cancel()
+		if !cache.WaitForCacheSync(syncCtx.Done(), pw.informer.HasSynced) && ctx.Err() == nil {
+			errCh <- fmt.Errorf("list pods: not synced after %s", PodSyncTimeout)
+			return
 		}
+		<-ctx.Done()
 	}()
 	return errCh
 }
 
-// WaitForPodReady blocks until the pod is in the running phase and all the containers are ready.
-//
-// First it adds the pod with a corresponding channel to the eventsChans map for PodWatcher.
-// Then it waits for updates from the PodWatcher for the desired phase to be reached.
-func (pw *PodWatcher) WaitForPodReady(ctx context.Context, podName string) (*apiv1.Pod, error) {
+// Get returns the cached state of a pod
+func (pw *PodWatcher) Get(podName string) (*apiv1.Pod, bool) {
+	objs, err := pw.informer.GetIndexer().ByIndex(podNameIndex, podName)
+	if err != nil || len(objs) == 0 {
+		return nil, false
+	}
+	return objs[0].(*apiv1.Pod), true
+}
+
+// Subscribe returns a subscription to the changes of a pod. Its first update is the cached state of the pod, if
+// the cache holds it. The subscription must be closed.
+func (pw *PodWatcher) Subscribe(podName string) *PodSubscription {
+	sub := &PodSubscription{
+		podName: podName,
+		updates: make(chan PodUpdate, 1),
+		done:    make(chan struct{}),
+		watcher: pw,
+	}
 	pw.mu.Lock()
-	waiter, exists := pw.waiters[podName]
-	if exists {
-		pw.mu.Unlock()
-		return nil, fmt.Errorf("pod %s is already being watched", podName)
+	if pw.subscribers[podName] == nil {
+		pw.subscribers[podName] = make(map[*PodSubscription]struct{})
 	}
-	waiter = &podWaiter{
-		events: make(chan *apiv1.Pod, 1),
-		done:   make(chan struct{}),
+	pw.subscribers[podName][sub] = struct{}{}
+	pw.mu.Unlock()
+
+	if pod, ok := pw.Get(podName); ok {
+		sub.deliver(PodUpdate{Pod: pod})
+	}
+	return sub
+}
+
+// Updates returns the channel the changes to the pod are delivered on
+func (s *PodSubscription) Updates() <-chan PodUpdate {
+	return s.updates
+}
+
+// Close stops the delivery of updates
+func (s *PodSubscription) Close() {
+	s.once.Do(func() {
+		s.watcher.mu.Lock()
+		delete(s.watcher.subscribers[s.podName], s)
+		if len(s.watcher.subscribers[s.podName]) == 0 {
+			delete(s.watcher.subscribers, s.podName)
+		}
+		s.watcher.mu.Unlock()
+		close(s.done)
+	})
+}
+
+// deliver replaces an update the subscriber has not received yet by the latest one
+func (s *PodSubscription) deliver(update PodUpdate) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case s.updates <- update:
+			return
+		default:
+		}
+		select {
+		case <-s.updates:
+		default:
+		}
+	}
+}
+
+func (pw *PodWatcher) notify(update PodUpdate) {
+	pw.mu.Lock()
+	subs := make([]*PodSubscription, 0, len(pw.subscribers[update.Pod.Name]))
+	for sub := range pw.subscribers[update.Pod.Name] {
+		subs = append(subs, sub)
 	}
-	pw.waiters[podName] = waiter
 	pw.mu.Unlock()
+	for _, sub := range subs {
+		sub.deliver(update)
+	}
+}
 
-	defer func() {
-		pw.mu.Lock()
-		if current, ok := pw.waiters[podName]; ok && current == waiter {
-			delete(pw.waiters, podName)
-			close(waiter.done)
+// WaitFor blocks until condition returns true or an error for an update of the pod, and returns that update
+func (pw *PodWatcher) WaitFor(ctx context.Context, podName string, condition func(PodUpdate) (bool, error)) (PodUpdate, error) {
+	sub := pw.Subscribe(podName)
+	defer sub.Close()
+	for {
+		select {
+		case update := <-sub.Updates():
+			done, err := condition(update)
+			if err != nil || done {
+				return update, err
+			}
+		case <-ctx.Done():
+			return PodUpdate{}, ctx.Err()
 		}
-		pw.mu.Unlock()
+	}
+}
+
+// WaitForPodReady blocks until the pod is in the running phase and all the containers are ready.
+// It returns a PodStartupError as soon as the pod reaches a state it will not become ready from.
+func (pw *PodWatcher) WaitForPodReady(ctx context.Context, podName string) (*apiv1.Pod, error) {
+	start := time.Now()
+	defer func() {
+		metrics.PodReadyWait.Observe(time.Since(start).Seconds())
 	}()
 
+	update, err := pw.WaitFor(ctx, podName, func(update PodUpdate) (bool, error) {
+		if update.Deleted {
+			return false, fmt.Errorf("pod %s was deleted before it became ready", podName)
+		}
+		if update.Pod.Status.Phase == apiv1.PodRunning && isPodReady(update.Pod) {
+			return true, nil
+		}
+		if err := podStartupError(update.Pod); err != nil {
+			metrics.PodStartupFailures.Inc(err.Reason)
+			return false, err
+		}
+		return false, nil
+	})
+	return update.Pod, err
+}
+
+// WaitForPodPhase blocks until the pod reaches one of the phases
+func (pw *PodWatcher) WaitForPodPhase(ctx context.Context, podName string, phases ...apiv1.PodPhase) (*apiv1.Pod, error) {
+	update, err := pw.WaitFor(ctx, podName, func(update PodUpdate) (bool, error) {
+		if update.Deleted {
+			return false, fmt.Errorf("pod %s was deleted in phase %s", podName, update.Pod.Status.Phase)
+		}
+		for _, phase := range phases {
+			if update.Pod.Status.Phase == phase {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return update.Pod, err
+}
+
+// WaitForPodDeleted blocks until the pod is gone. A pod the watcher does not know once it has listed the pods
+// is gone already.
+func (pw *PodWatcher) WaitForPodDeleted(ctx context.Context, podName string) error {
+	sub := pw.Subscribe(podName)
+	defer sub.Close()
+	if !cache.WaitForCacheSync(ctx.Done(), pw.informer.HasSynced) {
+		return ctx.Err()
+	}
+	if _, ok := pw.Get(podName); !ok {
+		return nil
+	}
 	for {
 		select {
-		case pod := <-waiter.events:
-			if pod.Status.Phase == apiv1.PodRunning && isPodReady(pod) {
-				// Pod has reached desired phase and stop watching the pod
-				return pod, nil
+		case update := <-sub.Updates():
+			if update.Deleted {
+				return nil
 			}
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 }
@@ -93,64 +283,89 @@ func isPodReady(pod *apiv1.Pod) bool {
 	return true
 }
 
-// WatchPods watches all pods in the namespace and sends events to the corresponding channels.
-func (pw *PodWatcher) WatchPods(ctx context.Context) error {
-	watchFunc := func(options metav1.ListOptions) (watch.Interface, error) {
-		timeout := int64(60 * 60 * 2) // 2 hours
-		return pw.podsClient.Watch(ctx, metav1.ListOptions{TimeoutSeconds: &timeout})
-	}
-	watcher, err := toolsWatch.NewRetryWatcher("1", &cache.ListWatch{WatchFunc: watchFunc})
-	if err != nil {
-		return err
-	}
-	defer watcher.Stop()
+// failedWaitingReasons are the reasons of waiting containers that will not start without a change to the pod
+var failedWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CrashLoopBackOff":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			// The context is done, so we stop the watcher and exit
-			return nil
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				return fmt.Errorf("watch channel is closed")
-			}
-			pod, ok := event.Object.(*apiv1.Pod)
-			if !ok {
-				log.Printf("Unexpected event object while watching pods: %T", event.Object)
-				continue // should not happen, only listen to pod events
-			}
-			pw.notify(pod)
+// Parts of the scheduler message of an unschedulable pod, e.g. "0/3 nodes are available: 1 Insufficient cpu,
+// 2 node(s) didn't match Pod's node affinity/selector."
+var (
+	// unresolvableSchedulingReasons are node mismatches that persist until the pod or the nodes are changed
+	unresolvableSchedulingReasons = []string{"didn't match Pod's node affinity/selector", "had untolerated taint", "had taint"}
+	// transientSchedulingReasons are node mismatches that resolve when other pods terminate or a node recovers,
+	// including the taints Kubernetes sets on nodes that are not ready, unreachable, cordoned or under pressure
+	transientSchedulingReasons = []string{"Insufficient ", "Too many pods", "didn't have free ports", "node.kubernetes.io/",
+		"were unschedulable", "pod affinity", "anti-affinity"}
+)
+
+// schedulingMayResolve reports whether a pod that the scheduler reports as unschedulable with the message may
+// still be scheduled without a change to the pod or the nodes. It does unless every node is ruled out by a
+// selector, affinity or taint mismatch.
+func schedulingMayResolve(message string) bool {
+	for _, reason := range transientSchedulingReasons {
+		if strings.Contains(message, reason) {
+			return true
 		}
 	}
+	for _, reason := range unresolvableSchedulingReasons {
+		if strings.Contains(message, reason) {
+			return false
+		}
+	}
+	return true
 }
 
-func (pw *PodWatcher) notify(pod *apiv1.Pod) {
-	pw.mu.Lock()
-	waiter, exists := pw.waiters[pod.Name]
-	pw.mu.Unlock()
-	if !exists {
-		return
+// podStartupError returns why a pod will never become ready, or nil while it still can. It checks the phase,
+// the scheduling condition and the states of the init containers and containers, in that order.
+func podStartupError(pod *apiv1.Pod) *PodStartupError {
+	if pod.Status.Phase == apiv1.PodFailed || pod.Status.Phase == apiv1.PodSucceeded {
+		reason := pod.Status.Reason
+		if reason == "" {
+			reason = "Pod" + string(pod.Status.Phase)
+		}
+		return &PodStartupError{PodName: pod.Name, Reason: reason, Message: pod.Status.Message}
 	}
-
-	select {
-	case <-waiter.done:
-		return
-	default:
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == apiv1.PodScheduled && condition.Status == apiv1.ConditionFalse && condition.Reason == apiv1.PodReasonUnschedulable &&
+			!schedulingMayResolve(condition.Message) {
+			return &PodStartupError{PodName: pod.Name, Reason: condition.Reason, Message: condition.Message}
+		}
 	}
-
-	select {
-	case waiter.events <- pod:
-		return
-	default:
+	for _, status := range pod.Status.InitContainerStatuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			reason := terminated.Reason
+			if reason == "" {
+				reason = "Error"
+			}
+			message := fmt.Sprintf("exit code %d", terminated.ExitCode)
+			if terminated.Message != "" {
+				message += ": " + terminated.Message
+			}
+			return &PodStartupError{PodName: pod.Name, Container: status.Name, Reason: reason, Message: message}
+		}
+		if err := waitingError(pod.Name, status); err != nil {
+			return err
+		}
 	}
-
-	select {
-	case <-waiter.events:
-	default:
+	for _, status := range pod.Status.ContainerStatuses {
+		if err := waitingError(pod.Name, status); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	select {
-	case waiter.events <- pod:
-	case <-waiter.done:
+// waitingError returns a PodStartupError when a container waits for a reason it will not recover from
+func waitingError(podName string, status apiv1.ContainerStatus) *PodStartupError {
+	waiting := status.State.Waiting
+	if waiting == nil || !failedWaitingReasons[waiting.Reason] {
+		return nil
 	}
+	return &PodStartupError{PodName: podName, Container: status.Name, Reason: waiting.Reason, Message: waiting.Message}
 }
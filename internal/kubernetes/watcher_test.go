@@ -3,22 +3,61 @@ package kubernetes
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
 )
 
+// useFakeCluster replaces the pods client and the pod watcher with ones backed by a fake clientset and waits
+// until the watcher watches
+func useFakeCluster(t *testing.T, clientset *kubefake.Clientset) {
+	t.Helper()
+	// The fake clientset does not replay the changes made between the list and the watch of the informer
+	watching := make(chan struct{})
+	var once sync.Once
+	clientset.PrependWatchReactor("pods", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		w, err := clientset.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		if err != nil {
+			return false, nil, err
+		}
+		once.Do(func() { close(watching) })
+		return true, w, nil
+	})
+
+	originalPodsClient, originalPodWatcher := podsClient, podWatcher
+	podsClient = clientset.CoreV1().Pods(WorkloadNamespace)
+	podWatcher = NewPodWatcher(podsClient, ManagedPodsSelector)
+	ctx, cancel := context.WithCancel(context.Background())
+	podWatcher.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		podsClient, podWatcher = originalPodsClient, originalPodWatcher
+	})
+
+	select {
+	case <-watching:
+	case <-time.After(2 * time.Second):
+		t.Fatal("pod watcher did not start watching")
+	}
+}
+
 func TestPodWatcherWaitForPodReadyReturnsReadyPod(t *testing.T) {
-	pw := NewPodWatcher(nil)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+	clientset := kubefake.NewSimpleClientset()
+	useFakeCluster(t, clientset)
+	createTestPod(t, testPod("pod-a", apiv1.PodPending, false))
 
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
 	resultCh := make(chan *apiv1.Pod, 1)
 	errCh := make(chan error, 1)
 	go func() {
-		pod, err := pw.WaitForPodReady(ctx, "pod-a")
+		pod, err := podWatcher.WaitForPodReady(ctx, "pod-a")
 		if err != nil {
 			errCh <- err
 			return
@@ -26,52 +65,68 @@ func TestPodWatcherWaitForPodReadyReturnsReadyPod(t *testing.T) {
 		resultCh <- pod
 	}()
 
-	waitForWaiter(t, &pw, "pod-a")
-
-	pw.notify(testPod("pod-a", apiv1.PodPending, false))
-	pw.notify(testPod("pod-a", apiv1.PodRunning, true))
+	waitForSubscriber(t, podWatcher, "pod-a")
+	updateTestPodStatus(t, testPod("pod-a", apiv1.PodRunning, true))
 
 	select {
 	case err := <-errCh:
 		t.Fatalf("WaitForPodReady returned error: %v", err)
 	case pod := <-resultCh:
-		if got := pod.Name; got != "pod-a" {
-			t.Fatalf("returned pod name = %q, want %q", got, "pod-a")
+		if pod.Name != "pod-a" || !isPodReady(pod) {
+			t.Fatalf("WaitForPodReady returned pod %s, ready = %v", pod.Name, isPodReady(pod))
 		}
-	case <-time.After(time.Second):
+	case <-time.After(2 * time.Second):
 		t.Fatal("WaitForPodReady did not return a ready pod")
 	}
 }
 
-func TestPodWatcherNotifyReplacesStaleBufferedEvent(t *testing.T) {
-	pw := NewPodWatcher(nil)
-	waiter := &podWaiter{
-		events: make(chan *apiv1.Pod, 1),
-		done:   make(chan struct{}),
+func TestPodWatcherWaitForPodReadySeesCachedPod(t *testing.T) {
+	clientset := kubefake.NewSimpleClientset()
+	useFakeCluster(t, clientset)
+	createTestPod(t, testPod("pod-a", apiv1.PodRunning, true))
+	waitForCachedPod(t, podWatcher, "pod-a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := podWatcher.WaitForPodReady(ctx, "pod-a"); err != nil {
+		t.Fatalf("WaitForPodReady returned error for a pod that is ready already: %v", err)
 	}
+}
 
-	pw.mu.Lock()
-	pw.waiters["pod-a"] = waiter
-	pw.mu.Unlock()
+func TestPodWatcherWaitForPodReadyFailsOnImagePullBackOff(t *testing.T) {
+	clientset := kubefake.NewSimpleClientset()
+	useFakeCluster(t, clientset)
+	createTestPod(t, testPod("pod-a", apiv1.PodPending, false))
 
-	stale := testPod("pod-a", apiv1.PodPending, false)
-	latest := testPod("pod-a", apiv1.PodRunning, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := podWatcher.WaitForPodReady(ctx, "pod-a")
+		errCh <- err
+	}()
 
-	pw.notify(stale)
-	pw.notify(latest)
+	waitForSubscriber(t, podWatcher, "pod-a")
+	pod := testPod("pod-a", apiv1.PodPending, false)
+	pod.Status.ContainerStatuses[0].State.Waiting = &apiv1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}
+	updateTestPodStatus(t, pod)
 
 	select {
-	case pod := <-waiter.events:
-		if pod.Status.Phase != apiv1.PodRunning || !isPodReady(pod) {
-			t.Fatalf("received stale pod event: phase=%s ready=%v", pod.Status.Phase, isPodReady(pod))
+	case err := <-errCh:
+		var startupErr *PodStartupError
+		if !errors.As(err, &startupErr) {
+			t.Fatalf("WaitForPodReady error = %v, want a PodStartupError", err)
 		}
-	case <-time.After(time.Second):
-		t.Fatal("notify did not deliver the latest pod event")
+		if startupErr.Container != "target" || startupErr.Reason != "ImagePullBackOff" {
+			t.Fatalf("PodStartupError = %+v, want container target and reason ImagePullBackOff", startupErr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WaitForPodReady did not return on ImagePullBackOff")
 	}
 }
 
-func TestPodWatcherWaitForPodReadyRemovesWaiterOnCancel(t *testing.T) {
-	pw := NewPodWatcher(nil)
+func TestPodWatcherWaitForPodReadyRemovesSubscriberOnCancel(t *testing.T) {
+	pw := NewPodWatcher(nil, ManagedPodsSelector)
 	ctx, cancel := context.WithCancel(context.Background())
 
 	errCh := make(chan error, 1)
@@ -80,7 +135,7 @@ func TestPodWatcherWaitForPodReadyRemovesWaiterOnCancel(t *testing.T) {
 		errCh <- err
 	}()
 
-	waitForWaiter(t, &pw, "pod-a")
+	waitForSubscriber(t, pw, "pod-a")
 	cancel()
 
 	select {
@@ -92,73 +147,219 @@ func TestPodWatcherWaitForPodReadyRemovesWaiterOnCancel(t *testing.T) {
 		t.Fatal("WaitForPodReady did not return after cancellation")
 	}
 
-	waitForWaiterRemoval(t, &pw, "pod-a")
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if _, exists := pw.subscribers["pod-a"]; exists {
+		t.Fatal("subscriber was not removed after cancellation")
+	}
 }
 
-func TestPodWatcherWaitForPodReadyRejectsDuplicateWatchers(t *testing.T) {
-	pw := NewPodWatcher(nil)
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+func TestPodWatcherNotifiesEverySubscriber(t *testing.T) {
+	pw := NewPodWatcher(nil, ManagedPodsSelector)
+	first, second := pw.Subscribe("pod-a"), pw.Subscribe("pod-a")
+	defer first.Close()
+	defer second.Close()
 
+	pw.notify(PodUpdate{Pod: testPod("pod-a", apiv1.PodRunning, true)})
+	for _, sub := range []*PodSubscription{first, second} {
+		select {
+		case update := <-sub.Updates():
+			if update.Pod.Status.Phase != apiv1.PodRunning {
+				t.Fatalf("received phase %s, want %s", update.Pod.Status.Phase, apiv1.PodRunning)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("subscriber did not receive the update")
+		}
+	}
+}
+
+func TestPodSubscriptionKeepsLatestUpdate(t *testing.T) {
+	pw := NewPodWatcher(nil, ManagedPodsSelector)
+	sub := pw.Subscribe("pod-a")
+	defer sub.Close()
+
+	pw.notify(PodUpdate{Pod: testPod("pod-a", apiv1.PodPending, false)})
+	pw.notify(PodUpdate{Pod: testPod("pod-a", apiv1.PodRunning, true)})
+
+	select {
+	case update := <-sub.Updates():
+		if update.Pod.Status.Phase != apiv1.PodRunning || !isPodReady(update.Pod) {
+			t.Fatalf("received stale pod update: phase=%s ready=%v", update.Pod.Status.Phase, isPodReady(update.Pod))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription did not deliver the latest update")
+	}
+}
+
+func TestPodWatcherWaitForPodPhase(t *testing.T) {
+	clientset := kubefake.NewSimpleClientset()
+	useFakeCluster(t, clientset)
+	createTestPod(t, testPod("pod-a", apiv1.PodRunning, true))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
 	errCh := make(chan error, 1)
 	go func() {
-		_, err := pw.WaitForPodReady(ctx, "pod-a")
+		_, err := podWatcher.WaitForPodPhase(ctx, "pod-a", apiv1.PodSucceeded, apiv1.PodFailed)
 		errCh <- err
 	}()
 
-	waitForWaiter(t, &pw, "pod-a")
+	waitForSubscriber(t, podWatcher, "pod-a")
+	updateTestPodStatus(t, testPod("pod-a", apiv1.PodSucceeded, false))
 
-	_, err := pw.WaitForPodReady(context.Background(), "pod-a")
-	if err == nil {
-		t.Fatal("WaitForPodReady returned nil error for duplicate watcher")
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("WaitForPodPhase returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WaitForPodPhase did not return when the pod succeeded")
 	}
+}
 
-	cancel()
-	select {
-	case <-errCh:
-	case <-time.After(time.Second):
-		t.Fatal("original WaitForPodReady did not return after cancellation")
+func TestPodWatcherIgnoresUnmanagedPods(t *testing.T) {
+	clientset := kubefake.NewSimpleClientset(
+		&apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: WorkloadNamespace}},
+		&apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "scan-T", Namespace: WorkloadNamespace, Labels: map[string]string{"concap": "target-pod"}}},
+	)
+	useFakeCluster(t, clientset)
+
+	waitForCachedPod(t, podWatcher, "scan-T")
+	if _, ok := podWatcher.Get("other"); ok {
+		t.Fatal("pod watcher cached a pod without the concap label")
+	}
+}
+
+func createTestPod(t *testing.T, pod *apiv1.Pod) {
+	t.Helper()
+	if _, err := podsClient.Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create test pod: %v", err)
 	}
 }
 
+func updateTestPodStatus(t *testing.T, pod *apiv1.Pod) {
+	t.Helper()
+	if _, err := podsClient.UpdateStatus(context.Background(), pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update test pod status: %v", err)
+	}
+}
+
+// testPod returns a managed pod with a single container named target
 func testPod(name string, phase apiv1.PodPhase, ready bool) *apiv1.Pod {
 	return &apiv1.Pod{
-		ObjectMeta: metav1.ObjectMeta{Name: name},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: WorkloadNamespace, Labels: map[string]string{"concap": "target-pod"}},
 		Status: apiv1.PodStatus{
 			Phase: phase,
 			ContainerStatuses: []apiv1.ContainerStatus{
-				{Ready: ready},
+				{Name: "target", Ready: ready},
 			},
 		},
 	}
 }
 
-func waitForWaiter(t *testing.T, pw *PodWatcher, podName string) {
+func waitForSubscriber(t *testing.T, pw *PodWatcher, podName string) {
 	t.Helper()
 	deadline := time.Now().Add(time.Second)
 	for time.Now().Before(deadline) {
 		pw.mu.Lock()
-		_, exists := pw.waiters[podName]
+		_, exists := pw.subscribers[podName]
 		pw.mu.Unlock()
 		if exists {
 			return
 		}
 		time.Sleep(10 * time.Millisecond)
 	}
-	t.Fatalf("timed out waiting for waiter %q to register", podName)
+	t.Fatalf("subscriber for %s was not registered", podName)
 }
 
-func waitForWaiterRemoval(t *testing.T, pw *PodWatcher, podName string) {
+func waitForCachedPod(t *testing.T, pw *PodWatcher, podName string) {
 	t.Helper()
-	deadline := time.Now().Add(time.Second)
+	deadline := time.Now().Add(2 * time.Second)
 	for time.Now().Before(deadline) {
-		pw.mu.Lock()
-		_, exists := pw.waiters[podName]
-		pw.mu.Unlock()
-		if !exists {
+		if _, ok := pw.Get(podName); ok {
 			return
 		}
 		time.Sleep(10 * time.Millisecond)
 	}
-	t.Fatalf("timed out waiting for waiter %q to be removed", podName)
+	t.Fatalf("pod %s was not cached", podName)
+}
+
+func TestPodStartupError(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        apiv1.PodStatus
+		wantContainer string
+		wantReason    string
+	}{
+		{
+			name:   "pending",
+			status: apiv1.PodStatus{Phase: apiv1.PodPending, ContainerStatuses: []apiv1.ContainerStatus{{Name: "target", State: apiv1.ContainerState{Waiting: &apiv1.ContainerStateWaiting{Reason: "ContainerCreating"}}}}},
+		},
+		{
+			name: "unschedulable",
+			status: apiv1.PodStatus{Phase: apiv1.PodPending, Conditions: []apiv1.PodCondition{
+				{Type: apiv1.PodScheduled, Status: apiv1.ConditionFalse, Reason: apiv1.PodReasonUnschedulable,
+					Message: "0/2 nodes are available: 1 node(s) didn't match Pod's node affinity/selector, 1 node(s) had untolerated taint {node-role.kubernetes.io/control-plane: }. preemption: 0/2 nodes are available: 2 Preemption is not helpful for scheduling."},
+			}},
+			wantReason: "Unschedulable",
+		},
+		{
+			name: "insufficient cpu",
+			status: apiv1.PodStatus{Phase: apiv1.PodPending, Conditions: []apiv1.PodCondition{
+				{Type: apiv1.PodScheduled, Status: apiv1.ConditionFalse, Reason: apiv1.PodReasonUnschedulable,
+					Message: "0/2 nodes are available: 1 Insufficient cpu, 1 node(s) didn't match Pod's node affinity/selector. preemption: 0/2 nodes are available: 1 No preemption victims found for incoming pod, 1 Preemption is not helpful for scheduling."},
+			}},
+		},
+		{
+			name: "node not ready",
+			status: apiv1.PodStatus{Phase: apiv1.PodPending, Conditions: []apiv1.PodCondition{
+				{Type: apiv1.PodScheduled, Status: apiv1.ConditionFalse, Reason: apiv1.PodReasonUnschedulable,
+					Message: "0/1 nodes are available: 1 node(s) had untolerated taint {node.kubernetes.io/not-ready: }."},
+			}},
+		},
+		{
+			name: "init container failed",
+			status: apiv1.PodStatus{Phase: apiv1.PodPending, InitContainerStatuses: []apiv1.ContainerStatus{
+				{Name: "init-tc", State: apiv1.ContainerState{Terminated: &apiv1.ContainerStateTerminated{ExitCode: 2, Reason: "Error"}}},
+			}},
+			wantContainer: "init-tc",
+			wantReason:    "Error",
+		},
+		{
+			name: "init container done",
+			status: apiv1.PodStatus{Phase: apiv1.PodPending, InitContainerStatuses: []apiv1.ContainerStatus{
+				{Name: "init-tc", State: apiv1.ContainerState{Terminated: &apiv1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}}},
+			}},
+		},
+		{
+			name: "crash loop",
+			status: apiv1.PodStatus{Phase: apiv1.PodRunning, ContainerStatuses: []apiv1.ContainerStatus{
+				{Name: "attacker", State: apiv1.ContainerState{Waiting: &apiv1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			}},
+			wantContainer: "attacker",
+			wantReason:    "CrashLoopBackOff",
+		},
+		{
+			name:       "failed",
+			status:     apiv1.PodStatus{Phase: apiv1.PodFailed, Reason: "Evicted"},
+			wantReason: "Evicted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := podStartupError(&apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-a"}, Status: tt.status})
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("podStartupError = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("podStartupError = nil, want reason %s", tt.wantReason)
+			}
+			if err.Container != tt.wantContainer || err.Reason != tt.wantReason {
+				t.Fatalf("podStartupError = %+v, want container %q and reason %q", err, tt.wantContainer, tt.wantReason)
+			}
+		})
+	}
 }
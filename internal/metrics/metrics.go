@@ -0,0 +1,275 @@
+// Package metrics exposes the progress of a concap run in the Prometheus text exposition format.
+// It implements the counters, gauges and histograms concap needs without depending on the Prometheus client.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics of a concap run
+var (
+	ScenariosQueued    = NewGauge("concap_scenarios_queued", "Scenarios waiting for a worker.")
+	ScenariosRunning   = NewGauge("concap_scenarios_running", "Scenarios being executed.")
+	ScenariosSucceeded = NewCounter("concap_scenarios_succeeded_total", "Scenarios that completed successfully.")
+	ScenariosFailed    = NewCounter("concap_scenarios_failed_total", "Scenarios that failed.")
+	ScenariosSkipped   = NewCounter("concap_scenarios_skipped_total", "Scenarios skipped because their output was complete.")
+	PhaseDuration      = NewHistogram("concap_phase_duration_seconds", "Duration of the phases of a scenario run.",
+		[]float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 3600}, "phase")
+	PodReadyWait = NewHistogram("concap_pod_ready_wait_seconds", "Time spent waiting for a pod to become ready.",
+		[]float64{1, 2, 5, 10, 20, 30, 60, 120, 300, 600})
+	PodStartupFailures = NewCounter("concap_pod_startup_failures_total", "Pods that failed before becoming ready.", "reason")
+	CapturedPackets    = NewCounter("concap_captured_packets_total", "Packets captured on the targets.")
+	CapturedBytes      = NewCounter("concap_captured_bytes_total", "Bytes captured on the targets.")
+	FileCopyFailures   = NewCounter("concap_file_copy_failures_total", "Failed file copies between concap and pods.", "direction")
+	TransferredBytes   = NewCounter("concap_transferred_bytes_total", "Bytes copied between concap and pods.", "direction")
+	UnverifiedCopies   = NewCounter("concap_unverified_copies_total", "File copies without checksum verification.", "direction")
+	defaultCollectors  = []collector{
+		ScenariosQueued, ScenariosRunning, ScenariosSucceeded, ScenariosFailed, ScenariosSkipped,
+		PhaseDuration, PodReadyWait, PodStartupFailures, CapturedPackets, CapturedBytes, FileCopyFailures, TransferredBytes,
+		UnverifiedCopies,
+	}
+)
+
+type collector interface {
+	write(w io.Writer) error
+}
+
+// WriteText writes all concap metrics in the Prometheus text exposition format
+func WriteText(w io.Writer) error {
+	for _, c := range defaultCollectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// family holds the series of a metric, keyed by their label values
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// Histograms only
+	bucketCounts []uint64
+	count        uint64
+}
+
+func newFamily(name, help, kind string, labelNames []string) *family {
+	return &family{name: name, help: help, kind: kind, labelNames: labelNames, series: make(map[string]*series)}
+}
+
+// get returns the series of the label values, creating it if needed. The caller holds f.mu.
+func (f *family) get(labelValues []string, buckets int) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...), bucketCounts: make([]uint64, buckets)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by their label values so that the output is stable. The caller holds f.mu.
+func (f *family) sorted() []*series {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sorted := make([]*series, len(keys))
+	for i, key := range keys {
+		sorted[i] = f.series[key]
+	}
+	return sorted
+}
+
+func (f *family) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	return err
+}
+
+// writeSimple writes the single value of every series of a counter or gauge
+func (f *family) writeSimple(w io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writeHeader(w); err != nil {
+		return err
+	}
+	if len(f.labelNames) == 0 && len(f.series) == 0 {
+		// A metric without labels is always exposed, also before its first update
+		_, err := fmt.Fprintf(w, "%s 0\n", f.name)
+		return err
+	}
+	for _, s := range f.sorted() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), formatValue(s.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counter is a metric that only goes up
+type Counter struct {
+	*family
+}
+
+// NewCounter returns a counter with the given label names
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	return &Counter{newFamily(name, help, "counter", labelNames)}
+}
+
+// Add increases the counter of the label values by v, which must not be negative
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.name))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(labelValues, 0).value += v
+}
+
+// Inc increases the counter of the label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) write(w io.Writer) error {
+	return c.writeSimple(w)
+}
+
+// Gauge is a metric that can go up and down
+type Gauge struct {
+	*family
+}
+
+// NewGauge returns a gauge with the given label names
+func NewGauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{newFamily(name, help, "gauge", labelNames)}
+}
+
+// Set sets the gauge of the label values to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(labelValues, 0).value = v
+}
+
+// Add changes the gauge of the label values by v
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(labelValues, 0).value += v
+}
+
+// Inc increases the gauge of the label values by one
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec decreases the gauge of the label values by one
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	return g.writeSimple(w)
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	*family
+	buckets []float64
+}
+
+// NewHistogram returns a histogram with the given upper bounds, in increasing order, and label names
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	return &Histogram{family: newFamily(name, help, "histogram", labelNames), buckets: buckets}
+}
+
+// Observe adds an observation to the histogram of the label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues, len(h.buckets))
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.bucketCounts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	for _, s := range h.sorted() {
+		for i, bound := range h.buckets {
+			labels := formatLabels(h.labelNames, s.labelValues, "le", formatValue(bound))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, s.bucketCounts[i]); err != nil {
+				return err
+			}
+		}
+		labels := formatLabels(h.labelNames, s.labelValues, "le", "+Inf")
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, s.count); err != nil {
+			return err
+		}
+		labels = formatLabels(h.labelNames, s.labelValues, "", "")
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", h.name, labels, formatValue(s.value), h.name, labels, s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLabels formats the label pairs of a series, with an optional extra label such as the bucket bound
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterAndGaugeText(t *testing.T) {
+	counter := NewCounter("test_copies_total", "Copies.", "direction")
+	counter.Inc("upload")
+	counter.Add(2, "download")
+	counter.Inc("up\"load\n")
+	gauge := NewGauge("test_running", "Running.")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	unused := NewGauge("test_queued", "Queued.")
+
+	var b bytes.Buffer
+	for _, c := range []collector{counter, gauge, unused} {
+		if err := c.write(&b); err != nil {
+			t.Fatalf("write() error = %v", err)
+		}
+	}
+	want := `# HELP test_copies_total Copies.
+# TYPE test_copies_total counter
+test_copies_total{direction="download"} 2
+test_copies_total{direction="up\"load\n"} 1
+test_copies_total{direction="upload"} 1
+# HELP test_running Running.
+# TYPE test_running gauge
+test_running 1
+# HELP test_queued Queued.
+# TYPE test_queued gauge
+test_queued 0
+`
+	if got := b.String(); got != want {
+		t.Fatalf("text =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramText(t *testing.T) {
+	histogram := NewHistogram("test_duration_seconds", "Duration.", []float64{1, 10}, "phase")
+	histogram.Observe(0.5, "deploy")
+	histogram.Observe(5, "deploy")
+	histogram.Observe(30, "deploy")
+
+	var b bytes.Buffer
+	if err := histogram.write(&b); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	want := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{phase="deploy",le="1"} 1
+test_duration_seconds_bucket{phase="deploy",le="10"} 2
+test_duration_seconds_bucket{phase="deploy",le="+Inf"} 3
+test_duration_seconds_sum{phase="deploy"} 35.5
+test_duration_seconds_count{phase="deploy"} 3
+`
+	if got := b.String(); got != want {
+		t.Fatalf("text =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHandlerServesAllMetrics(t *testing.T) {
+	FileCopyFailures.Inc("download")
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q, want the text exposition format", got)
+	}
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"concap_scenarios_queued 0",
+		"concap_scenarios_succeeded_total 0",
+		"# TYPE concap_phase_duration_seconds histogram",
+		"# TYPE concap_pod_ready_wait_seconds histogram",
+		"concap_captured_bytes_total 0",
+		`concap_file_copy_failures_total{direction="download"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package scenarios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	// BackgroundPodSuffix is the suffix used for background client pod names
+	BackgroundPodSuffix = "-B"
+	// LabelBackgroundPod is the label value for background client pods
+	LabelBackgroundPod = "background-pod"
+
+	backgroundLogPath = "/logs/background.log"
+	backgroundPidPath = "/logs/background.pid"
+)
+
+// BackgroundClient generates benign traffic, such as HTTP browsing, DNS lookups or SSH sessions,
+// against the targets while the attack runs. Its flows are labeled benign.
+type BackgroundClient struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
+	// Command runs for the duration of the attack and is stopped afterwards
+	Command    string `yaml:"command"`
+	CPURequest string `yaml:"cpuRequest"`
+	CPULimit   string `yaml:"cpuLimit"`
+	MemRequest string `yaml:"memRequest"`
+	MemLimit   string `yaml:"memLimit"`
+	// Network configuration for this client, merged with the global network configuration
+	Network Network `yaml:"network,omitempty"`
+	// TCCommands are the tc commands that shaped the traffic of the pod, recorded after deployment
+	TCCommands []string `yaml:"tcCommands,omitempty"`
+}
+
+// prepareBackgroundClients validates the background clients and applies their defaults
+func prepareBackgroundClients(clients []BackgroundClient, network Network) error {
+	names := make(map[string]bool, len(clients))
+	for i := range clients {
+		client := &clients[i]
+		if client.Name == "" {
+			client.Name = fmt.Sprintf("Background-%d", i)
+		}
+		if names[CleanPodName(client.Name)] {
+			return fmt.Errorf("duplicate background client name: '%s'", client.Name)
+		}
+		names[CleanPodName(client.Name)] = true
+
+		if client.Image == "" {
+			return fmt.Errorf("no image provided for background client: '%s'", client.Name)
+		}
+		if strings.TrimSpace(client.Command) == "" {
+			return fmt.Errorf("no command provided for background client: '%s'", client.Name)
+		}
+		if client.CPURequest == "" {
+			client.CPURequest = "100m"
+		}
+		if client.MemRequest == "" {
+			client.MemRequest = "250Mi"
+		}
+
+		// Client-specific configuration takes precedence over global configuration
+		client.Network = MergeNetworks(network, client.Network)
+	}
+	return nil
+}
+
+// BuildBackgroundPod creates a pod definition for a background client. Background pods are scheduled
+// on attacker nodes so that their traffic crosses the same network path as the attack.
+func BuildBackgroundPod(client BackgroundClient, scenarioName string, index int) *apiv1.Pod {
+	pod := BuildAttackerPod(client.Name, Attacker{
+		Name:       client.Name,
+		Image:      client.Image,
+		CPURequest: client.CPURequest,
+		CPULimit:   client.CPULimit,
+		MemRequest: client.MemRequest,
+		MemLimit:   client.MemLimit,
+		Network:    client.Network,
+	}, scenarioName)
+	pod.Name = CleanPodName(fmt.Sprintf("%s%s-%d", scenarioName, BackgroundPodSuffix, index))
+	pod.Labels[LabelConcap] = LabelBackgroundPod
+	return pod
+}
+
+// backgroundEnvVars returns the environment variables for the background client commands
+func backgroundEnvVars(targetPodSpecs []kubeapi.RunningPodSpec) map[string]string {
+	envVars := make(map[string]string)
+	var targetIPs []string
+	for i, targetPodSpec := range targetPodSpecs {
+		envVars[fmt.Sprintf("TARGET_IP_%d", i)] = targetPodSpec.PodIP
+		targetIPs = append(targetIPs, targetPodSpec.PodIP)
+	}
+	if len(targetIPs) > 0 {
+		envVars["TARGET_IP"] = targetIPs[0]
+	}
+	envVars["TARGET_IPS"] = strings.Join(targetIPs, ",")
+	return envVars
+}
+
+// backgroundFilterReplacements returns the tcpdump filter placeholders of the background clients.
+// Indexed placeholders are added from the highest index down, see GetTrafficFilterForTarget.
+func backgroundFilterReplacements(backgroundPodSpecs []kubeapi.RunningPodSpec) []string {
+	var replacements, hosts []string
+	for i := len(backgroundPodSpecs) - 1; i >= 0; i-- {
+		replacements = append(replacements, fmt.Sprintf("$BACKGROUND_IP_%d", i), backgroundPodSpecs[i].PodIP)
+		hosts = append([]string{"host " + backgroundPodSpecs[i].PodIP}, hosts...)
+	}
+	return append(replacements, "$BACKGROUND_HOSTS", strings.Join(hosts, " or "))
+}
+
+// startBackgroundTraffic starts the command of every background client detached from the exec session
+func startBackgroundTraffic(ctx context.Context, clients []BackgroundClient, podSpecs []kubeapi.RunningPodSpec, targetPodSpecs []kubeapi.RunningPodSpec) error {
+	var errs []error
+	for i, podSpec := range podSpecs {
+		envVars := backgroundEnvVars(targetPodSpecs)
+		envVars["BACKGROUND_COMMAND"] = clients[i].Command
+		log.Printf("Starting background traffic '%v' in pod %v", clients[i].Command, podSpec.PodName)
+		// setsid places the command in its own process group so that all of its children can be stopped
+		_, stde, err := kubeapi.ExecShellInContainerWithEnvVars(ctx, kubeapi.WorkloadNamespace, podSpec.PodName, podSpec.ContainerName,
+			`setsid sh -c "$BACKGROUND_COMMAND" > `+backgroundLogPath+` 2>&1 & echo $! > `+backgroundPidPath, envVars)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("start background client %s: %w", clients[i].Name, err))
+			continue
+		}
+		if stde != "" {
+			log.Printf("background client %s stderr: %s", clients[i].Name, stde)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stopBackgroundTraffic stops the command of every background client
+func stopBackgroundTraffic(ctx context.Context, clients []BackgroundClient, podSpecs []kubeapi.RunningPodSpec) error {
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(podSpecs))
+	for i, podSpec := range podSpecs {
+		wg.Add(1)
+		go func(name string, podSpec kubeapi.RunningPodSpec) {
+			defer wg.Done()
+			_, _, err := kubeapi.ExecShellInContainer(ctx, kubeapi.WorkloadNamespace, podSpec.PodName, podSpec.ContainerName,
+				`pid=$(cat `+backgroundPidPath+`) && { kill -TERM -- -"$pid" 2>/dev/null || kill -TERM "$pid" 2>/dev/null || true; }`)
+			if err != nil {
+				errCh <- fmt.Errorf("stop background client %s: %w", name, err)
+			}
+		}(clients[i].Name, podSpec)
+	}
+	wg.Wait()
+	close(errCh)
+	return errors.Join(collectErrors(errCh)...)
+}
+
+// runWithBackgroundTraffic runs attack while the background clients generate traffic
+func runWithBackgroundTraffic(ctx context.Context, clients []BackgroundClient, podSpecs, targetPodSpecs []kubeapi.RunningPodSpec, attack func() error) error {
+	if len(podSpecs) == 0 {
+		return attack()
+	}
+	if err := startBackgroundTraffic(ctx, clients, podSpecs, targetPodSpecs); err != nil {
+		// Stop the clients that did start
+		if stopErr := stopBackgroundTraffic(ctx, clients, podSpecs); stopErr != nil {
+			log.Printf("warning: %v", stopErr)
+		}
+		return err
+	}
+
+	attackErr := attack()
+	// Stop the clients even if the attack was cancelled, they would otherwise run until pod deletion
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	if err := stopBackgroundTraffic(stopCtx, clients, podSpecs); err != nil {
+		log.Printf("warning: %v", err)
+	}
+	return attackErr
+}
+
+// downloadBackgroundLogs downloads the output log of every background client, failures are not fatal
+func downloadBackgroundLogs(ctx context.Context, outputDir, prefix string, clients []BackgroundClient, podSpecs []kubeapi.RunningPodSpec) {
+	for i, podSpec := range podSpecs {
+		logPath := filepath.Join(outputDir, prefix+"background-"+CleanPodName(clients[i].Name)+".log")
+		if err := kubeapi.CopyFileFromPod(ctx, podSpec.PodName, podSpec.ContainerName, backgroundLogPath, logPath, true); err != nil {
+			log.Printf("warning: failed to download background log from pod %s: %v", podSpec.PodName, err)
+		}
+	}
+}
+
+// backgroundPodIPs returns the background client names mapped onto their pod IPs
+func backgroundPodIPs(podSpecs []kubeapi.RunningPodSpec) map[string]string {
+	ips := make(map[string]string, len(podSpecs))
+	for _, podSpec := range podSpecs {
+		ips[podSpec.ContainerName] = podSpec.PodIP
+	}
+	return ips
+}
+
+// deployBackgroundPods deploys the pods of all background clients concurrently and waits for them to be ready
+func deployBackgroundPods(ctx context.Context, scenarioName string, clients []BackgroundClient) ([]kubeapi.RunningPodSpec, error) {
+	podSpecs := make([]kubeapi.RunningPodSpec, len(clients))
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(clients))
+	for i := range clients {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			podSpec, err := kubeapi.CreateReadyPod(ctx, BuildBackgroundPod(clients[index], scenarioName, index))
+			if err != nil {
+				errCh <- fmt.Errorf("failed to deploy background pod %s: %w", clients[index].Name, err)
+				return
+			}
+			podSpecs[index] = podSpec
+		}(i)
+	}
+	wg.Wait()
+	close(errCh)
+	return podSpecs, errors.Join(collectErrors(errCh)...)
+}
@@ -0,0 +1,79 @@
+package scenarios
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+)
+
+func TestBuildBackgroundPodRunsOnAttackerNodes(t *testing.T) {
+	pod := BuildBackgroundPod(BackgroundClient{
+		Name:       "browser",
+		Image:      "curlimages/curl:latest",
+		CPURequest: "100m",
+		MemRequest: "128Mi",
+	}, "scenario-a", 1)
+	assertPodRuntimeContract(t, pod, NodeRoleAttacker)
+
+	if got, want := pod.Name, "scenario-a-b-1"; got != want {
+		t.Fatalf("Name = %q, want %q", got, want)
+	}
+	if got, want := pod.Labels[LabelConcap], LabelBackgroundPod; got != want {
+		t.Fatalf("Labels[%q] = %q, want %q", LabelConcap, got, want)
+	}
+	if got, want := pod.Labels[LabelScenario], "scenario-a"; got != want {
+		t.Fatalf("Labels[%q] = %q, want %q", LabelScenario, got, want)
+	}
+}
+
+func TestSingleTargetBackgroundUsesBackgroundFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan-with-background.yaml")
+	scenario := `attacker:
+  name: nmap
+  image: instrumentisto/nmap:latest
+  atkCommand: nmap $TARGET_IP
+target:
+  name: httpd
+  image: httpd:2.4.38
+background:
+  - name: browser
+    image: curlimages/curl:latest
+    command: while true; do curl -s http://$TARGET_IP/ > /dev/null; sleep 1; done
+  - name: resolver
+    image: busybox:latest
+    command: while true; do nslookup example.com; sleep 5; done
+`
+	if err := os.WriteFile(path, []byte(scenario), 0644); err != nil {
+		t.Fatalf("write scenario: %v", err)
+	}
+
+	s := &SingleTargetScenario{}
+	if err := s.FromYAML(path); err != nil {
+		t.Fatalf("FromYAML returned error: %v", err)
+	}
+	if got, want := s.Target.Filter, DefaultBackgroundTcpdumpFilter; got != want {
+		t.Fatalf("Target.Filter = %q, want %q", got, want)
+	}
+
+	s.Deployment = SingleTargetDeployment{
+		AttackPodSpec: kubeapi.RunningPodSpec{PodIP: "10.0.0.1"},
+		TargetPodSpec: kubeapi.RunningPodSpec{PodIP: "10.0.0.2"},
+		BackgroundPodSpecs: []kubeapi.RunningPodSpec{
+			{PodIP: "10.0.0.3"},
+			{PodIP: "10.0.0.4"},
+		},
+	}
+	if got, want := s.GetTrafficFilter(), "host 10.0.0.2 and (host 10.0.0.1 or host 10.0.0.3 or host 10.0.0.4) and not arp"; got != want {
+		t.Fatalf("GetTrafficFilter() = %q, want %q", got, want)
+	}
+}
+
+func TestPrepareBackgroundClientsRejectsMissingCommand(t *testing.T) {
+	err := prepareBackgroundClients([]BackgroundClient{{Name: "idle", Image: "busybox:latest"}}, Network{})
+	if err == nil || !strings.Contains(err.Error(), "no command provided") {
+		t.Fatalf("prepareBackgroundClients error = %v, want missing command", err)
+	}
+}
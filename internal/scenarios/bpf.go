@@ -0,0 +1,303 @@
+package scenarios
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Keywords of the pcap-filter language used by ValidateBPFFilter
+var (
+	bpfProtocols = map[string]bool{
+		"ether": true, "fddi": true, "tr": true, "wlan": true, "ip": true, "ip6": true, "arp": true, "rarp": true,
+		"decnet": true, "tcp": true, "udp": true, "sctp": true, "icmp": true, "icmp6": true, "igmp": true,
+		"igrp": true, "pim": true, "ah": true, "esp": true, "vrrp": true, "carp": true, "atalk": true,
+		"aarp": true, "iso": true, "stp": true, "ipx": true, "netbeui": true, "lat": true, "mopdl": true,
+		"moprc": true, "sca": true, "clnp": true, "esis": true, "isis": true,
+	}
+	bpfDirections = map[string]bool{"src": true, "dst": true, "inbound": true, "outbound": true}
+	bpfTypes      = map[string]bool{"host": true, "net": true, "port": true, "portrange": true, "gateway": true, "proto": true}
+	// bpfStandalone are primitives that take no id
+	bpfStandalone = map[string]bool{"broadcast": true, "multicast": true, "vlan": true, "mpls": true, "pppoed": true, "pppoes": true}
+	// bpfLength are primitives that take a length
+	bpfLength = map[string]bool{"less": true, "greater": true, "len": true}
+
+	bpfNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// ValidateBPFFilter checks the syntax of a tcpdump capture filter. It covers the boolean structure
+// and the host, net, port and protocol primitives of the pcap-filter language; arithmetic
+// expressions such as tcp[13] & 2 != 0 are only checked for balanced brackets.
+func ValidateBPFFilter(filter string) error {
+	tokens, err := tokenizeBPF(filter)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil // An empty filter captures everything
+	}
+	p := &bpfParser{tokens: tokens}
+	if err := p.expression(); err != nil {
+		return err
+	}
+	if p.pos < len(p.tokens) {
+		return fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return nil
+}
+
+func tokenizeBPF(filter string) ([]string, error) {
+	var tokens []string
+	word := strings.Builder{}
+	brackets := 0
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for i := 0; i < len(filter); i++ {
+		c := filter[i]
+		switch {
+		case c == '[':
+			brackets++
+			word.WriteByte(c)
+		case c == ']':
+			brackets--
+			if brackets < 0 {
+				return nil, fmt.Errorf("unbalanced ']'")
+			}
+			word.WriteByte(c)
+		case brackets > 0:
+			word.WriteByte(c)
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		case c == '(' || c == ')':
+			flush()
+			tokens = append(tokens, string(c))
+		case (c == '&' || c == '|') && i+1 < len(filter) && filter[i+1] == c:
+			flush()
+			tokens = append(tokens, filter[i:i+2])
+			i++
+		case c == '!' && (i+1 >= len(filter) || filter[i+1] != '='):
+			flush()
+			tokens = append(tokens, "!")
+		default:
+			word.WriteByte(c)
+		}
+	}
+	if brackets > 0 {
+		return nil, fmt.Errorf("unbalanced '['")
+	}
+	flush()
+	return tokens, nil
+}
+
+type bpfParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *bpfParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func isBPFOperator(token string) bool {
+	switch token {
+	case "and", "or", "&&", "||":
+		return true
+	}
+	return false
+}
+
+// expression := term (operator term)*
+func (p *bpfParser) expression() error {
+	if err := p.term(); err != nil {
+		return err
+	}
+	for isBPFOperator(p.peek()) {
+		operator := p.tokens[p.pos]
+		p.pos++
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("missing expression after %q", operator)
+		}
+		if err := p.term(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// term := ("not" | "!") term | "(" expression ")" | primitive
+func (p *bpfParser) term() error {
+	switch token := p.peek(); token {
+	case "":
+		return fmt.Errorf("unexpected end of filter")
+	case "not", "!":
+		p.pos++
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("missing expression after %q", token)
+		}
+		return p.term()
+	case "(":
+		p.pos++
+		if p.peek() == ")" {
+			return fmt.Errorf("empty parentheses")
+		}
+		if err := p.expression(); err != nil {
+			return err
+		}
+		if p.peek() != ")" {
+			return fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return nil
+	case ")":
+		return fmt.Errorf("unexpected ')'")
+	default:
+		if isBPFOperator(token) {
+			return fmt.Errorf("unexpected %q", token)
+		}
+		return p.primitive()
+	}
+}
+
+// primitive := [proto] [dir] [type] id | proto | length primitives | relational expression
+func (p *bpfParser) primitive() error {
+	// Relational expressions on packet data are not parsed further
+	if end, ok := p.relational(); ok {
+		p.pos = end
+		return nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.tokens) && !isBPFOperator(p.tokens[p.pos]) && p.tokens[p.pos] != ")" && p.tokens[p.pos] != "(" {
+		p.pos++
+	}
+	words := p.tokens[start:p.pos]
+
+	if bpfLength[words[0]] {
+		if len(words) != 2 {
+			return fmt.Errorf("%q expects a single length", words[0])
+		}
+		if _, err := strconv.ParseUint(words[1], 10, 32); err != nil {
+			return fmt.Errorf("invalid length %q", words[1])
+		}
+		return nil
+	}
+	if bpfStandalone[words[0]] {
+		if len(words) > 2 {
+			return fmt.Errorf("unexpected %q after %s", words[2], words[0])
+		}
+		return nil
+	}
+
+	i := 0
+	proto := ""
+	if bpfProtocols[words[i]] {
+		proto = words[i]
+		i++
+	}
+	for i < len(words) && bpfDirections[words[i]] {
+		i++
+	}
+	kind := ""
+	if i < len(words) && bpfTypes[words[i]] {
+		kind = words[i]
+		i++
+	}
+	if i == len(words) {
+		// A protocol on its own is a valid primitive, qualifiers without an id are not
+		if i == 1 && proto != "" {
+			return nil
+		}
+		return fmt.Errorf("missing id after %q", strings.Join(words, " "))
+	}
+	if i != len(words)-1 {
+		return fmt.Errorf("unexpected %q in %q", words[i+1], strings.Join(words, " "))
+	}
+	return validateBPFId(kind, words[i])
+}
+
+// relational reports whether the primitive at the current position is a relational expression
+// such as tcp[tcpflags] & (tcp-syn|tcp-fin) != 0, and returns the position after it. Parentheses
+// inside the expression group arithmetic rather than primitives.
+func (p *bpfParser) relational() (int, bool) {
+	depth := 0
+	relational := false
+	end := p.pos
+	for ; end < len(p.tokens); end++ {
+		token := p.tokens[end]
+		if token == "(" {
+			depth++
+		} else if token == ")" {
+			if depth == 0 {
+				break
+			}
+			depth--
+		} else if isBPFOperator(token) && depth == 0 {
+			break
+		} else if strings.ContainsAny(token, "[=<>&|+*/%") {
+			relational = true
+		}
+	}
+	return end, relational && depth == 0
+}
+
+func validateBPFId(kind, id string) error {
+	switch kind {
+	case "port":
+		if !isBPFPort(id) {
+			return fmt.Errorf("invalid port %q", id)
+		}
+	case "portrange":
+		low, high, ok := strings.Cut(id, "-")
+		if !ok || !isBPFNumericPort(low) || !isBPFNumericPort(high) {
+			return fmt.Errorf("invalid port range %q", id)
+		}
+	case "net":
+		if _, _, err := net.ParseCIDR(id); err != nil && net.ParseIP(id) == nil && !isBPFPartialNet(id) {
+			return fmt.Errorf("invalid net %q", id)
+		}
+	case "proto":
+		if !bpfNamePattern.MatchString(strings.TrimPrefix(id, `\`)) {
+			return fmt.Errorf("invalid protocol %q", id)
+		}
+	default:
+		if _, err := net.ParseMAC(id); err == nil {
+			return nil
+		}
+		if net.ParseIP(id) == nil && !bpfNamePattern.MatchString(id) {
+			return fmt.Errorf("invalid host %q", id)
+		}
+	}
+	return nil
+}
+
+func isBPFNumericPort(port string) bool {
+	number, err := strconv.ParseUint(port, 10, 16)
+	return err == nil && number <= 65535
+}
+
+func isBPFPort(port string) bool {
+	return isBPFNumericPort(port) || (bpfNamePattern.MatchString(port) && !strings.ContainsAny(port, "0123456789."))
+}
+
+// isBPFPartialNet reports whether id is an abbreviated network such as 10 or 192.168
+func isBPFPartialNet(id string) bool {
+	parts := strings.Split(id, ".")
+	if len(parts) > 3 {
+		return false
+	}
+	for _, part := range parts {
+		if number, err := strconv.ParseUint(part, 10, 8); err != nil || number > 255 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package scenarios
+
+import "testing"
+
+func TestValidateBPFFilterAcceptsValidFilters(t *testing.T) {
+	filters := []string{
+		"",
+		"((dst host 10.0.0.1 and src host 10.0.1.1) or (dst host 10.0.1.1 and src host 10.0.0.1)) and not arp",
+		"host 10.0.1.1 and (host 10.0.0.1 or host 10.0.0.2) and not arp",
+		"tcp port 80 || udp dst port domain",
+		"src net 10.0.0.0/16 && !icmp",
+		"tcp portrange 8000-8080",
+		"ip proto \\tcp",
+		"ether host 0a:58:0a:f4:00:05",
+		"less 128 or greater 1500",
+		"tcp[tcpflags] & (tcp-syn|tcp-fin) != 0",
+		"vlan and host web-server",
+	}
+
+	for _, filter := range filters {
+		if err := ValidateBPFFilter(filter); err != nil {
+			t.Fatalf("ValidateBPFFilter(%q) = %v, want nil", filter, err)
+		}
+	}
+}
+
+func TestValidateBPFFilterRejectsInvalidFilters(t *testing.T) {
+	filters := []string{
+		"host",
+		"host 10.0.0.1 and",
+		"host 10.0.0.1 10.0.0.2",
+		"(host 10.0.0.1",
+		"host 10.0.0.1)",
+		"()",
+		"not",
+		"and host 10.0.0.1",
+		"tcp port 70000",
+		"portrange 80",
+		"src dst",
+		"less big",
+		"tcp[13 = 2",
+	}
+
+	for _, filter := range filters {
+		if err := ValidateBPFFilter(filter); err == nil {
+			t.Fatalf("ValidateBPFFilter(%q) = nil, want error", filter)
+		}
+	}
+}
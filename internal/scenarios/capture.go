@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 
 	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
 )
@@ -16,13 +18,18 @@ const (
 	ReordercapLogPath  = DataMountPath + "/reordercap.log"
 )
 
+// tcpdumpCommand returns the shell command that starts the capture in the tcpdump container
+func tcpdumpCommand(filter string) string {
+	return `nohup tcpdump --no-promiscuous-mode --immediate-mode --buffer-size=32768 --packet-buffered -n --interface=eth0 -w ` + RawPcapPath + ` "` + filter + `" > ` + TcpdumpLogPath + ` 2>&1 & echo $! > ` + TcpdumpPidPath
+}
+
 func startTcpdumpCapture(ctx context.Context, podName, filter string) error {
 	stdo, stde, err := kubeapi.ExecShellInContainer(
 		ctx,
 		kubeapi.WorkloadNamespace,
 		podName,
 		TcpdumpContainerName,
-		`nohup tcpdump --no-promiscuous-mode --immediate-mode --buffer-size=32768 --packet-buffered -n --interface=eth0 -w `+RawPcapPath+` "`+filter+`" > `+TcpdumpLogPath+` 2>&1 & echo $! > `+TcpdumpPidPath,
+		tcpdumpCommand(filter),
 	)
 	if err != nil {
 		return err
@@ -80,3 +87,28 @@ func reorderCapture(ctx context.Context, podName string) error {
 	}
 	return nil
 }
+
+// downloadTargetCapture stops the capture in a target pod and downloads the pcap files and capture
+// logs into targetDir, prefixing every file name with prefix.
+func downloadTargetCapture(ctx context.Context, podName, targetDir, prefix string) error {
+	if err := stopAndNormalizeCapture(ctx, podName); err != nil {
+		return fmt.Errorf("failed to stop tcpdump in target pod %s: %w", podName, err)
+	}
+
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory %s: %w", targetDir, err)
+	}
+
+	for _, file := range []struct{ container, path, name, description string }{
+		{TcpdumpContainerName, RawPcapPath, "dump.raw.pcap", "raw pcap file"},
+		{ReordercapContainerName, NormalizedPcapPath, "dump.pcap", "pcap file"},
+		{TcpdumpContainerName, TcpdumpLogPath, "tcpdump.log", "tcpdump log file"},
+		{ReordercapContainerName, ReordercapLogPath, "reordercap.log", "reordercap log file"},
+	} {
+		err := kubeapi.CopyFileFromPod(ctx, podName, file.container, file.path, filepath.Join(targetDir, prefix+file.name), true)
+		if err != nil {
+			return fmt.Errorf("failed to download %s from target pod %s: %w", file.description, podName, err)
+		}
+	}
+	return nil
+}
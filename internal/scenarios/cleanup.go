@@ -0,0 +1,61 @@
+package scenarios
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+)
+
+// Label selectors of the pods concap creates
+const (
+	// AllPodsSelector selects every pod concap created
+	AllPodsSelector = LabelConcap
+	// ProcessingPodsSelector selects the processing pods
+	ProcessingPodsSelector = LabelConcap + "=" + LabelProcessingPod
+)
+
+// ScenarioPodsSelector returns the label selector of the attacker and target pods of a scenario, including its
+// background clients, or of every scenario when scenarioName is empty
+func ScenarioPodsSelector(scenarioName string) string {
+	selector := fmt.Sprintf("%s in (%s,%s,%s)", LabelConcap, LabelAttackerPod, LabelTargetPod, LabelBackgroundPod)
+	if scenarioName != "" {
+		selector += "," + LabelScenario + "=" + scenarioName
+	}
+	return selector
+}
+
+// SessionPodsSelector returns the label selector of the attacker and target pods, including background clients,
+// created by the given controller sessions
+func SessionPodsSelector(sessions []string) string {
+	return fmt.Sprintf("%s,%s in (%s)", ScenarioPodsSelector(""), LabelSession, strings.Join(sessions, ","))
+}
+
+// DeletePodsBySelector deletes the pods that match the label selector and returns their names
+func DeletePodsBySelector(ctx context.Context, labelSelector string) ([]string, error) {
+	podNames, err := kubeapi.ListPods(ctx, labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("list pods matching %q: %w", labelSelector, err)
+	}
+	if err := deletePods(ctx, podNames); err != nil {
+		return podNames, err
+	}
+	return podNames, nil
+}
+
+// CollectDiagnostics saves the state, events and container logs of every pod of the scenario to dir, see
+// kubeapi.CollectPodDiagnostics. Failures are logged, so that they do not hide the result of the scenario.
+func (s *BaseScenario) CollectDiagnostics(ctx context.Context, dir string) {
+	podNames, err := kubeapi.ListPods(ctx, ScenarioPodsSelector(s.Name))
+	if err != nil {
+		log.Printf("Error: failed to list the pods of scenario %s for diagnostics: %v", s.Name, err)
+		return
+	}
+	for _, podName := range podNames {
+		if err := kubeapi.CollectPodDiagnostics(ctx, podName, dir); err != nil {
+			log.Printf("Error: failed to collect diagnostics of pod %s: %v", podName, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package scenarios
+
+import (
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestPodSelectorsMatchBuiltPods(t *testing.T) {
+	attacker := BuildAttackerPod("hydra", Attacker{Name: "hydra", Image: "example/hydra:latest", CPURequest: "100m", MemRequest: "128Mi"}, "scenario-a")
+	target := BuildTargetPod(TargetConfig{Name: "target", Image: "example/target:latest", CPURequest: "100m", MemRequest: "128Mi"}, "scenario-a", 0)
+	otherTarget := BuildTargetPod(TargetConfig{Name: "target", Image: "example/target:latest", CPURequest: "100m", MemRequest: "128Mi"}, "scenario-b", 0)
+	background := BuildBackgroundPod(BackgroundClient{Name: "browser", Image: "curlimages/curl:latest", CPURequest: "100m", MemRequest: "128Mi"}, "scenario-a", 0)
+	processing := ProcessingPodSpec(&ProcessingPod{Name: "cicflowmeter", ContainerImage: "example/cic:latest", CPURequest: "100m", MemRequest: "250Mi"})
+
+	tests := []struct {
+		selector string
+		matches  []*apiv1.Pod
+		rejects  []*apiv1.Pod
+	}{
+		{AllPodsSelector, []*apiv1.Pod{attacker, target, otherTarget, background, processing}, nil},
+		{ProcessingPodsSelector, []*apiv1.Pod{processing}, []*apiv1.Pod{attacker, target, background}},
+		{ScenarioPodsSelector(""), []*apiv1.Pod{attacker, target, otherTarget, background}, []*apiv1.Pod{processing}},
+		{ScenarioPodsSelector("scenario-a"), []*apiv1.Pod{attacker, target, background}, []*apiv1.Pod{otherTarget, processing}},
+	}
+	for _, tt := range tests {
+		selector, err := labels.Parse(tt.selector)
+		if err != nil {
+			t.Fatalf("parse selector %q: %v", tt.selector, err)
+		}
+		for _, pod := range tt.matches {
+			if !selector.Matches(labels.Set(pod.Labels)) {
+				t.Errorf("selector %q does not match pod %s", tt.selector, pod.Name)
+			}
+		}
+		for _, pod := range tt.rejects {
+			if selector.Matches(labels.Set(pod.Labels)) {
+				t.Errorf("selector %q matches pod %s", tt.selector, pod.Name)
+			}
+		}
+	}
+}
+
+func TestSessionPodsSelectorKeepsPodsOfLiveSessions(t *testing.T) {
+	defer func(session string) { Session = session }(Session)
+	Session = "crashed"
+	stale := BuildTargetPod(TargetConfig{Name: "target", Image: "example/target:latest", CPURequest: "100m", MemRequest: "128Mi"}, "scenario-a", 0)
+	Session = "serve"
+	live := BuildTargetPod(TargetConfig{Name: "target", Image: "example/target:latest", CPURequest: "100m", MemRequest: "128Mi"}, "scenario-b", 0)
+	liveBackground := BuildBackgroundPod(BackgroundClient{Name: "browser", Image: "curlimages/curl:latest", CPURequest: "100m", MemRequest: "128Mi"}, "scenario-b", 0)
+	Session = ""
+	unlabelled := BuildAttackerPod("hydra", Attacker{Name: "hydra", Image: "example/hydra:latest", CPURequest: "100m", MemRequest: "128Mi"}, "scenario-c")
+
+	selector, err := labels.Parse(SessionPodsSelector([]string{"crashed", "gone"}))
+	if err != nil {
+		t.Fatalf("parse selector: %v", err)
+	}
+	if !selector.Matches(labels.Set(stale.Labels)) {
+		t.Errorf("selector %s does not match the pod of the crashed session", selector)
+	}
+	for _, pod := range []*apiv1.Pod{live, liveBackground, unlabelled} {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			t.Errorf("selector %s matches pod %s with labels %v", selector, pod.Name, pod.Labels)
+		}
+	}
+}
@@ -18,9 +18,41 @@ func TestExampleScenariosParse(t *testing.T) {
 		path := path
 		t.Run(filepath.Base(path), func(t *testing.T) {
 			t.Parallel()
-			if _, err := CreateScenario(path); err != nil {
-				t.Fatalf("parse example scenario %s: %v", path, err)
+			sources, err := LoadScenarioSources(path)
+			if err != nil {
+				t.Fatalf("load example scenario %s: %v", path, err)
+			}
+			for _, source := range sources {
+				if _, err := CreateScenarioFromSource(source); err != nil {
+					t.Fatalf("parse example scenario %s: %v", source.Name, err)
+				}
+			}
+			for _, problem := range ValidateScenarioFile(path) {
+				if problem.Severity == SeverityError {
+					t.Errorf("validate example scenario: %s", problem)
+				}
 			}
 		})
 	}
 }
+
+func TestExampleProcessingPodsParse(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "example", "processingpods", "*.yaml"))
+	if err != nil {
+		t.Fatalf("glob example processing pods: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no example processing pods found")
+	}
+
+	for _, path := range paths {
+		if _, err := ReadProcessingPod(path); err != nil {
+			t.Fatalf("parse example processing pod %s: %v", path, err)
+		}
+		for _, problem := range ValidateProcessingPodFile(path) {
+			if problem.Severity == SeverityError {
+				t.Errorf("validate example processing pod: %s", problem)
+			}
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v2"
@@ -14,44 +15,117 @@ type ScenarioTypeConfig struct {
 	Type string `yaml:"type"`
 }
 
+// ScenarioSource is a concrete scenario definition: either a scenario file as is, or one
+// combination of the parameter values in the matrix of a scenario file.
+type ScenarioSource struct {
+	// Path of the scenario file the definition was read from
+	Path string
+	// Name of the scenario, derived from the file name
+	Name string
+	// YAML holds the scenario definition without the matrix block
+	YAML []byte
+	// Matrix holds the parameter values chosen for this definition, keyed by their dotted path
+	Matrix map[string]string
+	// Dir is the output directory relative to the completed directory, defaults to Name
+	Dir string
+	// Run is the number of this run out of Repeat runs of the same definition, both are 0 if it runs once
+	Run    int
+	Repeat int
+}
+
+// OutputDir returns the output directory of the source relative to the completed directory
+func (s ScenarioSource) OutputDir() string {
+	if s.Dir != "" {
+		return s.Dir
+	}
+	return s.Name
+}
+
 // CreateScenario creates a scenario of the appropriate type based on the YAML file
 func CreateScenario(filePath string) (ScenarioInterface, error) {
-	// First, read the file to determine the scenario type
-	fileHandler, err := os.Open(filePath)
+	sources, err := LoadScenarioSources(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+		return nil, err
 	}
-	defer fileHandler.Close()
+	if len(sources) != 1 {
+		return nil, fmt.Errorf("scenario file %s expands into %d scenarios, use LoadScenarioSources", filePath, len(sources))
+	}
+	return CreateScenarioFromSource(sources[0])
+}
 
-	b, err := io.ReadAll(fileHandler)
+// LoadScenarioSources reads a scenario file and expands its matrix, if any, into one source per
+// combination of parameter values.
+func LoadScenarioSources(filePath string) ([]ScenarioSource, error) {
+	b, err := readScenarioFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("error reading YAML: %w", err)
+		return nil, err
 	}
+	return expandMatrix(filePath, scenarioNameFromPath(filePath), b)
+}
 
+// CreateScenarioFromSource creates a scenario of the appropriate type from a scenario source
+func CreateScenarioFromSource(source ScenarioSource) (ScenarioInterface, error) {
 	// Parse the type field to determine the scenario type
 	var typeConfig ScenarioTypeConfig
-	err = yaml.Unmarshal(b, &typeConfig)
+	err := yaml.Unmarshal(source.YAML, &typeConfig)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling YAML to determine type: %w", err)
 	}
 
 	// Create the appropriate scenario type based on the type field
-	var scenario ScenarioInterface
+	var scenario interface {
+		ScenarioInterface
+		parseYAML(b []byte, name string) error
+		setMatrix(matrix map[string]string)
+		setRun(run, repeat int)
+		networks() []*Network
+	}
 	switch strings.ToLower(typeConfig.Type) {
 	case SingleTargetType:
 		scenario = &SingleTargetScenario{}
 	case MultiTargetType:
 		scenario = &MultiTargetScenario{}
+	case MultiAttackerType:
+		scenario = &MultiAttackerScenario{}
 	default:
 		// Default to single target if type is not specified or unknown
 		scenario = &SingleTargetScenario{}
 	}
 
-	// Parse the YAML file into the scenario
-	err = scenario.FromYAML(filePath)
+	// Parse the definition into the scenario
+	err = scenario.parseYAML(source.YAML, source.Name)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing YAML into scenario: %w", err)
 	}
+	if len(source.Matrix) > 0 {
+		scenario.setMatrix(source.Matrix)
+	}
+	if source.Run > 0 {
+		scenario.setRun(source.Run, source.Repeat)
+		if err := deriveRunSeeds(scenario.networks(), source.Run); err != nil {
+			return nil, fmt.Errorf("derive seed for run %d: %w", source.Run, err)
+		}
+	}
 
 	return scenario, nil
 }
+
+// readScenarioFile reads the contents of a scenario file
+func readScenarioFile(filePath string) ([]byte, error) {
+	fileHandler, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("open scenario file %s: %w", filePath, err)
+	}
+	defer fileHandler.Close()
+
+	b, err := io.ReadAll(fileHandler)
+	if err != nil {
+		return nil, fmt.Errorf("error reading YAML: %w", err)
+	}
+	return b, nil
+}
+
+// scenarioNameFromPath returns the scenario name for a scenario file, its base name without extension
+func scenarioNameFromPath(filePath string) string {
+	return strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+}
@@ -0,0 +1,343 @@
+package scenarios
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FlowLabelColumn holds the per-flow ground truth in labeled CSV files.
+	FlowLabelColumn = "flow_label"
+	// FlowLabelMalicious marks flows between an attacker and a target during the attack window.
+	FlowLabelMalicious = "malicious"
+	// FlowLabelBenign marks every other flow, such as probes, DNS and kubelet noise.
+	FlowLabelBenign = "benign"
+	// FlowLabelUnknown marks flows whose endpoints or timestamps cannot be parsed.
+	FlowLabelUnknown = "unknown"
+
+	// FlowWindowTolerance widens attack windows to absorb processors that report second precision timestamps.
+	FlowWindowTolerance = time.Second
+)
+
+// Time formats understood by FlowColumns in addition to Go time layouts
+const (
+	// TimeFormatEpochSeconds parses (fractional) seconds since the Unix epoch
+	TimeFormatEpochSeconds = "epoch-s"
+	// TimeFormatEpochMillis parses milliseconds since the Unix epoch
+	TimeFormatEpochMillis = "epoch-ms"
+	// TimeFormatEpochMicros parses microseconds since the Unix epoch
+	TimeFormatEpochMicros = "epoch-us"
+	// TimeFormatClock parses a time of day (HH:MM:SS.ffffff) on the UTC date of the attack
+	TimeFormatClock = "clock"
+)
+
+// FlowColumns maps the columns of a processor's CSV output onto the flow 5-tuple and time range.
+// End and Duration are alternatives; when both are empty a flow is treated as a single instant.
+type FlowColumns struct {
+	SrcIP      string `yaml:"srcIP"`
+	DstIP      string `yaml:"dstIP"`
+	SrcPort    string `yaml:"srcPort"`
+	DstPort    string `yaml:"dstPort"`
+	Protocol   string `yaml:"protocol"`
+	Start      string `yaml:"start"`
+	End        string `yaml:"end,omitempty"`
+	Duration   string `yaml:"duration,omitempty"`
+	TimeFormat string `yaml:"timeFormat"`
+	// DurationUnit is the unit of the Duration column: "ns", "us" (default), "ms" or "s"
+	DurationUnit string `yaml:"durationUnit,omitempty"`
+}
+
+// FlowFormats contains the column mappings of the supported flow exporters.
+var FlowFormats = map[string]FlowColumns{
+	"rustiflow": {
+		SrcIP:      "IP_SOURCE",
+		DstIP:      "IP_DESTINATION",
+		SrcPort:    "PORT_SOURCE",
+		DstPort:    "PORT_DESTINATION",
+		Protocol:   "PROTOCOL",
+		Start:      "FIRST_TIMESTAMP",
+		End:        "LAST_TIMESTAMP",
+		TimeFormat: "2006-01-02 15:04:05.999999999 MST",
+	},
+	"cicflowmeter": {
+		SrcIP:        "Src IP",
+		DstIP:        "Dst IP",
+		SrcPort:      "Src Port",
+		DstPort:      "Dst Port",
+		Protocol:     "Protocol",
+		Start:        "Timestamp",
+		Duration:     "Flow Duration",
+		TimeFormat:   "02/01/2006 03:04:05 PM",
+		DurationUnit: "us",
+	},
+	"nfstream": {
+		SrcIP:      "src_ip",
+		DstIP:      "dst_ip",
+		SrcPort:    "src_port",
+		DstPort:    "dst_port",
+		Protocol:   "protocol",
+		Start:      "bidirectional_first_seen_ms",
+		End:        "bidirectional_last_seen_ms",
+		TimeFormat: TimeFormatEpochMillis,
+	},
+	"argus": {
+		SrcIP:      "saddr",
+		DstIP:      "daddr",
+		SrcPort:    "sport",
+		DstPort:    "dport",
+		Protocol:   "proto",
+		Start:      "stime",
+		End:        "ltime",
+		TimeFormat: TimeFormatClock,
+	},
+}
+
+// FlowFormatNames returns the names of the supported flow exporters in alphabetical order.
+func FlowFormatNames() []string {
+	names := make([]string, 0, len(FlowFormats))
+	for name := range FlowFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DetectFlowColumns returns the first supported flow format whose columns are all present in the header.
+func DetectFlowColumns(header []string) (FlowColumns, string, bool) {
+	for _, name := range FlowFormatNames() {
+		columns := FlowFormats[name]
+		if _, err := columns.bind(header); err == nil {
+			return columns, name, true
+		}
+	}
+	return FlowColumns{}, "", false
+}
+
+// AttackWindow describes traffic between an attacker and a target during an attack.
+type AttackWindow struct {
+	AttackerIP string
+	TargetIP   string
+	Start      time.Time
+	Stop       time.Time
+	// Label is written to FlowLabelColumn for matching flows
+	Label string
+}
+
+// FlowLabeler assigns ground truth labels to flow records.
+type FlowLabeler struct {
+	Columns FlowColumns
+	Windows []AttackWindow
+}
+
+// flowRecordLabeler is a FlowLabeler bound to the column positions of a specific CSV header.
+type flowRecordLabeler struct {
+	labeler *FlowLabeler
+	index   flowColumnIndex
+	// anchor is the date used to resolve clock timestamps
+	anchor time.Time
+}
+
+type flowColumnIndex struct {
+	srcIP, dstIP, srcPort, dstPort, protocol int
+	start, end, duration                     int
+}
+
+// Validate checks that every required column mapping and the time format are set.
+func (c FlowColumns) Validate() error {
+	for _, mapping := range []struct{ field, column string }{
+		{"srcIP", c.SrcIP},
+		{"dstIP", c.DstIP},
+		{"srcPort", c.SrcPort},
+		{"dstPort", c.DstPort},
+		{"protocol", c.Protocol},
+		{"start", c.Start},
+	} {
+		if mapping.column == "" {
+			return fmt.Errorf("flow column %s is not mapped", mapping.field)
+		}
+	}
+	if c.End != "" && c.Duration != "" {
+		return fmt.Errorf("flow columns end and duration are mutually exclusive")
+	}
+	if c.TimeFormat == "" {
+		return fmt.Errorf("flow time format is not set")
+	}
+	if c.Duration != "" {
+		if _, err := durationUnit(c.DurationUnit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c FlowColumns) bind(header []string) (flowColumnIndex, error) {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if _, exists := positions[name]; !exists {
+			positions[name] = i
+		}
+	}
+
+	var index flowColumnIndex
+	for _, column := range []struct {
+		name     string
+		position *int
+	}{
+		{c.SrcIP, &index.srcIP},
+		{c.DstIP, &index.dstIP},
+		{c.SrcPort, &index.srcPort},
+		{c.DstPort, &index.dstPort},
+		{c.Protocol, &index.protocol},
+		{c.Start, &index.start},
+		{c.End, &index.end},
+		{c.Duration, &index.duration},
+	} {
+		*column.position = -1
+		if column.name == "" {
+			continue
+		}
+		position, ok := positions[column.name]
+		if !ok {
+			return flowColumnIndex{}, fmt.Errorf("column %q not found in CSV header", column.name)
+		}
+		*column.position = position
+	}
+	return index, nil
+}
+
+func (l *FlowLabeler) bind(header []string) (*flowRecordLabeler, error) {
+	if err := l.Columns.Validate(); err != nil {
+		return nil, err
+	}
+	index, err := l.Columns.bind(header)
+	if err != nil {
+		return nil, err
+	}
+	bound := &flowRecordLabeler{labeler: l, index: index}
+	for _, window := range l.Windows {
+		if !window.Start.IsZero() {
+			bound.anchor = window.Start.UTC()
+			break
+		}
+	}
+	return bound, nil
+}
+
+// Label returns the label of the first attack window the record belongs to, or FlowLabelBenign.
+func (b *flowRecordLabeler) Label(record []string) (string, error) {
+	field := func(index int) string {
+		if index < 0 || index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+
+	columns := b.labeler.Columns
+	start, err := parseFlowTime(field(b.index.start), columns.TimeFormat, b.anchor)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", columns.Start, err)
+	}
+	end := start
+	switch {
+	case b.index.end >= 0:
+		end, err = parseFlowTime(field(b.index.end), columns.TimeFormat, b.anchor)
+		if err != nil {
+			return "", fmt.Errorf("parse %s: %w", columns.End, err)
+		}
+		// Clock timestamps roll over at midnight
+		if columns.TimeFormat == TimeFormatClock && end.Before(start) {
+			end = end.Add(24 * time.Hour)
+		}
+	case b.index.duration >= 0:
+		duration, err := parseFlowDuration(field(b.index.duration), columns.DurationUnit)
+		if err != nil {
+			return "", fmt.Errorf("parse %s: %w", columns.Duration, err)
+		}
+		end = start.Add(duration)
+	}
+
+	srcIP, dstIP := field(b.index.srcIP), field(b.index.dstIP)
+	for _, window := range b.labeler.Windows {
+		if !window.matchesEndpoints(srcIP, dstIP) {
+			continue
+		}
+		if end.Before(window.Start.Add(-FlowWindowTolerance)) || start.After(window.Stop.Add(FlowWindowTolerance)) {
+			continue
+		}
+		if window.Label != "" {
+			return window.Label, nil
+		}
+		return FlowLabelMalicious, nil
+	}
+	return FlowLabelBenign, nil
+}
+
+func (w AttackWindow) matchesEndpoints(srcIP, dstIP string) bool {
+	if w.AttackerIP == "" || w.TargetIP == "" {
+		return false
+	}
+	return (srcIP == w.AttackerIP && dstIP == w.TargetIP) || (srcIP == w.TargetIP && dstIP == w.AttackerIP)
+}
+
+func parseFlowTime(value, format string, anchor time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("empty timestamp")
+	}
+	switch format {
+	case TimeFormatEpochSeconds, TimeFormatEpochMillis, TimeFormatEpochMicros:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		scale := map[string]float64{
+			TimeFormatEpochSeconds: 1e9,
+			TimeFormatEpochMillis:  1e6,
+			TimeFormatEpochMicros:  1e3,
+		}[format]
+		return time.Unix(0, int64(math.Round(number*scale))).UTC(), nil
+	case TimeFormatClock:
+		clock, err := time.Parse("15:04:05.999999999", value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		year, month, day := anchor.Date()
+		return time.Date(year, month, day, clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), time.UTC), nil
+	default:
+		return time.ParseInLocation(format, value, time.UTC)
+	}
+}
+
+func parseFlowDuration(value, unit string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	scale, err := durationUnit(unit)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(number * float64(scale)), nil
+}
+
+func durationUnit(unit string) (time.Duration, error) {
+	switch unit {
+	case "ns":
+		return time.Nanosecond, nil
+	case "us", "":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	default:
+		return 0, fmt.Errorf("invalid duration unit: %s", unit)
+	}
+}
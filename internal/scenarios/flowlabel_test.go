@@ -0,0 +1,158 @@
+package scenarios
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlowLabelerLabelsSupportedFormats(t *testing.T) {
+	start := time.Date(2024, 7, 26, 17, 46, 41, 0, time.UTC)
+	windows := []AttackWindow{{
+		AttackerIP: "10.0.0.1",
+		TargetIP:   "10.0.0.2",
+		Start:      start,
+		Stop:       start.Add(10 * time.Second),
+	}}
+
+	tests := []struct {
+		format string
+		csv    string
+		want   []string
+	}{
+		{
+			format: "rustiflow",
+			csv: "IP_SOURCE,PORT_SOURCE,IP_DESTINATION,PORT_DESTINATION,PROTOCOL,FIRST_TIMESTAMP,LAST_TIMESTAMP\n" +
+				"10.0.0.1,40363,10.0.0.2,443,6,2024-07-26 17:46:45.570650 UTC,2024-07-26 17:46:45.570660 UTC\n" +
+				"10.0.0.2,443,10.0.0.1,40363,6,2024-07-26 17:46:49.000000 UTC,2024-07-26 17:46:50.000000 UTC\n" +
+				"10.0.0.1,40363,10.0.0.2,443,6,2024-07-26 17:50:00.000000 UTC,2024-07-26 17:50:01.000000 UTC\n" +
+				"10.0.0.3,53,10.0.0.2,5353,17,2024-07-26 17:46:45.000000 UTC,2024-07-26 17:46:45.000000 UTC\n",
+			want: []string{FlowLabelMalicious, FlowLabelMalicious, FlowLabelBenign, FlowLabelBenign},
+		},
+		{
+			format: "cicflowmeter",
+			csv: "Flow ID,Src IP,Src Port,Dst IP,Dst Port,Protocol,Timestamp,Flow Duration\n" +
+				"a,10.0.0.1,40363,10.0.0.2,80,6,26/07/2024 05:46:30 PM,20000000\n" +
+				"b,10.0.0.1,40363,10.0.0.2,80,6,26/07/2024 05:46:00 PM,1000\n",
+			want: []string{FlowLabelMalicious, FlowLabelBenign},
+		},
+		{
+			format: "nfstream",
+			csv: "id,src_ip,src_port,dst_ip,dst_port,protocol,bidirectional_first_seen_ms,bidirectional_last_seen_ms\n" +
+				"0,10.0.0.2,80,10.0.0.1,40000,6,1722016005000,1722016006000\n" +
+				"1,10.0.0.2,80,10.0.0.1,40000,6,1722016100000,1722016101000\n",
+			want: []string{FlowLabelMalicious, FlowLabelBenign},
+		},
+		{
+			format: "argus",
+			csv: "stime,ltime,saddr,sport,daddr,dport,proto\n" +
+				"17:46:42.000001,17:46:43.500000,10.0.0.1,40000,10.0.0.2,80,tcp\n" +
+				"17:40:00.000000,17:40:01.000000,10.0.0.1,40000,10.0.0.2,80,tcp\n",
+			want: []string{FlowLabelMalicious, FlowLabelBenign},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var output bytes.Buffer
+			flows := &FlowLabeler{Columns: FlowFormats[tt.format], Windows: windows}
+			if err := labelCSV(strings.NewReader(tt.csv), &output, nil, flows); err != nil {
+				t.Fatalf("labelCSV returned error: %v", err)
+			}
+			if got := flowLabels(t, output.String()); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("flow labels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlowLabelerDetectsFormatFromHeader(t *testing.T) {
+	input := "src_ip,src_port,dst_ip,dst_port,protocol,bidirectional_first_seen_ms,bidirectional_last_seen_ms\n" +
+		"10.0.0.1,40000,10.0.0.2,80,6,1000,2000\n"
+	windows := []AttackWindow{{
+		AttackerIP: "10.0.0.1",
+		TargetIP:   "10.0.0.2",
+		Start:      time.UnixMilli(1500),
+		Stop:       time.UnixMilli(1600),
+	}}
+
+	var output bytes.Buffer
+	if err := labelCSV(strings.NewReader(input), &output, nil, &FlowLabeler{Windows: windows}); err != nil {
+		t.Fatalf("labelCSV returned error: %v", err)
+	}
+	if got := flowLabels(t, output.String()); len(got) != 1 || got[0] != FlowLabelMalicious {
+		t.Fatalf("flow labels = %v, want [%s]", got, FlowLabelMalicious)
+	}
+}
+
+func TestFlowLabelerSkipsUnknownFormats(t *testing.T) {
+	var output bytes.Buffer
+	if err := labelCSV(strings.NewReader("a,b\n1,2\n"), &output, nil, &FlowLabeler{}); err != nil {
+		t.Fatalf("labelCSV returned error: %v", err)
+	}
+	if got, want := output.String(), "a,b\n1,2\n"; got != want {
+		t.Fatalf("labeled CSV = %q, want %q", got, want)
+	}
+}
+
+func TestFlowLabelerLabelsUnparsableTimestampsUnknown(t *testing.T) {
+	input := "src_ip,src_port,dst_ip,dst_port,protocol,bidirectional_first_seen_ms,bidirectional_last_seen_ms\n" +
+		"10.0.0.1,40000,10.0.0.2,80,6,1000,2000\n" +
+		"10.0.0.1,40000,10.0.0.2,80,6,yesterday,2000\n" +
+		"10.0.0.3,40000,10.0.0.2,80,6,1000,2000\n"
+	windows := []AttackWindow{{
+		AttackerIP: "10.0.0.1",
+		TargetIP:   "10.0.0.2",
+		Start:      time.UnixMilli(1500),
+		Stop:       time.UnixMilli(1600),
+	}}
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "rustiflow.csv")
+	outputPath := filepath.Join(dir, "rustiflow"+LabeledCSVSuffix)
+	if err := os.WriteFile(inputPath, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	flows := &FlowLabeler{Columns: FlowFormats["nfstream"], Windows: windows}
+	if err := WriteLabeledCSV(inputPath, outputPath, nil, flows); err != nil {
+		t.Fatalf("WriteLabeledCSV returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("read labeled CSV: %v", err)
+	}
+	want := []string{FlowLabelMalicious, FlowLabelUnknown, FlowLabelBenign}
+	if got := flowLabels(t, string(data)); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("flow labels = %v, want %v", got, want)
+	}
+	if original, err := os.ReadFile(inputPath); err != nil || string(original) != input {
+		t.Fatalf("unlabeled output = %q, %v; want it unchanged", original, err)
+	}
+}
+
+func flowLabels(t *testing.T, data string) []string {
+	t.Helper()
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("parse labeled CSV: %v", err)
+	}
+	column := -1
+	for i, name := range records[0] {
+		if name == FlowLabelColumn {
+			column = i
+		}
+	}
+	if column < 0 {
+		t.Fatalf("labeled CSV header %v has no %s column", records[0], FlowLabelColumn)
+	}
+	var labels []string
+	for _, record := range records[1:] {
+		labels = append(labels, record[column])
+	}
+	return labels
+}
@@ -0,0 +1,198 @@
+package scenarios
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// LabeledCSVSuffix is appended to the processor name for the labeled copy of its output.
+	LabeledCSVSuffix = ".labeled.csv"
+	// ScenarioNameColumn holds the scenario name in labeled CSV files.
+	ScenarioNameColumn = "scenario_name"
+	// ScenarioUUIDColumn holds the scenario run UUID in labeled CSV files.
+	ScenarioUUIDColumn = "scenario_uuid"
+)
+
+// LabelColumn is a constant-valued column added to every row of a labeled CSV.
+type LabelColumn struct {
+	Name  string
+	Value string
+}
+
+// ScenarioLabelColumns returns the columns that identify the scenario run followed by the
+// target's merged labels in key order. Labels take precedence over the scenario columns.
+func ScenarioLabelColumns(scenarioName string, scenarioUUID uuid.UUID, labels map[string]string) []LabelColumn {
+	columns := []LabelColumn{
+		{Name: ScenarioNameColumn, Value: scenarioName},
+		{Name: ScenarioUUIDColumn, Value: scenarioUUID.String()},
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		columns = setLabelColumn(columns, key, labels[key])
+	}
+	return columns
+}
+
+func setLabelColumn(columns []LabelColumn, name, value string) []LabelColumn {
+	for i := range columns {
+		if columns[i].Name == name {
+			columns[i].Value = value
+			return columns
+		}
+	}
+	return append(columns, LabelColumn{Name: name, Value: value})
+}
+
+// LabelProcessorOutputs writes a labeled copy of every processor CSV found in dir. Each flow is
+// additionally labeled against the attack windows when the processor's flow columns are known.
+func LabelProcessorOutputs(dir string, processingPods []*ProcessingPod, columns []LabelColumn, windows []AttackWindow) error {
+	var errs []error
+	for _, pod := range processingPods {
+		inputPath := filepath.Join(dir, pod.Name+".csv")
+		outputPath := filepath.Join(dir, pod.Name+LabeledCSVSuffix)
+		flows := &FlowLabeler{Columns: pod.GetFlowColumns(), Windows: windows}
+		if err := WriteLabeledCSV(inputPath, outputPath, columns, flows); err != nil {
+			errs = append(errs, fmt.Errorf("label %s output: %w", pod.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteLabeledCSV copies the CSV at inputPath to outputPath with the label columns added to the
+// header and every row. A column that already exists in the processor output is overwritten in
+// place instead of being duplicated. When flows is not nil, every row also gets a FlowLabelColumn;
+// empty flow columns are detected from the CSV header.
+func WriteLabeledCSV(inputPath, outputPath string, columns []LabelColumn, flows *FlowLabeler) error {
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", inputPath, err)
+	}
+	defer input.Close()
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", outputPath, err)
+	}
+
+	if err := labelCSV(input, output, columns, flows); err != nil {
+		output.Close()
+		return fmt.Errorf("write %s: %w", outputPath, err)
+	}
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", outputPath, err)
+	}
+	return nil
+}
+
+func labelCSV(r io.Reader, w io.Writer, columns []LabelColumn, flows *FlowLabeler) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	writer := csv.NewWriter(w)
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+
+	// Bind the flow labeler before label columns are added to the header
+	var flowLabeler *flowRecordLabeler
+	if flows != nil {
+		if flows.Columns == (FlowColumns{}) {
+			detected, format, ok := DetectFlowColumns(header)
+			if !ok {
+				log.Printf("warning: unknown flow format, skipping flow labels (supported: %s)", strings.Join(FlowFormatNames(), ", "))
+			} else {
+				log.Printf("Detected %s flow format", format)
+				flows = &FlowLabeler{Columns: detected, Windows: flows.Windows}
+			}
+		}
+		if flows.Columns != (FlowColumns{}) {
+			flowLabeler, err = flows.bind(header)
+			if err != nil {
+				return fmt.Errorf("bind flow columns: %w", err)
+			}
+			columns = append(append([]LabelColumn(nil), columns...), LabelColumn{Name: FlowLabelColumn})
+		}
+	}
+
+	// Map every label column to its position, reusing existing header columns
+	positions := make([]int, len(columns))
+	existing := make(map[string]int, len(header))
+	for i, name := range header {
+		existing[name] = i
+	}
+	for i, column := range columns {
+		if index, ok := existing[column.Name]; ok {
+			positions[i] = index
+			continue
+		}
+		positions[i] = len(header)
+		header = append(header, column.Name)
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	unknown := 0
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read record: %w", err)
+		}
+
+		flowLabel := ""
+		if flowLabeler != nil {
+			if flowLabel, err = flowLabeler.Label(record); err != nil {
+				// A single malformed row should not cost the scenario its labeled output
+				if unknown == 0 {
+					log.Printf("warning: label flow on line %d: %v", line, err)
+				}
+				unknown++
+				flowLabel = FlowLabelUnknown
+			}
+		}
+
+		for len(record) < len(header) {
+			record = append(record, "")
+		}
+		for i, column := range columns {
+			record[positions[i]] = column.Value
+		}
+		if flowLabeler != nil {
+			record[positions[len(columns)-1]] = flowLabel
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	if unknown > 0 {
+		log.Printf("warning: %d flows could not be parsed and are labeled %s", unknown, FlowLabelUnknown)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,87 @@
+package scenarios
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestScenarioLabelColumnsOrdersLabelsAfterScenarioIdentity(t *testing.T) {
+	id := uuid.MustParse("00a0509e-3dd5-462f-a9ae-b2d7bc143c7f")
+	columns := ScenarioLabelColumns("nmap-scan", id, map[string]string{
+		"subcategory": "nmap",
+		"category":    "scanning",
+		"label":       "1",
+	})
+
+	want := []LabelColumn{
+		{Name: ScenarioNameColumn, Value: "nmap-scan"},
+		{Name: ScenarioUUIDColumn, Value: id.String()},
+		{Name: "category", Value: "scanning"},
+		{Name: "label", Value: "1"},
+		{Name: "subcategory", Value: "nmap"},
+	}
+	if len(columns) != len(want) {
+		t.Fatalf("ScenarioLabelColumns() = %#v, want %#v", columns, want)
+	}
+	for i := range want {
+		if columns[i] != want[i] {
+			t.Fatalf("ScenarioLabelColumns()[%d] = %#v, want %#v", i, columns[i], want[i])
+		}
+	}
+}
+
+func TestWriteLabeledCSVAppendsAndOverwritesColumns(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "argus.csv")
+	outputPath := filepath.Join(dir, "argus"+LabeledCSVSuffix)
+	input := "saddr,daddr,label\n10.0.0.1,10.0.0.2,\n10.0.0.2,10.0.0.1\n"
+	if err := os.WriteFile(inputPath, []byte(input), 0644); err != nil {
+		t.Fatalf("write input CSV: %v", err)
+	}
+
+	columns := []LabelColumn{
+		{Name: ScenarioNameColumn, Value: "scan"},
+		{Name: "label", Value: "1"},
+	}
+	if err := WriteLabeledCSV(inputPath, outputPath, columns, nil); err != nil {
+		t.Fatalf("WriteLabeledCSV returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("read labeled CSV: %v", err)
+	}
+	want := strings.Join([]string{
+		"saddr,daddr,label,scenario_name",
+		"10.0.0.1,10.0.0.2,1,scan",
+		"10.0.0.2,10.0.0.1,1,scan",
+		"",
+	}, "\n")
+	if got := string(data); got != want {
+		t.Fatalf("labeled CSV = %q, want %q", got, want)
+	}
+}
+
+func TestWriteLabeledCSVKeepsEmptyOutputEmpty(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "empty.csv")
+	outputPath := filepath.Join(dir, "empty"+LabeledCSVSuffix)
+	if err := os.WriteFile(inputPath, nil, 0644); err != nil {
+		t.Fatalf("write input CSV: %v", err)
+	}
+
+	if err := WriteLabeledCSV(inputPath, outputPath, []LabelColumn{{Name: "label", Value: "1"}}, nil); err != nil {
+		t.Fatalf("WriteLabeledCSV returned error: %v", err)
+	}
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("stat labeled CSV: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Fatalf("labeled CSV size = %d, want 0", info.Size())
+	}
+}
@@ -0,0 +1,177 @@
+package scenarios
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MatrixKey is the top-level scenario key holding the parameter sweep
+const MatrixKey = "matrix"
+
+// matrixParameter is one dotted path of the matrix with the values it takes
+type matrixParameter struct {
+	path   string
+	values []interface{}
+}
+
+// expandMatrix expands the matrix of a scenario definition into one source per combination of
+// parameter values. Parameters are ordered by path and the last path varies fastest, so the
+// numbering of the expanded scenarios only depends on the matrix itself.
+func expandMatrix(path, name string, b []byte) ([]ScenarioSource, error) {
+	_, matrix, err := splitMatrix(b)
+	if err != nil {
+		return nil, err
+	}
+	if matrix == nil {
+		return []ScenarioSource{{Path: path, Name: name, YAML: b}}, nil
+	}
+
+	parameters, err := parseMatrix(matrix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid matrix in %s: %w", path, err)
+	}
+
+	combinations := 1
+	for _, parameter := range parameters {
+		combinations *= len(parameter.values)
+	}
+
+	sources := make([]ScenarioSource, 0, combinations)
+	for i := 0; i < combinations; i++ {
+		// Decode the document again for every combination so that they do not share nested values
+		doc, _, err := splitMatrix(b)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(map[string]string, len(parameters))
+		rest := i
+		for j := len(parameters) - 1; j >= 0; j-- {
+			parameter := parameters[j]
+			value := parameter.values[rest%len(parameter.values)]
+			rest /= len(parameter.values)
+
+			updated, err := setYAMLPath(doc, strings.Split(parameter.path, "."), value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid matrix in %s: %s: %w", path, parameter.path, err)
+			}
+			doc = updated.(yaml.MapSlice)
+			values[parameter.path] = matrixValueString(value)
+		}
+
+		expanded, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("marshal expanded scenario %s: %w", path, err)
+		}
+		sources = append(sources, ScenarioSource{
+			Path:   path,
+			Name:   fmt.Sprintf("%s-%d", name, i),
+			YAML:   expanded,
+			Matrix: values,
+		})
+	}
+	return sources, nil
+}
+
+// splitMatrix decodes a scenario definition and removes its matrix block, which is nil if absent
+func splitMatrix(b []byte) (yaml.MapSlice, interface{}, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, nil, fmt.Errorf("error unmarshaling YAML: %w", err)
+	}
+	for i, item := range doc {
+		if item.Key == MatrixKey {
+			return append(doc[:i:i], doc[i+1:]...), item.Value, nil
+		}
+	}
+	return doc, nil, nil
+}
+
+func parseMatrix(matrix interface{}) ([]matrixParameter, error) {
+	items, ok := matrix.(yaml.MapSlice)
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("matrix must map parameter paths to lists of values")
+	}
+
+	parameters := make([]matrixParameter, 0, len(items))
+	for _, item := range items {
+		path, ok := item.Key.(string)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid parameter path %v", item.Key)
+		}
+		if path == MatrixKey || strings.HasPrefix(path, MatrixKey+".") {
+			return nil, fmt.Errorf("parameter %s cannot change the matrix", path)
+		}
+		values, ok := item.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			return nil, fmt.Errorf("parameter %s must have a non-empty list of values", path)
+		}
+		parameters = append(parameters, matrixParameter{path: path, values: values})
+	}
+
+	sort.Slice(parameters, func(i, j int) bool {
+		return parameters[i].path < parameters[j].path
+	})
+	return parameters, nil
+}
+
+// setYAMLPath sets the value at the dotted path in a decoded YAML node, creating missing mapping
+// keys. Numeric path segments index into lists.
+func setYAMLPath(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	segment := path[0]
+
+	switch n := node.(type) {
+	case nil:
+		return setYAMLPath(yaml.MapSlice{}, path, value)
+	case yaml.MapSlice:
+		for i := range n {
+			if fmt.Sprint(n[i].Key) == segment {
+				updated, err := setYAMLPath(n[i].Value, path[1:], value)
+				if err != nil {
+					return nil, err
+				}
+				n[i].Value = updated
+				return n, nil
+			}
+		}
+		updated, err := setYAMLPath(nil, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return append(n, yaml.MapItem{Key: segment, Value: updated}), nil
+	case []interface{}:
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 || index >= len(n) {
+			return nil, fmt.Errorf("list index %q out of range (0-%d)", segment, len(n)-1)
+		}
+		updated, err := setYAMLPath(n[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[index] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("%q is set on a scalar value", segment)
+	}
+}
+
+// matrixValueString formats a matrix value for the scenario output
+func matrixValueString(value interface{}) string {
+	switch value.(type) {
+	case yaml.MapSlice, []interface{}:
+		b, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return strings.TrimSpace(string(b))
+	default:
+		return fmt.Sprint(value)
+	}
+}
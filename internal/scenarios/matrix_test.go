@@ -0,0 +1,113 @@
+package scenarios
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const matrixScenario = `attacker:
+  name: nmap
+  image: instrumentisto/nmap:latest
+  atkCommand: nmap $TARGET_IP
+target:
+  name: httpd
+  image: httpd:2.4.38
+network:
+  delay: 1ms
+matrix:
+  network.loss: ["0%", "1%"]
+  attacker.atkCommand: ["nmap -sS $TARGET_IP", "nmap -sU $TARGET_IP"]
+  network.delay: [1ms, 10ms, 50ms]
+`
+
+func writeScenarioFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("write scenario: %v", err)
+	}
+	return path
+}
+
+func TestLoadScenarioSourcesExpandsMatrixDeterministically(t *testing.T) {
+	path := writeScenarioFile(t, "sweep.yaml", matrixScenario)
+
+	sources, err := LoadScenarioSources(path)
+	if err != nil {
+		t.Fatalf("LoadScenarioSources returned error: %v", err)
+	}
+	if len(sources) != 12 {
+		t.Fatalf("LoadScenarioSources returned %d sources, want 12", len(sources))
+	}
+
+	// Parameters are ordered by path and the last path varies fastest
+	for i, want := range []map[string]string{
+		{"attacker.atkCommand": "nmap -sS $TARGET_IP", "network.delay": "1ms", "network.loss": "0%"},
+		{"attacker.atkCommand": "nmap -sS $TARGET_IP", "network.delay": "1ms", "network.loss": "1%"},
+		{"attacker.atkCommand": "nmap -sS $TARGET_IP", "network.delay": "10ms", "network.loss": "0%"},
+	} {
+		for key, value := range want {
+			if got := sources[i].Matrix[key]; got != value {
+				t.Fatalf("sources[%d].Matrix[%s] = %q, want %q", i, key, got, value)
+			}
+		}
+	}
+
+	scenario, err := CreateScenarioFromSource(sources[11])
+	if err != nil {
+		t.Fatalf("CreateScenarioFromSource returned error: %v", err)
+	}
+	s := scenario.(*SingleTargetScenario)
+	if got, want := s.Name, "sweep-11"; got != want {
+		t.Fatalf("Name = %q, want %q", got, want)
+	}
+	if got, want := s.Target.Network.Delay, "50ms"; got != want {
+		t.Fatalf("Target.Network.Delay = %q, want %q", got, want)
+	}
+	if got, want := s.Target.Network.Loss, "1%"; got != want {
+		t.Fatalf("Target.Network.Loss = %q, want %q", got, want)
+	}
+	if !strings.Contains(s.Attacker.AtkCommand, "nmap -sU $TARGET_IP") {
+		t.Fatalf("Attacker.AtkCommand = %q, want the last matrix command", s.Attacker.AtkCommand)
+	}
+	if got, want := s.Matrix["network.delay"], "50ms"; got != want {
+		t.Fatalf("Matrix[network.delay] = %q, want %q", got, want)
+	}
+}
+
+func TestLoadScenarioSourcesWithoutMatrix(t *testing.T) {
+	path := writeScenarioFile(t, "plain.yaml", "attacker:\n  image: a\ntarget:\n  image: b\n")
+
+	sources, err := LoadScenarioSources(path)
+	if err != nil {
+		t.Fatalf("LoadScenarioSources returned error: %v", err)
+	}
+	if len(sources) != 1 || sources[0].Name != "plain" || sources[0].Matrix != nil {
+		t.Fatalf("LoadScenarioSources = %#v, want the file as single source", sources)
+	}
+}
+
+func TestLoadScenarioSourcesRejectsInvalidMatrix(t *testing.T) {
+	tests := []struct {
+		name   string
+		matrix string
+		want   string
+	}{
+		{name: "scalar values", matrix: "matrix:\n  network.delay: 1ms\n", want: "non-empty list"},
+		{name: "empty values", matrix: "matrix:\n  network.delay: []\n", want: "non-empty list"},
+		{name: "path through scalar", matrix: "matrix:\n  attacker.image.tag: [a]\n", want: "scalar"},
+		{name: "list index out of range", matrix: "matrix:\n  attacker.stages.3.name: [a]\n", want: "out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeScenarioFile(t, "invalid.yaml", "attacker:\n  image: a\n  stages: [x]\ntarget:\n  image: b\n"+tt.matrix)
+			_, err := LoadScenarioSources(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("LoadScenarioSources error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,579 @@
+package scenarios
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	"gopkg.in/yaml.v2"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// MultiAttackerScenario represents a scenario with several attackers and one or more targets
+type MultiAttackerScenario struct {
+	BaseScenario `yaml:",inline"`
+	Attackers    []Attacker     `yaml:"attackers"`
+	Targets      []TargetConfig `yaml:"targets"`
+	// Background clients generating benign traffic against the targets during the attack
+	Background []BackgroundClient `yaml:"background,omitempty"`
+	// Stagger delays the start of every attacker by this duration relative to the previous one.
+	// When empty all attackers start at the same time.
+	Stagger string `yaml:"stagger,omitempty"`
+	// Global network configuration, used as default for all attackers and targets
+	Network Network `yaml:"network,omitempty"`
+	// Global labels, applied to all targets
+	Labels     map[string]string       `yaml:"labels,omitempty"`
+	Deployment MultiAttackerDeployment `yaml:"deployment"`
+}
+
+type MultiAttackerDeployment struct {
+	AttackPodSpecs     []kubeapi.RunningPodSpec
+	TargetPodSpecs     []kubeapi.RunningPodSpec
+	BackgroundPodSpecs []kubeapi.RunningPodSpec
+}
+
+func (s MultiAttackerDeployment) MarshalYAML() (interface{}, error) {
+	attackerMap := map[string]string{}
+	for _, attacker := range s.AttackPodSpecs {
+		attackerMap[attacker.ContainerName] = attacker.PodIP
+	}
+
+	targetMap := map[string]string{}
+	for _, target := range s.TargetPodSpecs {
+		targetMap[target.ContainerName] = target.PodIP
+	}
+
+	result := map[string]interface{}{
+		"attackers": attackerMap,
+		"targets":   targetMap,
+	}
+	if len(s.BackgroundPodSpecs) > 0 {
+		result["background"] = backgroundPodIPs(s.BackgroundPodSpecs)
+	}
+	return result, nil
+}
+
+// FromYAML parses a YAML file into a MultiAttackerScenario
+func (s *MultiAttackerScenario) FromYAML(filePath string) error {
+	b, err := readScenarioFile(filePath)
+	if err != nil {
+		return err
+	}
+	return s.parseYAML(b, scenarioNameFromPath(filePath))
+}
+
+// parseYAML parses a scenario definition into a MultiAttackerScenario with the given name
+func (s *MultiAttackerScenario) parseYAML(b []byte, name string) error {
+	err := yaml.UnmarshalStrict(b, s)
+	if err != nil {
+		return fmt.Errorf("error unmarshaling YAML: %w", err)
+	}
+
+	if len(s.Attackers) == 0 {
+		return fmt.Errorf("no attackers provided")
+	}
+	if len(s.Targets) == 0 {
+		return fmt.Errorf("no targets provided")
+	}
+
+	if s.Stagger != "" {
+		if _, err := time.ParseDuration(s.Stagger); err != nil {
+			return fmt.Errorf("invalid stagger %q: %w", s.Stagger, err)
+		}
+	}
+
+	s.UUID = uuid.New()
+	s.Name = CleanPodName(name)
+
+	attackerNames := make(map[string]bool, len(s.Attackers))
+	for i := range s.Attackers {
+		attacker := &s.Attackers[i]
+		if attacker.Name == "" {
+			attacker.Name = fmt.Sprintf("Attacker-%d", i)
+		}
+		if attackerNames[CleanPodName(attacker.Name)] {
+			return fmt.Errorf("duplicate attacker name: '%s'", attacker.Name)
+		}
+		attackerNames[CleanPodName(attacker.Name)] = true
+
+		if attacker.Image == "" {
+			return fmt.Errorf("no attack-image provided for attack: '%s'", attacker.Name)
+		}
+
+		// Process attack time and wrap the attack command(s) in a timeout and the attack log
+		if err := prepareAttackCommands(attacker); err != nil {
+			return err
+		}
+
+		// Default resource requests for attackers
+		if attacker.CPURequest == "" {
+			attacker.CPURequest = "100m"
+		}
+		if attacker.MemRequest == "" {
+			attacker.MemRequest = "250Mi"
+		}
+
+		// Merge the global network configuration with the attacker-specific one
+		// Attacker-specific configuration takes precedence over global configuration
+		attacker.Network = MergeNetworks(s.Network, attacker.Network)
+	}
+
+	if err := prepareBackgroundClients(s.Background, s.Network); err != nil {
+		return err
+	}
+
+	// Set default filter and resource requests for each target
+	for i := range s.Targets {
+		if s.Targets[i].Name == "" {
+			s.Targets[i].Name = fmt.Sprintf("Target-%d", i)
+		}
+
+		if s.Targets[i].Filter == "" {
+			s.Targets[i].Filter = DefaultMultiAttackerTcpdumpFilter
+			if len(s.Background) > 0 {
+				s.Targets[i].Filter = DefaultMultiAttackerBackgroundTcpdumpFilter
+			}
+		}
+		if s.Targets[i].CPURequest == "" {
+			s.Targets[i].CPURequest = "100m"
+		}
+		if s.Targets[i].MemRequest == "" {
+			s.Targets[i].MemRequest = "250Mi"
+		}
+
+		// Merge the global network configuration with the target-specific one
+		// Target-specific configuration takes precedence over global configuration
+		s.Targets[i].Network = MergeNetworks(s.Network, s.Targets[i].Network)
+
+		// Merge global labels with target-specific labels
+		// Target-specific labels take precedence over global labels
+		s.Targets[i].Labels = MergeLabels(s.Labels, s.Targets[i].Labels)
+
+		// Parse startup probe
+		// Intermediate step since apiv1.Probe is only annotated for JSON marshalling
+		if s.Targets[i].RawStartupProbe != nil {
+			converted := ConvertToStringKeys(s.Targets[i].RawStartupProbe)
+			probeBytes, err := json.Marshal(converted)
+			if err != nil {
+				return fmt.Errorf("error marshaling startup probe for target %s: %w", s.Targets[i].Name, err)
+			}
+			var probe apiv1.Probe
+			if err := json.Unmarshal(probeBytes, &probe); err != nil {
+				return fmt.Errorf("error parsing startup probe for target %s: %w", s.Targets[i].Name, err)
+			}
+			s.Targets[i].StartupProbe = &probe
+		}
+	}
+	s.Labels = nil        // Clear so it is not written to the output YAML file
+	s.Network = Network{} // Clear so it is not written to the output YAML file
+
+	networks := make(map[string]Network)
+	for _, attacker := range s.Attackers {
+		networks["attacker '"+attacker.Name+"'"] = attacker.Network
+	}
+	for _, target := range s.Targets {
+		networks["target '"+target.Name+"'"] = target.Network
+	}
+	for _, client := range s.Background {
+		networks["background client '"+client.Name+"'"] = client.Network
+	}
+	return validateNetworks(networks)
+}
+
+// networks returns the merged network configuration of every pod in the scenario
+func (s *MultiAttackerScenario) networks() []*Network {
+	var networks []*Network
+	for i := range s.Attackers {
+		networks = append(networks, &s.Attackers[i].Network)
+	}
+	for i := range s.Targets {
+		networks = append(networks, &s.Targets[i].Network)
+	}
+	for i := range s.Background {
+		networks = append(networks, &s.Background[i].Network)
+	}
+	return networks
+}
+
+// AttackPod returns the pod definition for a specific attacker
+func (s *MultiAttackerScenario) AttackPod(index int) *apiv1.Pod {
+	if index < 0 || index >= len(s.Attackers) {
+		log.Printf("Attacker index %d out of range (0-%d)", index, len(s.Attackers)-1)
+		return nil
+	}
+
+	pod := BuildAttackerPod(s.Attackers[index].Name, s.Attackers[index], s.Name)
+	pod.Name = CleanPodName(fmt.Sprintf("%s%s-%d", s.Name, AttackerPodSuffix, index))
+	return pod
+}
+
+// TargetPod returns the pod definition for a specific target
+func (s *MultiAttackerScenario) TargetPod(index int) *apiv1.Pod {
+	if index < 0 || index >= len(s.Targets) {
+		log.Printf("Target index %d out of range (0-%d)", index, len(s.Targets)-1)
+		return nil
+	}
+
+	return BuildTargetPod(s.Targets[index], s.Name, index)
+}
+
+// Execute executes the scenario
+func (s *MultiAttackerScenario) Execute(ctx context.Context, outputDir string) error {
+	return ExecuteScenario(ctx, s, outputDir)
+}
+
+// WriteScenario marshals the scenario to YAML and writes it to disk
+func (s *MultiAttackerScenario) WriteScenario(outputDir string) error {
+	return WriteScenario(s, outputDir)
+}
+
+// DeployAllPods deploys all attacker and target pods for the scenario in a concurrent manner.
+// It waits for all pods to be ready before returning.
+func (s *MultiAttackerScenario) DeployAllPods(ctx context.Context) error {
+	log.Println("Deploying pods for scenario: ", s.Name)
+	s.InitTime = time.Now()
+	var wg sync.WaitGroup
+	wg.Add(len(s.Attackers) + len(s.Targets) + 1) // + 1 for the background clients
+
+	// Channel to capture errors
+	errChan := make(chan error, len(s.Attackers)+len(s.Targets)+1)
+
+	// Initialize the pod spec slices with the correct length
+	s.Deployment.AttackPodSpecs = make([]kubeapi.RunningPodSpec, len(s.Attackers))
+	s.Deployment.TargetPodSpecs = make([]kubeapi.RunningPodSpec, len(s.Targets))
+
+	// 1. Deploy all attacker pods
+	for i := range s.Attackers {
+		go func(index int) {
+			defer wg.Done()
+			podspec, err := kubeapi.CreateReadyPod(ctx, s.AttackPod(index))
+			if err != nil {
+				errChan <- fmt.Errorf("failed to deploy attacker pod %s: %w", s.Attackers[index].Name, err)
+				return
+			}
+			s.Deployment.AttackPodSpecs[index] = podspec
+		}(i)
+	}
+
+	// 2. Deploy all target pods
+	for i := range s.Targets {
+		go func(index int) {
+			defer wg.Done()
+			podspec, err := kubeapi.CreateReadyPod(ctx, s.TargetPod(index))
+			if err != nil {
+				errChan <- fmt.Errorf("failed to deploy target pod %s: %w", s.Targets[index].Name, err)
+				return
+			}
+			s.Deployment.TargetPodSpecs[index] = podspec
+		}(i)
+	}
+
+	// 3. Deploy the background client pods
+	go func() {
+		defer wg.Done()
+		podspecs, err := deployBackgroundPods(ctx, s.Name, s.Background)
+		s.Deployment.BackgroundPodSpecs = podspecs
+		if err != nil {
+			errChan <- err
+		}
+	}()
+
+	// 4. Wait for all pods to be ready
+	log.Println("Waiting for pods to be ready for scenario: ", s.Name)
+	wg.Wait()
+	log.Println("All pods are ready for scenario: ", s.Name)
+	close(errChan)
+
+	// 5. Check for errors
+	for err := range errChan {
+		if err != nil {
+			return err
+		}
+	}
+
+	// 6. Add the tc filters of network rules now that the IPs of all pods are known
+	peers := networkPeers(s.Deployment.AttackPodSpecs, s.Deployment.TargetPodSpecs, s.Deployment.BackgroundPodSpecs)
+	if err := applyNetworkRules(ctx, s.shapedPods(), peers); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// shapedPods returns the deployed pods with their network configuration
+func (s *MultiAttackerScenario) shapedPods() []shapedPod {
+	var pods []shapedPod
+	for i, podSpec := range s.Deployment.AttackPodSpecs {
+		pods = append(pods, shapedPod{podSpec: podSpec, network: &s.Attackers[i].Network, tcCommands: &s.Attackers[i].TCCommands})
+	}
+	for i, podSpec := range s.Deployment.TargetPodSpecs {
+		pods = append(pods, shapedPod{podSpec: podSpec, network: &s.Targets[i].Network, tcCommands: &s.Targets[i].TCCommands})
+	}
+	return append(pods, backgroundShapedPods(s.Background, s.Deployment.BackgroundPodSpecs)...)
+}
+
+// StartTrafficCapture starts traffic capture on all target pods
+func (s *MultiAttackerScenario) StartTrafficCapture(ctx context.Context) error {
+	var wg sync.WaitGroup
+	wg.Add(len(s.Deployment.TargetPodSpecs))
+
+	// Channel to capture errors
+	errChan := make(chan error, len(s.Deployment.TargetPodSpecs))
+
+	// Start traffic capture on each target pod concurrently
+	for i, targetPodSpec := range s.Deployment.TargetPodSpecs {
+		go func(index int, podSpec kubeapi.RunningPodSpec) {
+			defer wg.Done()
+
+			log.Printf("Starting traffic capture on target pod %v for scenario %v", podSpec.PodName, s.Name)
+			if err := startTcpdumpCapture(ctx, podSpec.PodName, s.GetTrafficFilterForTarget(index)); err != nil {
+				errChan <- fmt.Errorf("error starting tcpdump in target %s for scenario %v, error: %w", s.Targets[index].Name, s.Name, err)
+			}
+		}(i, targetPodSpec)
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	return errors.Join(collectErrors(errChan)...)
+}
+
+// ExecuteAttack executes the attack of every attacker, starting them concurrently or staggered
+func (s *MultiAttackerScenario) ExecuteAttack(ctx context.Context) error {
+	var stagger time.Duration
+	if s.Stagger != "" {
+		stagger, _ = time.ParseDuration(s.Stagger) // Validated in FromYAML
+	}
+
+	return runWithBackgroundTraffic(ctx, s.Background, s.Deployment.BackgroundPodSpecs, s.Deployment.TargetPodSpecs, func() error {
+		return s.executeAttackers(ctx, stagger)
+	})
+}
+
+func (s *MultiAttackerScenario) executeAttackers(ctx context.Context, stagger time.Duration) error {
+	var wg sync.WaitGroup
+	wg.Add(len(s.Attackers))
+	errChan := make(chan error, len(s.Attackers))
+
+	s.StartTime = time.Now()
+	for i := range s.Attackers {
+		go func(index int) {
+			defer wg.Done()
+			attacker := &s.Attackers[index]
+
+			if delay := time.Duration(index) * stagger; delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					errChan <- fmt.Errorf("attacker %s in scenario %v: %w", attacker.Name, s.Name, ctx.Err())
+					return
+				}
+			}
+
+			attacker.StartTime = time.Now()
+			err := runAttack(ctx, s.Name, attacker, s.Deployment.AttackPodSpecs[index], s.GetShellEnvVarsForAttacker(index))
+			attacker.StopTime = time.Now()
+			if err != nil {
+				errChan <- fmt.Errorf("error executing command of attacker %s in scenario %v: %w", attacker.Name, s.Name, err)
+				return
+			}
+			log.Printf("Attacker %s finished in scenario %v", attacker.Name, s.Name)
+		}(i)
+	}
+	wg.Wait()
+	s.StopTime = time.Now()
+	close(errChan)
+
+	if err := errors.Join(collectErrors(errChan)...); err != nil {
+		return err
+	}
+	log.Printf("Attack finished in scenario %v", s.Name)
+	return nil
+}
+
+// DownloadResults downloads the pcap capture and tcpdump log file from the target pods
+func (s *MultiAttackerScenario) DownloadResults(ctx context.Context, outputDir string) error {
+	return s.downloadResults(ctx, outputDir, "")
+}
+
+// DownloadPartialResults downloads partial artifacts for interrupted or failed attacks.
+func (s *MultiAttackerScenario) DownloadPartialResults(ctx context.Context, outputDir string) error {
+	return s.downloadResults(ctx, outputDir, "partial-")
+}
+
+func (s *MultiAttackerScenario) downloadResults(ctx context.Context, outputDir, prefix string) error {
+	var wg sync.WaitGroup
+	wg.Add(len(s.Deployment.TargetPodSpecs))
+
+	// Channel to capture errors
+	errChan := make(chan error, len(s.Deployment.TargetPodSpecs))
+
+	// Download the pcap capture and tcpdump log file from each target pod concurrently
+	for i, targetPodSpec := range s.Deployment.TargetPodSpecs {
+		go func(index int, podSpec kubeapi.RunningPodSpec) {
+			defer wg.Done()
+
+			targetDir := filepath.Join(outputDir, s.Targets[index].Name)
+			if err := downloadTargetCapture(ctx, podSpec.PodName, targetDir, prefix); err != nil {
+				errChan <- fmt.Errorf("target %s: %w", s.Targets[index].Name, err)
+				return
+			}
+			log.Printf("Processed results for target %s in scenario %v", s.Targets[index].Name, s.Name)
+		}(i, targetPodSpec)
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	// Download the output log of every attacker
+	for i, podSpec := range s.Deployment.AttackPodSpecs {
+		attackLogPath := filepath.Join(outputDir, prefix+"attacker-"+CleanPodName(s.Attackers[i].Name)+".log")
+		err := kubeapi.CopyFileFromPod(ctx, podSpec.PodName, podSpec.ContainerName, "/logs/attacker.log", attackLogPath, true)
+		if err != nil {
+			log.Printf("warning: failed to download attack log from attacker pod %s: %v", podSpec.PodName, err)
+			// Not fatal, continue
+		}
+	}
+	downloadBackgroundLogs(ctx, outputDir, prefix, s.Background, s.Deployment.BackgroundPodSpecs)
+
+	if err := errors.Join(collectErrors(errChan)...); err != nil {
+		return err
+	}
+
+	// Write the scenario file
+	err := WriteScenarioToPath(s, filepath.Join(outputDir, prefix+"scenario.yaml"))
+	if err != nil {
+		return fmt.Errorf("error writing scenario file: %w", err)
+	}
+
+	return nil
+}
+
+// ProcessResults processes the results of the attack
+func (s *MultiAttackerScenario) ProcessResults(ctx context.Context, outputDir string, processingPods []*ProcessingPod) error {
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(s.Targets)*len(processingPods))
+
+	// Process each target's results with all processing pods
+	for _, target := range s.Targets {
+		targetDir := filepath.Join(outputDir, target.Name)
+		for _, pod := range processingPods {
+			wg.Add(1)
+			go func(pod *ProcessingPod, targetName string, targetDir string) {
+				defer wg.Done()
+
+				err := pod.ProcessPcap(ctx, filepath.Join(targetDir, "dump.pcap"), s.Name, targetName, targetDir)
+				if err != nil {
+					errCh <- fmt.Errorf("process target %s with pod %s: %w", targetName, pod.Name, err)
+				}
+			}(pod, target.Name, targetDir)
+		}
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	return errors.Join(collectErrors(errCh)...)
+}
+
+// LabelResults adds the scenario identity and each target's merged labels to the processor outputs of that target
+func (s *MultiAttackerScenario) LabelResults(outputDir string, processingPods []*ProcessingPod) error {
+	windows := s.AttackWindows()
+	var errs []error
+	for _, target := range s.Targets {
+		targetDir := filepath.Join(outputDir, target.Name)
+		columns := ScenarioLabelColumns(s.Name, s.UUID, target.Labels)
+		if err := LabelProcessorOutputs(targetDir, processingPods, columns, windows); err != nil {
+			errs = append(errs, fmt.Errorf("label results for target %s: %w", target.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AttackWindows returns one window per attacker and target pair, bounded by the run time of that attacker
+func (s *MultiAttackerScenario) AttackWindows() []AttackWindow {
+	var windows []AttackWindow
+	for i, attackPodSpec := range s.Deployment.AttackPodSpecs {
+		for _, targetPodSpec := range s.Deployment.TargetPodSpecs {
+			windows = append(windows, attackerWindows(s.Attackers[i], attackPodSpec.PodIP, targetPodSpec.PodIP, s.Attackers[i].StartTime, s.Attackers[i].StopTime)...)
+		}
+	}
+	return windows
+}
+
+// DeleteAllPods deletes all pods for the scenario
+func (s *MultiAttackerScenario) DeleteAllPods(ctx context.Context) error {
+	var podsToDelete []string
+	for _, attackPodSpec := range s.Deployment.AttackPodSpecs {
+		podsToDelete = append(podsToDelete, attackPodSpec.PodName)
+	}
+	for _, targetPodSpec := range s.Deployment.TargetPodSpecs {
+		podsToDelete = append(podsToDelete, targetPodSpec.PodName)
+	}
+	for _, backgroundPodSpec := range s.Deployment.BackgroundPodSpecs {
+		podsToDelete = append(podsToDelete, backgroundPodSpec.PodName)
+	}
+
+	return deletePods(ctx, podsToDelete)
+}
+
+// GetTrafficFilterForTarget returns the tcpdump filter for a specific target with placeholders replaced
+func (s *MultiAttackerScenario) GetTrafficFilterForTarget(targetIndex int) string {
+	if targetIndex >= len(s.Targets) || targetIndex >= len(s.Deployment.TargetPodSpecs) {
+		return ""
+	}
+	if s.Deployment.TargetPodSpecs[targetIndex].PodIP == "" || len(s.Deployment.AttackPodSpecs) == 0 {
+		return s.Targets[targetIndex].Filter
+	}
+
+	// Indexed placeholders are added from the highest index down so that $TARGET_IP_1 does not
+	// match the start of $TARGET_IP_10
+	replacements := backgroundFilterReplacements(s.Deployment.BackgroundPodSpecs)
+	for i := len(s.Deployment.TargetPodSpecs) - 1; i >= 0; i-- {
+		replacements = append(replacements, fmt.Sprintf("$TARGET_IP_%d", i), s.Deployment.TargetPodSpecs[i].PodIP)
+	}
+	var attackerHosts []string
+	for i := len(s.Deployment.AttackPodSpecs) - 1; i >= 0; i-- {
+		replacements = append(replacements, fmt.Sprintf("$ATTACKER_IP_%d", i), s.Deployment.AttackPodSpecs[i].PodIP)
+		attackerHosts = append([]string{"host " + s.Deployment.AttackPodSpecs[i].PodIP}, attackerHosts...)
+	}
+
+	replacements = append(replacements,
+		"$ATTACKER_HOSTS", strings.Join(attackerHosts, " or "),
+		"$ATTACKER_IP", s.Deployment.AttackPodSpecs[0].PodIP,
+		"$TARGET_IP", s.Deployment.TargetPodSpecs[targetIndex].PodIP,
+	)
+
+	return strings.NewReplacer(replacements...).Replace(s.Targets[targetIndex].Filter)
+}
+
+// GetShellEnvVarsForAttacker returns the environment variables for the attack command of a specific attacker
+func (s *MultiAttackerScenario) GetShellEnvVarsForAttacker(attackerIndex int) map[string]string {
+	envVars := make(map[string]string)
+	envVars["ATTACKER_INDEX"] = fmt.Sprint(attackerIndex)
+	envVars["ATTACKER_IP"] = s.Deployment.AttackPodSpecs[attackerIndex].PodIP
+
+	var attackerIPs []string
+	for i, attackPodSpec := range s.Deployment.AttackPodSpecs {
+		envVars[fmt.Sprintf("ATTACKER_IP_%d", i)] = attackPodSpec.PodIP
+		attackerIPs = append(attackerIPs, attackPodSpec.PodIP)
+	}
+	envVars["ATTACKER_IPS"] = strings.Join(attackerIPs, ",")
+
+	var targetIPs []string
+	for i, targetPodSpec := range s.Deployment.TargetPodSpecs {
+		envVars[fmt.Sprintf("TARGET_IP_%d", i)] = targetPodSpec.PodIP
+		targetIPs = append(targetIPs, targetPodSpec.PodIP)
+	}
+	envVars["TARGET_IPS"] = strings.Join(targetIPs, ",")
+
+	return envVars
+}
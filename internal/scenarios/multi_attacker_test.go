@@ -0,0 +1,95 @@
+package scenarios
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+)
+
+func newDeployedMultiAttackerScenario(attackers, targets int) *MultiAttackerScenario {
+	s := &MultiAttackerScenario{BaseScenario: BaseScenario{Name: "ddos"}}
+	for i := 0; i < attackers; i++ {
+		s.Attackers = append(s.Attackers, Attacker{Name: fmt.Sprintf("bot-%d", i), CPURequest: "100m", MemRequest: "250Mi"})
+		s.Deployment.AttackPodSpecs = append(s.Deployment.AttackPodSpecs, kubeapi.RunningPodSpec{
+			PodName: fmt.Sprintf("ddos-A-%d", i),
+			PodIP:   fmt.Sprintf("10.0.1.%d", i),
+		})
+	}
+	for i := 0; i < targets; i++ {
+		s.Targets = append(s.Targets, TargetConfig{Name: fmt.Sprintf("web-%d", i), Filter: DefaultMultiAttackerTcpdumpFilter})
+		s.Deployment.TargetPodSpecs = append(s.Deployment.TargetPodSpecs, kubeapi.RunningPodSpec{
+			PodName: fmt.Sprintf("ddos-T-%d", i),
+			PodIP:   fmt.Sprintf("10.0.2.%d", i),
+		})
+	}
+	return s
+}
+
+func TestMultiAttackerTrafficFilterReplacesPlaceholders(t *testing.T) {
+	s := newDeployedMultiAttackerScenario(11, 2)
+
+	if got, want := s.GetTrafficFilterForTarget(1), "host 10.0.2.1 and (host 10.0.1.0 or host 10.0.1.1 or host 10.0.1.2 or host 10.0.1.3 or host 10.0.1.4 or host 10.0.1.5 or host 10.0.1.6 or host 10.0.1.7 or host 10.0.1.8 or host 10.0.1.9 or host 10.0.1.10) and not arp"; got != want {
+		t.Fatalf("GetTrafficFilterForTarget(1) = %q, want %q", got, want)
+	}
+
+	s.Targets[0].Filter = "src host $ATTACKER_IP_10 or src host $ATTACKER_IP_1 or dst host $TARGET_IP_1"
+	if got, want := s.GetTrafficFilterForTarget(0), "src host 10.0.1.10 or src host 10.0.1.1 or dst host 10.0.2.1"; got != want {
+		t.Fatalf("GetTrafficFilterForTarget(0) = %q, want %q", got, want)
+	}
+}
+
+func TestMultiAttackerShellEnvVars(t *testing.T) {
+	s := newDeployedMultiAttackerScenario(2, 2)
+
+	envVars := s.GetShellEnvVarsForAttacker(1)
+	want := map[string]string{
+		"ATTACKER_INDEX": "1",
+		"ATTACKER_IP":    "10.0.1.1",
+		"ATTACKER_IP_0":  "10.0.1.0",
+		"ATTACKER_IP_1":  "10.0.1.1",
+		"ATTACKER_IPS":   "10.0.1.0,10.0.1.1",
+		"TARGET_IP_0":    "10.0.2.0",
+		"TARGET_IP_1":    "10.0.2.1",
+		"TARGET_IPS":     "10.0.2.0,10.0.2.1",
+	}
+	if len(envVars) != len(want) {
+		t.Fatalf("GetShellEnvVarsForAttacker(1) = %v, want %v", envVars, want)
+	}
+	for key, value := range want {
+		if envVars[key] != value {
+			t.Fatalf("GetShellEnvVarsForAttacker(1)[%s] = %q, want %q", key, envVars[key], value)
+		}
+	}
+}
+
+func TestMultiAttackerAttackWindowsUseAttackerTimes(t *testing.T) {
+	s := newDeployedMultiAttackerScenario(2, 1)
+	start := time.Date(2024, 7, 26, 17, 46, 41, 0, time.UTC)
+	s.Attackers[0].StartTime, s.Attackers[0].StopTime = start, start.Add(10*time.Second)
+	s.Attackers[1].StartTime, s.Attackers[1].StopTime = start.Add(5*time.Second), start.Add(15*time.Second)
+
+	windows := s.AttackWindows()
+	if len(windows) != 2 {
+		t.Fatalf("AttackWindows() returned %d windows, want 2", len(windows))
+	}
+	for i, window := range windows {
+		if window.AttackerIP != s.Deployment.AttackPodSpecs[i].PodIP || window.TargetIP != "10.0.2.0" {
+			t.Fatalf("AttackWindows()[%d] endpoints = %s -> %s", i, window.AttackerIP, window.TargetIP)
+		}
+		if !window.Start.Equal(s.Attackers[i].StartTime) || !window.Stop.Equal(s.Attackers[i].StopTime) {
+			t.Fatalf("AttackWindows()[%d] = %v-%v, want %v-%v", i, window.Start, window.Stop, s.Attackers[i].StartTime, s.Attackers[i].StopTime)
+		}
+	}
+}
+
+func TestMultiAttackerPodsHaveDistinctNames(t *testing.T) {
+	s := newDeployedMultiAttackerScenario(2, 0)
+	if got, want := s.AttackPod(0).Name, "ddos-a-0"; got != want {
+		t.Fatalf("AttackPod(0).Name = %q, want %q", got, want)
+	}
+	if got, want := s.AttackPod(1).Name, "ddos-a-1"; got != want {
+		t.Fatalf("AttackPod(1).Name = %q, want %q", got, want)
+	}
+}
@@ -5,9 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -24,6 +22,8 @@ type MultiTargetScenario struct {
 	BaseScenario `yaml:",inline"`
 	Attacker     Attacker       `yaml:"attacker"`
 	Targets      []TargetConfig `yaml:"targets"`
+	// Background clients generating benign traffic against the targets during the attack
+	Background []BackgroundClient `yaml:"background,omitempty"`
 	// Global network configuration, used as default for all targets
 	Network Network `yaml:"network,omitempty"`
 	// Global labels, applied to all targets
@@ -32,8 +32,9 @@ type MultiTargetScenario struct {
 }
 
 type MultiTargetDeployment struct {
-	AttackPodSpec  kubeapi.RunningPodSpec
-	TargetPodSpecs []kubeapi.RunningPodSpec
+	AttackPodSpec      kubeapi.RunningPodSpec
+	TargetPodSpecs     []kubeapi.RunningPodSpec
+	BackgroundPodSpecs []kubeapi.RunningPodSpec
 }
 
 func (s MultiTargetDeployment) MarshalYAML() (interface{}, error) {
@@ -47,24 +48,25 @@ func (s MultiTargetDeployment) MarshalYAML() (interface{}, error) {
 	for _, target := range s.TargetPodSpecs {
 		targetMap[target.ContainerName] = target.PodIP
 	}
+	if len(s.BackgroundPodSpecs) > 0 {
+		result["background"] = backgroundPodIPs(s.BackgroundPodSpecs)
+	}
 
 	return result, nil
 }
 
 // FromYAML parses a YAML file into a MultiTargetScenario
 func (s *MultiTargetScenario) FromYAML(filePath string) error {
-	fileHandler, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("open scenario file %s: %w", filePath, err)
-	}
-	defer fileHandler.Close()
-
-	b, err := io.ReadAll(fileHandler)
+	b, err := readScenarioFile(filePath)
 	if err != nil {
-		return fmt.Errorf("error reading YAML: %w", err)
+		return err
 	}
+	return s.parseYAML(b, scenarioNameFromPath(filePath))
+}
 
-	err = yaml.UnmarshalStrict(b, s)
+// parseYAML parses a scenario definition into a MultiTargetScenario with the given name
+func (s *MultiTargetScenario) parseYAML(b []byte, name string) error {
+	err := yaml.UnmarshalStrict(b, s)
 	if err != nil {
 		return fmt.Errorf("error unmarshaling YAML: %w", err)
 	}
@@ -77,22 +79,17 @@ func (s *MultiTargetScenario) FromYAML(filePath string) error {
 		return fmt.Errorf("no attack-image provided for attack: '%s'", s.Attacker.Name)
 	}
 
-	// Process attack time
-	atkTime, err := ParseToSeconds(s.Attacker.AtkTime)
-	if err != nil {
-		s.Attacker.AtkTime = EmptyAttackDuration
-	} else {
-		s.Attacker.AtkTime = atkTime
+	// Process attack time and wrap the attack command(s) in a timeout and the attack log
+	if err := prepareAttackCommands(&s.Attacker); err != nil {
+		return err
 	}
 
-	// Modify the attack command to include a timeout if a duration is provided
-	if s.Attacker.AtkTime != EmptyAttackDuration {
-		s.Attacker.AtkCommand = "timeout " + s.Attacker.AtkTime + " " + s.Attacker.AtkCommand
-	}
-	s.Attacker.AtkCommand = withAttackLogging(s.Attacker.AtkCommand)
-
 	s.UUID = uuid.New()
-	s.Name = CleanPodName(strings.TrimSuffix(filepath.Base(fileHandler.Name()), filepath.Ext(fileHandler.Name())))
+	s.Name = CleanPodName(name)
+
+	if err := prepareBackgroundClients(s.Background, s.Network); err != nil {
+		return err
+	}
 
 	// Set default filter and resource requests for each target
 	for i := range s.Targets {
@@ -102,6 +99,9 @@ func (s *MultiTargetScenario) FromYAML(filePath string) error {
 
 		if s.Targets[i].Filter == "" {
 			s.Targets[i].Filter = DefaultTcpdumpFilter
+			if len(s.Background) > 0 {
+				s.Targets[i].Filter = DefaultBackgroundTcpdumpFilter
+			}
 		}
 		if s.Targets[i].CPURequest == "" {
 			s.Targets[i].CPURequest = "100m"
@@ -110,12 +110,6 @@ func (s *MultiTargetScenario) FromYAML(filePath string) error {
 			s.Targets[i].MemRequest = "250Mi"
 		}
 
-		// Initialize an empty Network struct if not provided
-		// This ensures MergeNetworks will work correctly
-		if s.Targets[i].Network == (Network{}) {
-			s.Targets[i].Network = Network{}
-		}
-
 		// Merge the global network configuration with the target-specific one
 		// Target-specific configuration takes precedence over global configuration
 		s.Targets[i].Network = MergeNetworks(s.Network, s.Targets[i].Network)
@@ -139,12 +133,6 @@ func (s *MultiTargetScenario) FromYAML(filePath string) error {
 		s.Attacker.MemRequest = "250Mi"
 	}
 
-	// Initialize an empty Network struct for attacker if not provided
-	// This ensures MergeNetworks will work correctly
-	if s.Attacker.Network == (Network{}) {
-		s.Attacker.Network = Network{}
-	}
-
 	// Merge the global network configuration with the attacker-specific one
 	// Attacker-specific configuration takes precedence over global configuration
 	s.Attacker.Network = MergeNetworks(s.Network, s.Attacker.Network)
@@ -167,7 +155,26 @@ func (s *MultiTargetScenario) FromYAML(filePath string) error {
 		}
 	}
 
-	return nil
+	networks := map[string]Network{"attacker": s.Attacker.Network}
+	for _, target := range s.Targets {
+		networks["target '"+target.Name+"'"] = target.Network
+	}
+	for _, client := range s.Background {
+		networks["background client '"+client.Name+"'"] = client.Network
+	}
+	return validateNetworks(networks)
+}
+
+// networks returns the merged network configuration of every pod in the scenario
+func (s *MultiTargetScenario) networks() []*Network {
+	networks := []*Network{&s.Attacker.Network}
+	for i := range s.Targets {
+		networks = append(networks, &s.Targets[i].Network)
+	}
+	for i := range s.Background {
+		networks = append(networks, &s.Background[i].Network)
+	}
+	return networks
 }
 
 // AttackPod returns the pod definition for the attacker
@@ -201,10 +208,10 @@ func (s *MultiTargetScenario) DeployAllPods(ctx context.Context) error {
 	log.Println("Deploying pods for scenario: ", s.Name)
 	s.InitTime = time.Now()
 	var wg sync.WaitGroup
-	wg.Add(1 + len(s.Targets)) // 1 for attacker + number of targets
+	wg.Add(2 + len(s.Targets)) // 1 for attacker + 1 for the background clients + number of targets
 
 	// Channel to capture errors
-	errChan := make(chan error, 1+len(s.Targets))
+	errChan := make(chan error, 2+len(s.Targets))
 
 	// 1. Deploy the attacker pod
 	go func() {
@@ -235,22 +242,47 @@ func (s *MultiTargetScenario) DeployAllPods(ctx context.Context) error {
 		}(i)
 	}
 
-	// 3. Wait for all pods to be ready
+	// 3. Deploy the background client pods
+	go func() {
+		defer wg.Done()
+		podspecs, err := deployBackgroundPods(ctx, s.Name, s.Background)
+		s.Deployment.BackgroundPodSpecs = podspecs
+		if err != nil {
+			errChan <- err
+		}
+	}()
+
+	// 4. Wait for all pods to be ready
 	log.Println("Waiting for pods to be ready for scenario: ", s.Name)
 	wg.Wait()
 	log.Println("All pods are ready for scenario: ", s.Name)
 	close(errChan)
 
-	// 4. Check for errors
+	// 5. Check for errors
 	for err := range errChan {
 		if err != nil {
 			return err
 		}
 	}
 
+	// 6. Add the tc filters of network rules now that the IPs of all pods are known
+	peers := networkPeers([]kubeapi.RunningPodSpec{s.Deployment.AttackPodSpec}, s.Deployment.TargetPodSpecs, s.Deployment.BackgroundPodSpecs)
+	if err := applyNetworkRules(ctx, s.shapedPods(), peers); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// shapedPods returns the deployed pods with their network configuration
+func (s *MultiTargetScenario) shapedPods() []shapedPod {
+	pods := []shapedPod{{podSpec: s.Deployment.AttackPodSpec, network: &s.Attacker.Network, tcCommands: &s.Attacker.TCCommands}}
+	for i, podSpec := range s.Deployment.TargetPodSpecs {
+		pods = append(pods, shapedPod{podSpec: podSpec, network: &s.Targets[i].Network, tcCommands: &s.Targets[i].TCCommands})
+	}
+	return append(pods, backgroundShapedPods(s.Background, s.Deployment.BackgroundPodSpecs)...)
+}
+
 // StartTrafficCapture starts traffic capture on all target pods
 func (s *MultiTargetScenario) StartTrafficCapture(ctx context.Context) error {
 	var wg sync.WaitGroup
@@ -269,7 +301,7 @@ func (s *MultiTargetScenario) StartTrafficCapture(ctx context.Context) error {
 			filter := s.GetTrafficFilterForTarget(index)
 
 			if err := startTcpdumpCapture(ctx, podSpec.PodName, filter); err != nil {
-				errChan <- fmt.Errorf("error starting tcpdump in target %s for scenario %v, error: %v", s.Targets[index].Name, s.Name, err)
+				errChan <- fmt.Errorf("error starting tcpdump in target %s for scenario %v, error: %w", s.Targets[index].Name, s.Name, err)
 				return
 			}
 		}(i, targetPodSpec)
@@ -294,22 +326,14 @@ func (s *MultiTargetScenario) ExecuteAttack(ctx context.Context) error {
 	// Create environment variables with all target IPs
 	envVars := s.GetShellEnvVars()
 
-	log.Printf("Executing attack '%v' in scenario %v", s.Attacker.AtkCommand, s.Name)
-	s.StartTime = time.Now()
-	stdo, stde, err := kubeapi.ExecShellInContainerWithEnvVars(
-		ctx,
-		kubeapi.WorkloadNamespace,
-		s.Deployment.AttackPodSpec.PodName,
-		s.Deployment.AttackPodSpec.ContainerName,
-		s.Attacker.AtkCommand,
-		envVars)
-	s.StopTime = time.Now()
+	err := runWithBackgroundTraffic(ctx, s.Background, s.Deployment.BackgroundPodSpecs, s.Deployment.TargetPodSpecs, func() error {
+		s.StartTime = time.Now()
+		defer func() { s.StopTime = time.Now() }()
+		return runAttack(ctx, s.Name, &s.Attacker, s.Deployment.AttackPodSpec, envVars)
+	})
 	if err != nil {
 		return fmt.Errorf("error executing command in scenario %v: %w", s.Name, err)
 	}
-	if stde != "" {
-		log.Printf("%s : %s : stdout: %s\n\t stderr: %s", s.Name, s.Attacker.Name, stdo, stde)
-	}
 	log.Printf("Attack finished in scenario %v", s.Name)
 	return nil
 }
@@ -336,39 +360,9 @@ func (s *MultiTargetScenario) downloadResults(ctx context.Context, outputDir, pr
 		go func(index int, podSpec kubeapi.RunningPodSpec) {
 			defer wg.Done()
 
-			if err := stopAndNormalizeCapture(ctx, podSpec.PodName); err != nil {
-				errChan <- fmt.Errorf("failed to stop tcpdump in target pod %s: %v", s.Targets[index].Name, err)
-				return
-			}
-
-			// Create target-specific output directory
 			targetDir := filepath.Join(outputDir, s.Targets[index].Name)
-			err := os.MkdirAll(targetDir, 0755)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to create output directory for target %s: %v", s.Targets[index].Name, err)
-				return
-			}
-
-			err = kubeapi.CopyFileFromPod(ctx, podSpec.PodName, TcpdumpContainerName, RawPcapPath, filepath.Join(targetDir, prefix+"dump.raw.pcap"), true)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to download raw pcap file from target pod %s: %v", s.Targets[index].Name, err)
-				return
-			}
-
-			err = kubeapi.CopyFileFromPod(ctx, podSpec.PodName, ReordercapContainerName, NormalizedPcapPath, filepath.Join(targetDir, prefix+"dump.pcap"), true)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to download pcap file from target pod %s: %v", s.Targets[index].Name, err)
-				return
-			}
-
-			err = kubeapi.CopyFileFromPod(ctx, podSpec.PodName, TcpdumpContainerName, TcpdumpLogPath, filepath.Join(targetDir, prefix+"tcpdump.log"), true)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to download tcpdump log file from target pod %s: %v", s.Targets[index].Name, err)
-				return
-			}
-			err = kubeapi.CopyFileFromPod(ctx, podSpec.PodName, ReordercapContainerName, ReordercapLogPath, filepath.Join(targetDir, prefix+"reordercap.log"), true)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to download reordercap log file from target pod %s: %v", s.Targets[index].Name, err)
+			if err := downloadTargetCapture(ctx, podSpec.PodName, targetDir, prefix); err != nil {
+				errChan <- fmt.Errorf("target %s: %w", s.Targets[index].Name, err)
 				return
 			}
 
@@ -389,6 +383,7 @@ func (s *MultiTargetScenario) downloadResults(ctx context.Context, outputDir, pr
 		log.Printf("warning: failed to download attack log from attacker pod: %v", err)
 		// Not fatal, continue
 	}
+	downloadBackgroundLogs(ctx, outputDir, prefix, s.Background, s.Deployment.BackgroundPodSpecs)
 
 	// Check for errors
 	for err := range errChan {
@@ -400,7 +395,7 @@ func (s *MultiTargetScenario) downloadResults(ctx context.Context, outputDir, pr
 	// Write the scenario file
 	err = WriteScenarioToPath(s, filepath.Join(outputDir, prefix+"scenario.yaml"))
 	if err != nil {
-		return fmt.Errorf("error writing scenario file: %v", err)
+		return fmt.Errorf("error writing scenario file: %w", err)
 	}
 
 	return nil
@@ -443,6 +438,29 @@ func (s *MultiTargetScenario) ProcessResults(ctx context.Context, outputDir stri
 	return nil
 }
 
+// LabelResults adds the scenario identity and each target's merged labels to the processor outputs of that target
+func (s *MultiTargetScenario) LabelResults(outputDir string, processingPods []*ProcessingPod) error {
+	windows := s.AttackWindows()
+	var errs []error
+	for _, target := range s.Targets {
+		targetDir := filepath.Join(outputDir, target.Name)
+		columns := ScenarioLabelColumns(s.Name, s.UUID, target.Labels)
+		if err := LabelProcessorOutputs(targetDir, processingPods, columns, windows); err != nil {
+			errs = append(errs, fmt.Errorf("label results for target %s: %w", target.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AttackWindows returns one window per target, since the attacker may reach every target during the attack
+func (s *MultiTargetScenario) AttackWindows() []AttackWindow {
+	windows := make([]AttackWindow, 0, len(s.Deployment.TargetPodSpecs))
+	for _, targetPodSpec := range s.Deployment.TargetPodSpecs {
+		windows = append(windows, attackerWindows(s.Attacker, s.Deployment.AttackPodSpec.PodIP, targetPodSpec.PodIP, s.StartTime, s.StopTime)...)
+	}
+	return windows
+}
+
 // DeleteAllPods deletes all pods for the scenario
 func (s *MultiTargetScenario) DeleteAllPods(ctx context.Context) error {
 	podsToDelete := []string{
@@ -452,29 +470,11 @@ func (s *MultiTargetScenario) DeleteAllPods(ctx context.Context) error {
 	for _, targetPodSpec := range s.Deployment.TargetPodSpecs {
 		podsToDelete = append(podsToDelete, targetPodSpec.PodName)
 	}
-
-	errCh := make(chan error, len(podsToDelete))
-	var wg sync.WaitGroup
-
-	for _, podName := range podsToDelete {
-		wg.Add(1)
-		go func(podName string) {
-			defer wg.Done()
-			if err := kubeapi.DeletePod(ctx, podName); err != nil {
-				errCh <- fmt.Errorf("failed to delete pod %s: %w", podName, err)
-			}
-		}(podName)
-	}
-
-	wg.Wait()
-	close(errCh)
-
-	var errs []error
-	for err := range errCh {
-		errs = append(errs, err)
+	for _, backgroundPodSpec := range s.Deployment.BackgroundPodSpecs {
+		podsToDelete = append(podsToDelete, backgroundPodSpec.PodName)
 	}
 
-	return errors.Join(errs...)
+	return deletePods(ctx, podsToDelete)
 }
 
 // GetTrafficFilterForTarget returns the tcpdump filter for a specific target with placeholders replaced
@@ -484,8 +484,8 @@ func (s *MultiTargetScenario) GetTrafficFilterForTarget(targetIndex int) string
 	}
 
 	if s.Deployment.AttackPodSpec.PodIP != "" && s.Deployment.TargetPodSpecs[targetIndex].PodIP != "" {
-		// Create a replacer with the basic replacements
-		replacements := []string{}
+		// Create a replacer with the background client replacements
+		replacements := backgroundFilterReplacements(s.Deployment.BackgroundPodSpecs)
 
 		// First add replacements for $TARGET_IP_{index} for all available target pods
 		for i, targetPodSpec := range s.Deployment.TargetPodSpecs {
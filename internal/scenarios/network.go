@@ -1,64 +1,383 @@
 package scenarios
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// IngressDevice is the IFB device that the ingress traffic of eth0 is redirected to, so that it can be shaped
+// like egress traffic
+const IngressDevice = "ifb0"
+
 // GetTCCommand builds the tc command to be executed in the pod to shape the network traffic
 // The command is built based on the network configuration in the scenario
 // Configuration options that are empty or zero are not added to the tc command
+// Egress traffic is shaped on eth0, ingress traffic on an IFB device it is redirected to
 func (n *Network) GetTCCommand() string {
 	commands := []string{
 		"printf 'qdisc before:\\n'",
 		"tc qdisc show dev eth0",
 	}
-	shapingApplied := false
-	if n.Bandwidth != "" {
-		// Calculate the burst buffer size based on the bandwidth and a burst duration of 5ms
-		bandwidthBitsPerSecond, err := ParseSize(n.Bandwidth)
+	layout, err := n.TCLayout()
+	if err != nil {
+		log.Println("Error building tc command: ", err)
+		return ""
+	}
+	commands = append(commands, layout...)
+
+	if len(layout) > 0 {
+		commands = append(commands,
+			"printf 'qdisc after:\\n'",
+			"tc qdisc show dev eth0",
+		)
+	}
+	if n.shapesIngress() {
+		commands = append(commands, fmt.Sprintf("tc qdisc show dev %s", IngressDevice))
+	}
+
+	return strings.Join(commands, " && ")
+}
+
+// TCLayout returns the tc commands that build the qdisc layout of the network configuration, or none
+// without shaping. Filters for rules with a named peer are not included, see PeerFilterCommands.
+// The layout has the qdiscs needed by every change of the schedule, so that they can be changed in place.
+func (n *Network) TCLayout() ([]string, error) {
+	states := n.scheduledStates()
+	commands, err := states[0].deviceCommands("eth0", "dst", shapeOf(states), true)
+	if err != nil {
+		return nil, err
+	}
+	if !n.shapesIngress() {
+		return commands, nil
+	}
+	ingressStates := ingressStates(states)
+	ingress, err := ingressStates[0].deviceCommands(IngressDevice, "src", shapeOf(ingressStates), true)
+	if err != nil {
+		return nil, fmt.Errorf("ingress: %w", err)
+	}
+	commands = append(commands,
+		fmt.Sprintf("ip link add %s type ifb", IngressDevice),
+		fmt.Sprintf("ip link set dev %s up", IngressDevice),
+		"tc qdisc add dev eth0 handle ffff: ingress",
+		fmt.Sprintf("tc filter add dev eth0 parent ffff: protocol all u32 match u32 0 0 action mirred egress redirect dev %s", IngressDevice),
+	)
+	return append(commands, ingress...), nil
+}
+
+// ScheduleCommands returns the tc commands that change the qdisc layout built by TCLayout to the network
+// configuration after the change of the schedule with the given index
+func (n *Network) ScheduleCommands(index int) ([]string, error) {
+	states := n.scheduledStates()
+	if index < 0 || index >= len(n.Schedule) {
+		return nil, fmt.Errorf("schedule has no change %d", index)
+	}
+	commands, err := states[index+1].deviceCommands("eth0", "dst", shapeOf(states), false)
+	if err != nil {
+		return nil, err
+	}
+	if !n.shapesIngress() {
+		return commands, nil
+	}
+	ingressStates := ingressStates(states)
+	ingress, err := ingressStates[index+1].deviceCommands(IngressDevice, "src", shapeOf(ingressStates), false)
+	if err != nil {
+		return nil, fmt.Errorf("ingress: %w", err)
+	}
+	return append(commands, ingress...), nil
+}
+
+// scheduledStates returns the network configuration before the schedule, followed by the configuration
+// after every change of the schedule. Changes are merged over the configuration before the schedule
+// and do not change its rules.
+func (n *Network) scheduledStates() []Network {
+	base := *n
+	base.Schedule = nil
+	states := []Network{base}
+	for _, change := range n.Schedule {
+		state := MergeNetworks(base, change.Network)
+		state.Rules, state.Schedule = base.Rules, nil
+		if state.Ingress != nil {
+			ingress := *state.Ingress
+			ingress.Rules = base.ingress().Rules
+			state.Ingress = &ingress
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// ingress returns the ingress configuration, which is empty without ingress
+func (n *Network) ingress() Network {
+	if n.Ingress == nil {
+		return Network{}
+	}
+	return *n.Ingress
+}
+
+// ingressStates returns the ingress configuration of every state
+func ingressStates(states []Network) []Network {
+	ingress := make([]Network, len(states))
+	for i := range states {
+		ingress[i] = states[i].ingress()
+	}
+	return ingress
+}
+
+// shapesIngress reports whether the ingress traffic is shaped, before or after any change of the schedule
+func (n *Network) shapesIngress() bool {
+	for _, state := range n.scheduledStates() {
+		ingress := state.ingress()
+		if ingress.Bandwidth != "" || ingress.needsNetem() || len(ingress.Rules) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// tcShape lists the qdiscs that shape a device
+type tcShape struct {
+	// tbf reports whether a network without rules has a tbf root qdisc
+	tbf bool
+	// netem reports per class whether it has a netem qdisc, the first entry is the default class or the
+	// only netem qdisc of a network without rules
+	netem []bool
+}
+
+// shapeOf returns the qdiscs needed by any of the states of a device
+func shapeOf(states []Network) tcShape {
+	var shape tcShape
+	for _, state := range states {
+		shape.tbf = shape.tbf || state.Bandwidth != ""
+		for i, class := range state.classNetworks() {
+			if i == len(shape.netem) {
+				shape.netem = append(shape.netem, false)
+			}
+			shape.netem[i] = shape.netem[i] || class.needsNetem()
+		}
+	}
+	return shape
+}
+
+// hasNetem reports whether the class with the given index has a netem qdisc
+func (s tcShape) hasNetem(class int) bool {
+	return class < len(s.netem) && s.netem[class]
+}
+
+// classNetworks returns the network configuration of every class: the configuration itself for the
+// default class, followed by every rule merged over it
+func (n *Network) classNetworks() []Network {
+	base := *n
+	base.Rules, base.Ingress, base.Schedule = nil, nil, nil
+	classes := []Network{base}
+	for _, rule := range n.Rules {
+		classes = append(classes, MergeNetworks(base, rule.Network))
+	}
+	return classes
+}
+
+// deviceCommands returns the tc commands that create the qdiscs of shape on dev, or change them to the
+// network configuration. Rules match the peer as the dst or src address of the packets.
+func (n *Network) deviceCommands(dev, match string, shape tcShape, create bool) ([]string, error) {
+	if len(n.Rules) > 0 {
+		return n.ruleCommands(dev, match, shape, create)
+	}
+	verb := "replace"
+	if !create {
+		verb = "change"
+	}
+	var commands []string
+	if shape.tbf {
+		rate := n.Bandwidth
+		if rate == "" {
+			rate = unlimitedRate
+		}
+		burst, err := burstSize(rate)
 		if err != nil {
-			log.Println("Error parsing bandwidth: ", err)
-			return ""
+			return nil, err
 		}
-		burst := bandwidthBitsPerSecond * 0.005 / 8
-		command := fmt.Sprintf("tc qdisc replace dev eth0 root handle 1: tbf rate %s burst %.f", n.Bandwidth, burst)
+		command := fmt.Sprintf("tc qdisc %s dev %s root handle 1: tbf rate %s burst %.f", verb, dev, rate, burst)
 		if n.QueueSize != "" {
 			command += fmt.Sprintf(" latency %s", n.QueueSize)
 		} else {
 			command += " latency 100ms" // Default latency if not specified
 		}
 		commands = append(commands, command)
-		shapingApplied = true
 	}
 
-	if n.needsNetem() {
+	if shape.hasNetem(0) {
 		command := ""
-		if n.Bandwidth != "" {
-			command = "tc qdisc replace dev eth0 parent 1:1 netem"
+		if shape.tbf {
+			command = fmt.Sprintf("tc qdisc %s dev %s parent 1:1 netem", verb, dev)
 		} else {
-			command = "tc qdisc replace dev eth0 root netem"
+			command = fmt.Sprintf("tc qdisc %s dev %s root netem", verb, dev)
 		}
 		commands = append(commands, command+n.buildNetemCommand())
-		shapingApplied = true
 	}
+	return commands, nil
+}
 
-	if shapingApplied {
-		commands = append(commands,
-			"printf 'qdisc after:\\n'",
-			"tc qdisc show dev eth0",
-		)
+// burstSize returns the burst buffer size in bytes for a rate, based on a burst duration of 5ms
+func burstSize(rate string) (float64, error) {
+	bitsPerSecond, err := ParseSize(rate)
+	if err != nil {
+		return 0, err
 	}
+	return bitsPerSecond * 0.005 / 8, nil
+}
 
-	return strings.Join(commands, " && ")
+// unlimitedRate is the rate of HTB classes and tbf qdiscs without a bandwidth
+const unlimitedRate = "10gbit"
+
+// ruleCommands returns the HTB hierarchy of a network configuration with rules. Traffic that matches
+// no rule goes to the default class 1:1, shaped by the network configuration itself. Every rule gets
+// the class 1:<index+2>, shaped by the rule merged over the network configuration, with a netem leaf
+// if needed. Filters are added for the rules with an address or CIDR as peer, in the order of the rules.
+func (n *Network) ruleCommands(dev, match string, shape tcShape, create bool) ([]string, error) {
+	var commands []string
+	if create {
+		commands = append(commands, fmt.Sprintf("tc qdisc replace dev %s root handle 1: htb default 1", dev))
+	}
+	for i, class := range n.classNetworks() {
+		// The default class is 1:1, the class of rule i is 1:<i+2>
+		minor := i + 1
+		rate := class.Bandwidth
+		if rate == "" {
+			rate = unlimitedRate
+		}
+		burst, err := burstSize(rate)
+		if err != nil {
+			if i > 0 {
+				return nil, fmt.Errorf("rule for peer %s: %w", n.Rules[i-1].Peer, err)
+			}
+			return nil, err
+		}
+		if create {
+			commands = append(commands, fmt.Sprintf("tc class add dev %s parent 1: classid 1:%x htb rate %s burst %.f", dev, minor, rate, burst))
+		} else {
+			commands = append(commands, fmt.Sprintf("tc class change dev %s parent 1: classid 1:%x htb rate %s burst %.f", dev, minor, rate, burst))
+		}
+		if shape.hasNetem(i) {
+			verb := "add"
+			if !create {
+				verb = "change"
+			}
+			commands = append(commands, fmt.Sprintf("tc qdisc %s dev %s parent 1:%x handle %x: netem", verb, dev, minor, minor+0x10)+class.buildNetemCommand())
+		}
+		if create && i > 0 {
+			if cidr, ok := peerCIDR(n.Rules[i-1].Peer); ok {
+				commands = append(commands, ruleFilterCommand(dev, match, i-1, cidr))
+			}
+		}
+	}
+	return commands, nil
+}
+
+// ruleClassMinor returns the minor number of the HTB class of the rule with the given index
+func ruleClassMinor(index int) int {
+	return index + 2
+}
+
+// ruleFilterCommand returns the tc filter that sends the traffic to or from cidr to the class of a rule
+func ruleFilterCommand(dev, match string, index int, cidr string) string {
+	return fmt.Sprintf("tc filter add dev %s parent 1: protocol ip prio %d u32 match ip %s %s flowid 1:%x",
+		dev, index+1, match, cidr, ruleClassMinor(index))
+}
+
+// peerCIDR returns the CIDR of a rule peer that is an IPv4 address or CIDR
+func peerCIDR(peer string) (string, bool) {
+	if ip, network, err := net.ParseCIDR(peer); err == nil {
+		if ip.To4() == nil {
+			return "", false
+		}
+		return network.String(), true
+	}
+	if ip := net.ParseIP(peer); ip != nil && ip.To4() != nil {
+		return ip.String() + "/32", true
+	}
+	return "", false
+}
+
+// HasNamedPeers reports whether any rule, including the rules of the ingress, has a pod name as peer.
+// The filters of these rules can only be added once the pods are running.
+func (n *Network) HasNamedPeers() bool {
+	networks := []*Network{n}
+	if n.Ingress != nil {
+		networks = append(networks, n.Ingress)
+	}
+	for _, network := range networks {
+		for _, rule := range network.Rules {
+			if _, ok := peerCIDR(rule.Peer); !ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NeedsTCContainer reports whether the pod needs a container to change its qdisc layout after deployment,
+// to add the filters of rules with a named peer or to apply its schedule
+func (n *Network) NeedsTCContainer() bool {
+	return n.HasNamedPeers() || len(n.Schedule) > 0
+}
+
+// ChangeTime returns the time a change is applied, for an attack that started at start
+func (c NetworkChange) ChangeTime(start time.Time) (time.Time, error) {
+	if offset, err := time.ParseDuration(c.At); err == nil {
+		if offset < 0 {
+			return time.Time{}, fmt.Errorf("negative offset %q", c.At)
+		}
+		return start.Add(offset), nil
+	}
+	at, err := time.Parse(time.RFC3339, c.At)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected an offset such as 30s or an RFC 3339 timestamp", c.At)
+	}
+	return at, nil
+}
+
+// PeerFilterCommands returns the tc filters of the rules with a pod name as peer, matching the IPs of
+// that peer. peers maps the cleaned pod names, and "attacker", onto their IPs.
+func (n *Network) PeerFilterCommands(peers map[string][]string) ([]string, error) {
+	var commands []string
+	add := func(network *Network, dev, match string) error {
+		for i, rule := range network.Rules {
+			if _, ok := peerCIDR(rule.Peer); ok {
+				continue
+			}
+			ips, ok := peers[CleanPodName(rule.Peer)]
+			if !ok {
+				return fmt.Errorf("unknown peer %q", rule.Peer)
+			}
+			for _, ip := range ips {
+				commands = append(commands, ruleFilterCommand(dev, match, i, ip+"/32"))
+			}
+		}
+		return nil
+	}
+	if err := add(n, "eth0", "dst"); err != nil {
+		return nil, err
+	}
+	if n.shapesIngress() {
+		// A schedule may shape ingress while the base state leaves Ingress unset
+		ingress := n.ingress()
+		if err := add(&ingress, IngressDevice, "src"); err != nil {
+			return nil, fmt.Errorf("ingress: %w", err)
+		}
+	}
+	return commands, nil
 }
 
 // needsNetem checks if netem configuration is needed
 func (n *Network) needsNetem() bool {
-	return n.Limit != "" || (n.Delay != "" && n.Delay != "0ms") || (n.Jitter != "" && n.Jitter != "0ms") || n.Distribution != "" || (n.Loss != "" && n.Loss != "0%") || (n.Corrupt != "" && n.Corrupt != "0%") || (n.Duplicate != "" && n.Duplicate != "0%")
+	return n.Limit != "" || (n.Delay != "" && n.Delay != "0ms") || (n.Jitter != "" && n.Jitter != "0ms") || n.Distribution != "" || (n.Loss != "" && n.Loss != "0%") || (n.Corrupt != "" && n.Corrupt != "0%") || (n.Duplicate != "" && n.Duplicate != "0%") ||
+		n.LossState != nil || n.LossGemodel != nil || (n.Reorder != "" && n.Reorder != "0%") || n.Rate != "" || n.Slot != nil
 }
 
 // buildNetemCommand builds the netem part of the tc command
@@ -71,19 +390,55 @@ func (n *Network) buildNetemCommand() string {
 		netemCommand += fmt.Sprintf(" delay %s", n.Delay)
 		if n.Jitter != "" && n.Jitter != "0ms" {
 			netemCommand += " " + n.Jitter
+			if n.DelayCorrelation != "" {
+				netemCommand += " " + n.DelayCorrelation
+			}
 			if n.Distribution != "" {
 				netemCommand += fmt.Sprintf(" distribution %s", n.Distribution)
 			}
 		}
 	}
-	if n.Loss != "" && n.Loss != "0%" {
+	switch {
+	case n.LossState != nil:
+		netemCommand += " loss state " + n.LossState.args()
+	case n.LossGemodel != nil:
+		netemCommand += " loss gemodel " + n.LossGemodel.args()
+	case n.Loss != "" && n.Loss != "0%":
 		netemCommand += fmt.Sprintf(" loss random %s", n.Loss)
+		if n.LossCorrelation != "" {
+			netemCommand += " " + n.LossCorrelation
+		}
 	}
 	if n.Corrupt != "" && n.Corrupt != "0%" {
 		netemCommand += fmt.Sprintf(" corrupt %s", n.Corrupt)
+		if n.CorruptCorrelation != "" {
+			netemCommand += " " + n.CorruptCorrelation
+		}
 	}
 	if n.Duplicate != "" && n.Duplicate != "0%" {
 		netemCommand += fmt.Sprintf(" duplicate %s", n.Duplicate)
+		if n.DuplicateCorrelation != "" {
+			netemCommand += " " + n.DuplicateCorrelation
+		}
+	}
+	if n.Reorder != "" && n.Reorder != "0%" {
+		netemCommand += fmt.Sprintf(" reorder %s", n.Reorder)
+		if n.ReorderCorrelation != "" {
+			netemCommand += " " + n.ReorderCorrelation
+		}
+		if n.Gap != "" {
+			netemCommand += fmt.Sprintf(" gap %s", n.Gap)
+		}
+	}
+	if n.Rate != "" {
+		netemCommand += fmt.Sprintf(" rate %s", n.Rate)
+		// The overheads are positional, unset ones before a set one are 0
+		if overheads := positionalArgs("0", n.RatePacketOverhead, n.RateCellSize, n.RateCellOverhead); overheads != "" {
+			netemCommand += " " + overheads
+		}
+	}
+	if n.Slot != nil {
+		netemCommand += " slot " + n.Slot.args()
 	}
 	if n.Seed != "" {
 		netemCommand += fmt.Sprintf(" seed %s", n.Seed)
@@ -91,6 +446,54 @@ func (n *Network) buildNetemCommand() string {
 	return netemCommand
 }
 
+// positionalArgs joins the arguments up to the last one that is set, replacing the unset ones with fill
+func positionalArgs(fill string, args ...string) string {
+	last := -1
+	for i, arg := range args {
+		if arg != "" {
+			last = i
+		}
+	}
+	joined := make([]string, 0, last+1)
+	for _, arg := range args[:last+1] {
+		if arg == "" {
+			arg = fill
+		}
+		joined = append(joined, arg)
+	}
+	return strings.Join(joined, " ")
+}
+
+// args returns the probabilities of the model as netem arguments
+func (m LossState) args() string {
+	return positionalArgs("", m.P13, m.P31, m.P32, m.P23, m.P14)
+}
+
+// args returns the probabilities of the model as netem arguments
+func (m LossGemodel) args() string {
+	return positionalArgs("", m.P, m.R, m.BadLoss, m.GoodLoss)
+}
+
+// args returns the slot as netem arguments
+func (s Slot) args() string {
+	var args []string
+	if s.Distribution != "" {
+		args = append(args, "distribution", s.Distribution, s.Delay, s.Jitter)
+	} else {
+		args = append(args, s.Min)
+		if s.Max != "" {
+			args = append(args, s.Max)
+		}
+	}
+	if s.Packets != "" {
+		args = append(args, "packets", s.Packets)
+	}
+	if s.Bytes != "" {
+		args = append(args, "bytes", s.Bytes)
+	}
+	return strings.Join(args, " ")
+}
+
 // ParseSize parses a size string (e.g., "10Mbit") to a float64 value in bits per second
 func ParseSize(size string) (float64, error) {
 	// Regular expression to match the numerical part and the unit
@@ -128,6 +531,399 @@ func ParseSize(size string) (float64, error) {
 	}
 }
 
+var (
+	tcTimePattern    = regexp.MustCompile(`^\d+(\.\d+)?(us|usec|usecs|ms|msec|msecs|s|sec|secs)?$`)
+	tcPercentPattern = regexp.MustCompile(`^(\d+(\.\d+)?)%?$`)
+	// netemDistributions are the delay distribution tables shipped with iproute2
+	netemDistributions = map[string]bool{"uniform": true, "normal": true, "pareto": true, "paretonormal": true}
+)
+
+// networkIssue is a problem with one field of a network configuration
+type networkIssue struct {
+	field   string
+	message string
+	warning bool
+}
+
+// ErrInvalidNetwork is returned when a scenario is parsed with a network configuration that tc rejects
+var ErrInvalidNetwork = errors.New("invalid network configuration")
+
+// validateNetworks validates the merged network configurations of the pods of a scenario, keyed by pod
+func validateNetworks(networks map[string]Network) error {
+	pods := make([]string, 0, len(networks))
+	for pod := range networks {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+	var errs []error
+	for _, pod := range pods {
+		if err := networks[pod].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%w of %s: %w", ErrInvalidNetwork, pod, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks that every tc parameter of the network configuration, including its ingress, is accepted by tc
+func (n Network) Validate() error {
+	var errs []error
+	for _, issue := range n.issues() {
+		if !issue.warning {
+			errs = append(errs, fmt.Errorf("%s: %s", issue.field, issue.message))
+		}
+	}
+	if n.Ingress != nil {
+		for _, issue := range n.Ingress.issues() {
+			if !issue.warning {
+				errs = append(errs, fmt.Errorf("ingress.%s: %s", issue.field, issue.message))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// issues returns the invalid tc parameters of the network configuration and its rules, and the parameters
+// that are ignored by GetTCCommand as warnings. The parameters of its ingress are not included.
+func (n Network) issues() []networkIssue {
+	var issues []networkIssue
+	invalid := func(field, format string, args ...interface{}) {
+		issues = append(issues, networkIssue{field: field, message: fmt.Sprintf(format, args...)})
+	}
+	if n.Ingress != nil && n.Ingress.Ingress != nil {
+		invalid("ingress.ingress", "ingress cannot have an ingress of its own")
+	}
+	if n.Ingress != nil && len(n.Ingress.Schedule) > 0 {
+		invalid("ingress.schedule", "ingress cannot have a schedule, set ingress in the changes of the schedule instead")
+	}
+	for i, rule := range n.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		switch {
+		case rule.Peer == "":
+			invalid(field+".peer", "no peer provided")
+		case strings.Contains(rule.Peer, "/") || net.ParseIP(rule.Peer) != nil:
+			if _, ok := peerCIDR(rule.Peer); !ok {
+				invalid(field+".peer", "invalid peer %q, expected an IPv4 address or CIDR", rule.Peer)
+			}
+		}
+		if rule.Ingress != nil {
+			invalid(field+".ingress", "rules cannot have an ingress, use ingress.rules instead")
+		}
+		if len(rule.Rules) > 0 {
+			invalid(field+".rules", "rules cannot have rules of their own")
+		}
+		if len(rule.Schedule) > 0 {
+			invalid(field+".schedule", "rules cannot have a schedule of their own")
+		}
+		issues = append(issues, n.nestedIssues(field, rule.Network)...)
+		if rule.QueueSize != "" {
+			issues = append(issues, networkIssue{field: field + ".queueSize", message: "ignored in rules", warning: true})
+		}
+	}
+	for i, change := range n.Schedule {
+		field := fmt.Sprintf("schedule[%d]", i)
+		if change.At == "" {
+			invalid(field+".at", "no time provided")
+		} else if _, err := change.ChangeTime(time.Time{}); err != nil {
+			invalid(field+".at", "%v", err)
+		}
+		if len(change.Rules) > 0 {
+			invalid(field+".rules", "changes cannot change the rules")
+		}
+		if len(change.Schedule) > 0 {
+			invalid(field+".schedule", "changes cannot have a schedule of their own")
+		}
+		issues = append(issues, n.nestedIssues(field, change.Network)...)
+		if change.Ingress != nil {
+			for _, issue := range change.Ingress.issues() {
+				if !issue.warning {
+					issue.field = field + ".ingress." + issue.field
+					issues = append(issues, issue)
+				}
+			}
+		}
+	}
+
+	if n.Bandwidth != "" {
+		if _, err := ParseSize(n.Bandwidth); err != nil {
+			invalid("bandwidth", "invalid rate %q, expected a number with an optional bit, kbit, mbit, gbit or tbit unit", n.Bandwidth)
+		}
+	}
+	checkTime := func(name, value string) {
+		if value != "" && !tcTimePattern.MatchString(value) {
+			invalid(name, "invalid time %q, expected a number with an optional us, ms or s unit", value)
+		}
+	}
+	for _, field := range []struct{ name, value string }{{"queueSize", n.QueueSize}, {"delay", n.Delay}, {"jitter", n.Jitter}} {
+		checkTime(field.name, field.value)
+	}
+	if n.Limit != "" {
+		if _, err := strconv.ParseUint(n.Limit, 10, 32); err != nil {
+			invalid("limit", "invalid packet limit %q", n.Limit)
+		}
+	}
+	if n.Distribution != "" && !netemDistributions[n.Distribution] {
+		invalid("distribution", "unknown distribution %q (supported: normal, pareto, paretonormal, uniform)", n.Distribution)
+	}
+	checkPercent := func(name, value string) {
+		if value == "" {
+			return
+		}
+		matches := tcPercentPattern.FindStringSubmatch(value)
+		if matches == nil {
+			invalid(name, "invalid percentage %q", value)
+			return
+		}
+		if percentage, _ := strconv.ParseFloat(matches[1], 64); percentage > 100 {
+			invalid(name, "percentage %q exceeds 100%%", value)
+		}
+	}
+	for _, field := range []struct{ name, value string }{
+		{"loss", n.Loss}, {"corrupt", n.Corrupt}, {"duplicate", n.Duplicate}, {"reorder", n.Reorder},
+		{"delayCorrelation", n.DelayCorrelation}, {"lossCorrelation", n.LossCorrelation}, {"corruptCorrelation", n.CorruptCorrelation},
+		{"duplicateCorrelation", n.DuplicateCorrelation}, {"reorderCorrelation", n.ReorderCorrelation},
+	} {
+		checkPercent(field.name, field.value)
+	}
+	checkCount := func(name, value, what string) {
+		if value != "" {
+			if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+				invalid(name, "invalid %s %q", what, value)
+			}
+		}
+	}
+	checkCount("gap", n.Gap, "packet distance")
+	if n.Seed != "" {
+		if _, err := parseSeed(n.Seed); err != nil {
+			invalid("seed", "invalid seed %q, expected an unsigned 64-bit integer", n.Seed)
+		}
+	}
+
+	if n.Rate != "" {
+		if _, err := ParseSize(n.Rate); err != nil {
+			invalid("rate", "invalid rate %q, expected a number with an optional bit, kbit, mbit, gbit or tbit unit", n.Rate)
+		}
+	}
+	for _, field := range []struct{ name, value string }{{"ratePacketOverhead", n.RatePacketOverhead}, {"rateCellOverhead", n.RateCellOverhead}} {
+		if field.value != "" {
+			if _, err := strconv.ParseInt(field.value, 10, 32); err != nil {
+				invalid(field.name, "invalid overhead %q, expected a number of bytes", field.value)
+			}
+		}
+	}
+	checkCount("rateCellSize", n.RateCellSize, "cell size")
+
+	models := 0
+	for _, set := range []bool{n.Loss != "", n.LossState != nil, n.LossGemodel != nil} {
+		if set {
+			models++
+		}
+	}
+	if models > 1 {
+		invalid("loss", "loss, lossState and lossGemodel exclude each other")
+	}
+	checkProbabilities := func(model string, probabilities []struct{ name, value string }) {
+		if probabilities[0].value == "" {
+			invalid(model+"."+probabilities[0].name, "no probability provided")
+		}
+		for i, probability := range probabilities {
+			checkPercent(model+"."+probability.name, probability.value)
+			if i > 0 && probability.value != "" && probabilities[i-1].value == "" {
+				invalid(model+"."+probability.name, "requires %s", probabilities[i-1].name)
+			}
+		}
+	}
+	if m := n.LossState; m != nil {
+		checkProbabilities("lossState", []struct{ name, value string }{{"p13", m.P13}, {"p31", m.P31}, {"p32", m.P32}, {"p23", m.P23}, {"p14", m.P14}})
+	}
+	if m := n.LossGemodel; m != nil {
+		checkProbabilities("lossGemodel", []struct{ name, value string }{{"p", m.P}, {"r", m.R}, {"badLoss", m.BadLoss}, {"goodLoss", m.GoodLoss}})
+	}
+
+	if slot := n.Slot; slot != nil {
+		if slot.Distribution != "" {
+			if !netemDistributions[slot.Distribution] {
+				invalid("slot.distribution", "unknown distribution %q (supported: normal, pareto, paretonormal, uniform)", slot.Distribution)
+			}
+			if slot.Delay == "" || slot.Jitter == "" {
+				invalid("slot.distribution", "requires delay and jitter")
+			}
+			if slot.Min != "" || slot.Max != "" {
+				invalid("slot.distribution", "min and max cannot be combined with a distribution")
+			}
+		} else {
+			if slot.Min == "" {
+				invalid("slot.min", "no slot duration provided, set min or a distribution with delay and jitter")
+			}
+			if slot.Delay != "" || slot.Jitter != "" {
+				invalid("slot.delay", "delay and jitter require a distribution")
+			}
+		}
+		for _, field := range []struct{ name, value string }{{"min", slot.Min}, {"max", slot.Max}, {"delay", slot.Delay}, {"jitter", slot.Jitter}} {
+			checkTime("slot."+field.name, field.value)
+		}
+		checkCount("slot.packets", slot.Packets, "packet count")
+		checkCount("slot.bytes", slot.Bytes, "byte count")
+	}
+
+	if n.QueueSize != "" && len(n.Rules) > 0 {
+		issues = append(issues, networkIssue{field: "queueSize", message: "ignored with rules", warning: true})
+	} else if n.QueueSize != "" && n.Bandwidth == "" {
+		issues = append(issues, networkIssue{field: "queueSize", message: "ignored without bandwidth", warning: true})
+	}
+	ignored := func(field, message string) {
+		issues = append(issues, networkIssue{field: field, message: message, warning: true})
+	}
+	noJitter := n.Jitter == "" || n.Jitter == "0ms"
+	if n.Distribution != "" && noJitter {
+		ignored("distribution", "ignored without jitter")
+	}
+	if n.DelayCorrelation != "" && noJitter {
+		ignored("delayCorrelation", "ignored without jitter")
+	}
+	if n.LossCorrelation != "" && (n.Loss == "" || n.Loss == "0%" || n.LossState != nil || n.LossGemodel != nil) {
+		ignored("lossCorrelation", "ignored without random loss")
+	}
+	if n.CorruptCorrelation != "" && (n.Corrupt == "" || n.Corrupt == "0%") {
+		ignored("corruptCorrelation", "ignored without corrupt")
+	}
+	if n.DuplicateCorrelation != "" && (n.Duplicate == "" || n.Duplicate == "0%") {
+		ignored("duplicateCorrelation", "ignored without duplicate")
+	}
+	noReorder := n.Reorder == "" || n.Reorder == "0%"
+	if n.ReorderCorrelation != "" && noReorder {
+		ignored("reorderCorrelation", "ignored without reorder")
+	}
+	if n.Gap != "" && noReorder {
+		ignored("gap", "ignored without reorder")
+	}
+	// Packets are only reordered if the others are delayed
+	if !noReorder && (n.Delay == "" || n.Delay == "0ms") {
+		ignored("reorder", "ignored without delay")
+	}
+	for _, field := range []struct{ name, value string }{
+		{"ratePacketOverhead", n.RatePacketOverhead}, {"rateCellSize", n.RateCellSize}, {"rateCellOverhead", n.RateCellOverhead},
+	} {
+		if field.value != "" && n.Rate == "" {
+			ignored(field.name, "ignored without rate")
+		}
+	}
+	if n.RateCellOverhead != "" && n.RateCellSize == "" {
+		ignored("rateCellOverhead", "ignored without rateCellSize")
+	}
+	return issues
+}
+
+// nestedIssues returns the issues of a rule or change at field. Parameters are invalid as written, but
+// only ignored after merging them over the network. Inherited parameters that are ignored are reported
+// at the network itself.
+func (n Network) nestedIssues(field string, nested Network) []networkIssue {
+	var issues []networkIssue
+	for _, issue := range nested.issues() {
+		if !issue.warning && !strings.HasPrefix(issue.field, "rules[") && !strings.HasPrefix(issue.field, "schedule[") {
+			issue.field = field + "." + issue.field
+			issues = append(issues, issue)
+		}
+	}
+	base := n
+	base.Rules, base.Ingress, base.Schedule = nil, nil, nil
+	for _, issue := range MergeNetworks(base, nested).issues() {
+		if issue.warning && issue.field != "queueSize" && nested.value(issue.field) != "" {
+			issue.field = field + "." + issue.field
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// networkFields are the YAML field names of the tc parameters of a network configuration
+var networkFields = []string{
+	"bandwidth", "queueSize", "limit", "delay", "jitter", "delayCorrelation", "distribution", "loss", "lossCorrelation",
+	"lossState", "lossGemodel", "corrupt", "corruptCorrelation", "duplicate", "duplicateCorrelation", "reorder",
+	"reorderCorrelation", "gap", "rate", "ratePacketOverhead", "rateCellSize", "rateCellOverhead", "slot", "seed",
+}
+
+// settings describes the parameters that are set, such as "delay=80ms loss=5% ingress.delay=10ms"
+func (n Network) settings() string {
+	var settings []string
+	for _, field := range networkFields {
+		if value := n.value(field); value != "" {
+			settings = append(settings, field+"="+value)
+		}
+	}
+	if n.Ingress != nil {
+		for _, field := range networkFields {
+			if value := n.Ingress.value(field); value != "" {
+				settings = append(settings, "ingress."+field+"="+value)
+			}
+		}
+	}
+	return strings.Join(settings, " ")
+}
+
+// value returns the network parameter with the given YAML field name
+func (n Network) value(field string) string {
+	switch field {
+	case "bandwidth":
+		return n.Bandwidth
+	case "queueSize":
+		return n.QueueSize
+	case "limit":
+		return n.Limit
+	case "delay":
+		return n.Delay
+	case "jitter":
+		return n.Jitter
+	case "distribution":
+		return n.Distribution
+	case "loss":
+		return n.Loss
+	case "corrupt":
+		return n.Corrupt
+	case "duplicate":
+		return n.Duplicate
+	case "seed":
+		return n.Seed
+	case "delayCorrelation":
+		return n.DelayCorrelation
+	case "lossCorrelation":
+		return n.LossCorrelation
+	case "corruptCorrelation":
+		return n.CorruptCorrelation
+	case "duplicateCorrelation":
+		return n.DuplicateCorrelation
+	case "reorder":
+		return n.Reorder
+	case "reorderCorrelation":
+		return n.ReorderCorrelation
+	case "gap":
+		return n.Gap
+	case "rate":
+		return n.Rate
+	case "ratePacketOverhead":
+		return n.RatePacketOverhead
+	case "rateCellSize":
+		return n.RateCellSize
+	case "rateCellOverhead":
+		return n.RateCellOverhead
+	}
+	// The parameters of the loss models and slots are returned as their netem arguments
+	switch model, _, _ := strings.Cut(field, "."); model {
+	case "lossState":
+		if n.LossState != nil {
+			return n.LossState.args()
+		}
+	case "lossGemodel":
+		if n.LossGemodel != nil {
+			return n.LossGemodel.args()
+		}
+	case "slot":
+		if n.Slot != nil {
+			return n.Slot.args()
+		}
+	}
+	return ""
+}
+
 // MergeNetworks merges two Network configurations, with the second one taking precedence
 // If a field in the second network is empty, the value from the first network is used
 func MergeNetworks(base, override Network) Network {
@@ -164,6 +960,69 @@ func MergeNetworks(base, override Network) Network {
 	if override.Seed != "" {
 		result.Seed = override.Seed
 	}
+	if override.DelayCorrelation != "" {
+		result.DelayCorrelation = override.DelayCorrelation
+	}
+	// Random loss and the loss models exclude each other, the loss of the override replaces that of the base
+	if override.Loss != "" || override.LossState != nil || override.LossGemodel != nil {
+		result.Loss, result.LossCorrelation, result.LossState, result.LossGemodel = override.Loss, override.LossCorrelation, nil, nil
+		if override.LossState != nil {
+			lossState := *override.LossState
+			result.LossState = &lossState
+		}
+		if override.LossGemodel != nil {
+			lossGemodel := *override.LossGemodel
+			result.LossGemodel = &lossGemodel
+		}
+	} else if override.LossCorrelation != "" {
+		result.LossCorrelation = override.LossCorrelation
+	}
+	if override.CorruptCorrelation != "" {
+		result.CorruptCorrelation = override.CorruptCorrelation
+	}
+	if override.DuplicateCorrelation != "" {
+		result.DuplicateCorrelation = override.DuplicateCorrelation
+	}
+	if override.Reorder != "" {
+		result.Reorder = override.Reorder
+	}
+	if override.ReorderCorrelation != "" {
+		result.ReorderCorrelation = override.ReorderCorrelation
+	}
+	if override.Gap != "" {
+		result.Gap = override.Gap
+	}
+	if override.Rate != "" {
+		result.Rate = override.Rate
+	}
+	if override.RatePacketOverhead != "" {
+		result.RatePacketOverhead = override.RatePacketOverhead
+	}
+	if override.RateCellSize != "" {
+		result.RateCellSize = override.RateCellSize
+	}
+	if override.RateCellOverhead != "" {
+		result.RateCellOverhead = override.RateCellOverhead
+	}
+	// A slot is either a duration range or a distribution, the slot of the override replaces that of the base
+	if override.Slot != nil {
+		slot := *override.Slot
+		result.Slot = &slot
+	}
+	if override.Ingress != nil {
+		ingress := *override.Ingress
+		if base.Ingress != nil {
+			ingress = MergeNetworks(*base.Ingress, *override.Ingress)
+		}
+		result.Ingress = &ingress
+	}
+	// Rules and schedules are not merged one by one, those of the override replace those of the base
+	if len(override.Rules) > 0 {
+		result.Rules = append([]NetworkRule(nil), override.Rules...)
+	}
+	if len(override.Schedule) > 0 {
+		result.Schedule = append([]NetworkChange(nil), override.Schedule...)
+	}
 
 	return result
 }
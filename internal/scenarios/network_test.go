@@ -1,6 +1,7 @@
 package scenarios
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -47,3 +48,372 @@ func TestGetTCCommandWithShapingShowsUpdatedQdisc(t *testing.T) {
 		t.Fatalf("GetTCCommand() should show qdisc twice, got %q", command)
 	}
 }
+
+func TestGetTCCommandShapesIngressOnIFB(t *testing.T) {
+	command := (&Network{
+		Bandwidth: "100mbit",
+		Ingress:   &Network{Bandwidth: "10mbit", Delay: "50ms"},
+	}).GetTCCommand()
+
+	checks := []string{
+		"tc qdisc replace dev eth0 root handle 1: tbf rate 100mbit burst 62500 latency 100ms",
+		"ip link add ifb0 type ifb && ip link set dev ifb0 up",
+		"tc qdisc add dev eth0 handle ffff: ingress",
+		"tc filter add dev eth0 parent ffff: protocol all u32 match u32 0 0 action mirred egress redirect dev ifb0",
+		"tc qdisc replace dev ifb0 root handle 1: tbf rate 10mbit burst 6250 latency 100ms",
+		"tc qdisc replace dev ifb0 parent 1:1 netem delay 50ms",
+		"tc qdisc show dev ifb0",
+	}
+	for _, check := range checks {
+		if !strings.Contains(command, check) {
+			t.Fatalf("GetTCCommand() missing %q in %q", check, command)
+		}
+	}
+}
+
+func TestGetTCCommandWithoutIngressShapingSkipsIFB(t *testing.T) {
+	command := (&Network{Delay: "10ms", Ingress: &Network{}}).GetTCCommand()
+
+	if strings.Contains(command, "ifb0") {
+		t.Fatalf("GetTCCommand() created an IFB device without ingress shaping: %q", command)
+	}
+}
+
+func TestMergeNetworksMergesIngress(t *testing.T) {
+	base := Network{Delay: "10ms", Ingress: &Network{Bandwidth: "10mbit", Delay: "5ms"}}
+	override := Network{Ingress: &Network{Delay: "20ms"}}
+
+	merged := MergeNetworks(base, override)
+	if merged.Delay != "10ms" {
+		t.Fatalf("merged Delay = %q, want %q", merged.Delay, "10ms")
+	}
+	if merged.Ingress == nil || merged.Ingress.Bandwidth != "10mbit" || merged.Ingress.Delay != "20ms" {
+		t.Fatalf("merged Ingress = %+v, want bandwidth 10mbit and delay 20ms", merged.Ingress)
+	}
+	if base.Ingress.Delay != "5ms" {
+		t.Fatalf("MergeNetworks modified the base ingress: %+v", base.Ingress)
+	}
+}
+
+func TestNetworkValidateReportsIngressFields(t *testing.T) {
+	err := Network{Ingress: &Network{Loss: "120%"}}.Validate()
+	if err == nil || !strings.Contains(err.Error(), "ingress.loss") {
+		t.Fatalf("Validate() = %v, want an ingress.loss error", err)
+	}
+}
+
+func TestGetTCCommandBuildsHTBClassesForRules(t *testing.T) {
+	command := (&Network{
+		Delay: "1ms",
+		Rules: []NetworkRule{
+			{Peer: "web-server-1", Network: Network{Bandwidth: "10mbit", Delay: "80ms", Loss: "5%"}},
+			{Peer: "10.0.0.0/8", Network: Network{Delay: "0ms"}},
+		},
+	}).GetTCCommand()
+
+	checks := []string{
+		"tc qdisc replace dev eth0 root handle 1: htb default 1",
+		"tc class add dev eth0 parent 1: classid 1:1 htb rate 10gbit burst 6250000",
+		"tc qdisc add dev eth0 parent 1:1 handle 11: netem delay 1ms",
+		"tc class add dev eth0 parent 1: classid 1:2 htb rate 10mbit burst 6250",
+		"tc qdisc add dev eth0 parent 1:2 handle 12: netem delay 80ms loss random 5%",
+		"tc class add dev eth0 parent 1: classid 1:3 htb rate 10gbit burst 6250000",
+		"tc filter add dev eth0 parent 1: protocol ip prio 2 u32 match ip dst 10.0.0.0/8 flowid 1:3",
+		"printf 'qdisc after:\\n'",
+	}
+	for _, check := range checks {
+		if !strings.Contains(command, check) {
+			t.Fatalf("GetTCCommand() missing %q in %q", check, command)
+		}
+	}
+	// The second rule overrides the delay with 0ms, so its class has no netem leaf
+	if strings.Contains(command, "parent 1:3 handle") {
+		t.Fatalf("GetTCCommand() added a netem leaf to a class without netem settings: %q", command)
+	}
+	// Filters of named peers are added once the pods are running
+	if strings.Contains(command, "flowid 1:2") {
+		t.Fatalf("GetTCCommand() added a filter for a named peer: %q", command)
+	}
+}
+
+func TestPeerFilterCommandsMatchPeerIPs(t *testing.T) {
+	network := &Network{
+		Rules: []NetworkRule{
+			{Peer: "192.168.1.1", Network: Network{Delay: "10ms"}},
+			{Peer: "attacker", Network: Network{Delay: "50ms"}},
+		},
+		Ingress: &Network{Rules: []NetworkRule{{Peer: "Web_Server", Network: Network{Loss: "1%"}}}},
+	}
+	if !network.HasNamedPeers() {
+		t.Fatal("HasNamedPeers() = false, want true")
+	}
+
+	peers := map[string][]string{"attacker": {"10.42.0.5", "10.42.0.6"}, "web-server": {"10.42.1.7"}}
+	commands, err := network.PeerFilterCommands(peers)
+	if err != nil {
+		t.Fatalf("PeerFilterCommands returned error: %v", err)
+	}
+	want := []string{
+		"tc filter add dev eth0 parent 1: protocol ip prio 2 u32 match ip dst 10.42.0.5/32 flowid 1:3",
+		"tc filter add dev eth0 parent 1: protocol ip prio 2 u32 match ip dst 10.42.0.6/32 flowid 1:3",
+		"tc filter add dev ifb0 parent 1: protocol ip prio 1 u32 match ip src 10.42.1.7/32 flowid 1:2",
+	}
+	if strings.Join(commands, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("PeerFilterCommands() = %q, want %q", commands, want)
+	}
+
+	if _, err := network.PeerFilterCommands(map[string][]string{"attacker": {"10.42.0.5"}}); err == nil {
+		t.Fatal("PeerFilterCommands() with an unknown peer returned no error")
+	}
+	if (&Network{Rules: []NetworkRule{{Peer: "10.0.0.0/8"}}}).HasNamedPeers() {
+		t.Fatal("HasNamedPeers() = true for a CIDR peer, want false")
+	}
+}
+
+func TestPeerFilterCommandsWithScheduleOnlyIngress(t *testing.T) {
+	network := &Network{
+		Rules:    []NetworkRule{{Peer: "attacker", Network: Network{Delay: "50ms"}}},
+		Schedule: []NetworkChange{{At: "10s", Network: Network{Ingress: &Network{Delay: "50ms"}}}},
+	}
+	if err := network.Validate(); err != nil {
+		t.Fatalf("Validate() returned error: %v", err)
+	}
+	if layout, err := network.TCLayout(); err != nil || !containsCommand(layout, "ip link add ifb0 type ifb") {
+		t.Fatalf("TCLayout() = %q, %v, want an ifb layout", layout, err)
+	}
+
+	commands, err := network.PeerFilterCommands(map[string][]string{"attacker": {"10.42.0.5"}})
+	if err != nil {
+		t.Fatalf("PeerFilterCommands returned error: %v", err)
+	}
+	want := []string{"tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.42.0.5/32 flowid 1:2"}
+	if strings.Join(commands, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("PeerFilterCommands() = %q, want %q", commands, want)
+	}
+}
+
+func TestMergeNetworksReplacesRules(t *testing.T) {
+	base := Network{Rules: []NetworkRule{{Peer: "attacker"}, {Peer: "10.0.0.0/8"}}}
+	if merged := MergeNetworks(base, Network{Delay: "10ms"}); len(merged.Rules) != 2 {
+		t.Fatalf("merged Rules = %+v, want the rules of the base", merged.Rules)
+	}
+	merged := MergeNetworks(base, Network{Rules: []NetworkRule{{Peer: "web-server"}}})
+	if len(merged.Rules) != 1 || merged.Rules[0].Peer != "web-server" {
+		t.Fatalf("merged Rules = %+v, want the rules of the override", merged.Rules)
+	}
+}
+
+func TestNetworkValidateReportsRuleFields(t *testing.T) {
+	err := Network{Rules: []NetworkRule{
+		{Peer: "fe80::/64"},
+		{Peer: "attacker", Network: Network{Loss: "120%", Ingress: &Network{}}},
+	}}.Validate()
+	for _, field := range []string{"rules[0].peer", "rules[1].loss", "rules[1].ingress"} {
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Fatalf("Validate() = %v, want a %s error", err, field)
+		}
+	}
+}
+
+func TestScheduleCommandsChangeQdiscsInPlace(t *testing.T) {
+	network := &Network{
+		Delay: "10ms",
+		Schedule: []NetworkChange{
+			{At: "30s", Network: Network{Loss: "5%"}},
+			{At: "1m", Network: Network{Bandwidth: "1mbit"}},
+		},
+	}
+
+	layout, err := network.TCLayout()
+	if err != nil {
+		t.Fatalf("TCLayout returned error: %v", err)
+	}
+	// The second change limits the bandwidth, so the layout has a tbf qdisc from the start
+	want := []string{
+		"tc qdisc replace dev eth0 root handle 1: tbf rate 10gbit burst 6250000 latency 100ms",
+		"tc qdisc replace dev eth0 parent 1:1 netem delay 10ms",
+	}
+	if strings.Join(layout, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("TCLayout() = %q, want %q", layout, want)
+	}
+
+	for index, want := range [][]string{
+		{
+			"tc qdisc change dev eth0 root handle 1: tbf rate 10gbit burst 6250000 latency 100ms",
+			"tc qdisc change dev eth0 parent 1:1 netem delay 10ms loss random 5%",
+		},
+		{
+			"tc qdisc change dev eth0 root handle 1: tbf rate 1mbit burst 625 latency 100ms",
+			"tc qdisc change dev eth0 parent 1:1 netem delay 10ms",
+		},
+	} {
+		commands, err := network.ScheduleCommands(index)
+		if err != nil {
+			t.Fatalf("ScheduleCommands(%d) returned error: %v", index, err)
+		}
+		if strings.Join(commands, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("ScheduleCommands(%d) = %q, want %q", index, commands, want)
+		}
+	}
+}
+
+func TestScheduleCommandsChangeRuleClasses(t *testing.T) {
+	network := &Network{
+		Rules:    []NetworkRule{{Peer: "10.0.0.0/8", Network: Network{Delay: "50ms"}}},
+		Schedule: []NetworkChange{{At: "10s", Network: Network{Loss: "20%", Ingress: &Network{Delay: "5ms"}}}},
+	}
+
+	layout, err := network.TCLayout()
+	if err != nil {
+		t.Fatalf("TCLayout returned error: %v", err)
+	}
+	// The default class only needs netem after the change, and only the change shapes the ingress
+	for _, check := range []string{
+		"tc qdisc add dev eth0 parent 1:1 handle 11: netem",
+		"tc qdisc add dev eth0 parent 1:2 handle 12: netem delay 50ms",
+		"ip link add ifb0 type ifb",
+		"tc qdisc replace dev ifb0 root netem",
+	} {
+		if !containsCommand(layout, check) {
+			t.Fatalf("TCLayout() missing %q in %q", check, layout)
+		}
+	}
+
+	commands, err := network.ScheduleCommands(0)
+	if err != nil {
+		t.Fatalf("ScheduleCommands returned error: %v", err)
+	}
+	want := []string{
+		"tc class change dev eth0 parent 1: classid 1:1 htb rate 10gbit burst 6250000",
+		"tc qdisc change dev eth0 parent 1:1 handle 11: netem loss random 20%",
+		"tc class change dev eth0 parent 1: classid 1:2 htb rate 10gbit burst 6250000",
+		"tc qdisc change dev eth0 parent 1:2 handle 12: netem delay 50ms loss random 20%",
+		"tc qdisc change dev ifb0 root netem delay 5ms",
+	}
+	if strings.Join(commands, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("ScheduleCommands(0) = %q, want %q", commands, want)
+	}
+}
+
+func TestNetworkValidateReportsScheduleFields(t *testing.T) {
+	err := Network{Schedule: []NetworkChange{
+		{At: "tomorrow"},
+		{At: "2024-05-01T10:00:00Z", Network: Network{Delay: "slow", Rules: []NetworkRule{{Peer: "attacker"}}}},
+	}}.Validate()
+	for _, field := range []string{"schedule[0].at", "schedule[1].delay", "schedule[1].rules"} {
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Fatalf("Validate() = %v, want a %s error", err, field)
+		}
+	}
+}
+
+// containsCommand reports whether commands holds a command with the given prefix
+func containsCommand(commands []string, prefix string) bool {
+	for _, command := range commands {
+		if strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGetTCCommandBuildsAdvancedNetemOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		network Network
+		want    string
+	}{
+		{
+			name:    "correlations",
+			network: Network{Delay: "50ms", Jitter: "10ms", DelayCorrelation: "25%", Loss: "1%", LossCorrelation: "30%", Corrupt: "0.1%", CorruptCorrelation: "5%"},
+			want:    "netem delay 50ms 10ms 25% loss random 1% 30% corrupt 0.1% 5%",
+		},
+		{
+			name:    "reorder",
+			network: Network{Delay: "10ms", Reorder: "25%", ReorderCorrelation: "50%", Gap: "5"},
+			want:    "netem delay 10ms reorder 25% 50% gap 5",
+		},
+		{
+			name:    "gilbert-elliott",
+			network: Network{LossGemodel: &LossGemodel{P: "1%", R: "10%", BadLoss: "70%"}},
+			want:    "netem loss gemodel 1% 10% 70%",
+		},
+		{
+			name:    "markov",
+			network: Network{LossState: &LossState{P13: "5%", P31: "90%"}},
+			want:    "netem loss state 5% 90%",
+		},
+		{
+			name:    "rate with cell overhead",
+			network: Network{Rate: "1mbit", RateCellSize: "48", RateCellOverhead: "5"},
+			want:    "netem rate 1mbit 0 48 5",
+		},
+		{
+			name:    "slot range",
+			network: Network{Slot: &Slot{Min: "800us", Max: "8ms", Packets: "42"}},
+			want:    "netem slot 800us 8ms packets 42",
+		},
+		{
+			name:    "slot distribution",
+			network: Network{Slot: &Slot{Distribution: "pareto", Delay: "10ms", Jitter: "5ms", Bytes: "1500"}},
+			want:    "netem slot distribution pareto 10ms 5ms bytes 1500",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.network.Validate(); err != nil {
+				t.Fatalf("Validate() = %v", err)
+			}
+			if command := tt.network.GetTCCommand(); !strings.Contains(command, "root "+tt.want) {
+				t.Fatalf("GetTCCommand() = %q, want %q", command, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeNetworksReplacesLossModel(t *testing.T) {
+	base := Network{Loss: "1%", LossCorrelation: "25%", Slot: &Slot{Min: "1ms"}}
+	merged := MergeNetworks(base, Network{LossGemodel: &LossGemodel{P: "1%"}, Slot: &Slot{Distribution: "normal", Delay: "5ms", Jitter: "1ms"}})
+	if merged.Loss != "" || merged.LossCorrelation != "" || merged.LossGemodel == nil || merged.LossGemodel.P != "1%" {
+		t.Fatalf("merged loss = %q %q %+v, want only the gemodel of the override", merged.Loss, merged.LossCorrelation, merged.LossGemodel)
+	}
+	if merged.Slot.Min != "" || merged.Slot.Distribution != "normal" {
+		t.Fatalf("merged Slot = %+v, want the slot of the override", merged.Slot)
+	}
+	if merged := MergeNetworks(base, Network{LossCorrelation: "50%"}); merged.Loss != "1%" || merged.LossCorrelation != "50%" {
+		t.Fatalf("merged loss = %q %q, want 1%% 50%%", merged.Loss, merged.LossCorrelation)
+	}
+}
+
+func TestNetworkValidateReportsAdvancedNetemFields(t *testing.T) {
+	err := Network{
+		Loss:               "1%",
+		LossGemodel:        &LossGemodel{R: "10%"},
+		ReorderCorrelation: "150%",
+		Gap:                "-1",
+		Rate:               "fast",
+		RateCellOverhead:   "x",
+		Slot:               &Slot{Distribution: "gamma", Min: "1ms"},
+	}.Validate()
+	for _, field := range []string{"loss", "lossGemodel.p", "reorderCorrelation", "gap", "rate", "rateCellOverhead", "slot.distribution"} {
+		if err == nil || !strings.Contains(err.Error(), field+":") {
+			t.Fatalf("Validate() = %v, want a %s error", err, field)
+		}
+	}
+}
+
+func TestCreateScenarioRejectsInvalidNetwork(t *testing.T) {
+	source := ScenarioSource{Name: "scan", YAML: []byte(`attacker:
+  image: instrumentisto/nmap:latest
+  atkCommand: nmap $TARGET_IP
+target:
+  image: httpd:2.4.38
+  network:
+    slot:
+      max: 10ms
+`)}
+	_, err := CreateScenarioFromSource(source)
+	if !errors.Is(err, ErrInvalidNetwork) || !strings.Contains(err.Error(), "target: slot.min") {
+		t.Fatalf("CreateScenarioFromSource() = %v, want an invalid slot.min of the target", err)
+	}
+}
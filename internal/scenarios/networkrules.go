@@ -0,0 +1,89 @@
+package scenarios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+)
+
+// PeerAttacker is the rule peer that matches every attacker of a scenario
+const PeerAttacker = "attacker"
+
+// execInTCContainer runs a shell command in the tc container of a pod, tests replace it
+var execInTCContainer = func(ctx context.Context, podName, cmd string) (string, string, error) {
+	return kubeapi.ExecShellInContainer(ctx, kubeapi.WorkloadNamespace, podName, TCContainerName, cmd)
+}
+
+// shapedPod is a deployed pod with the network configuration it was built with
+type shapedPod struct {
+	podSpec kubeapi.RunningPodSpec
+	network *Network
+	// tcCommands records the tc commands that shaped the traffic of the pod
+	tcCommands *[]string
+}
+
+// backgroundShapedPods returns the deployed background client pods
+func backgroundShapedPods(clients []BackgroundClient, podSpecs []kubeapi.RunningPodSpec) []shapedPod {
+	pods := make([]shapedPod, 0, len(podSpecs))
+	for i, podSpec := range podSpecs {
+		pods = append(pods, shapedPod{podSpec: podSpec, network: &clients[i].Network, tcCommands: &clients[i].TCCommands})
+	}
+	return pods
+}
+
+// networkPeers maps the names of the deployed pods onto their IPs, and attacker onto the IPs of every attacker
+func networkPeers(attackPodSpecs, targetPodSpecs, backgroundPodSpecs []kubeapi.RunningPodSpec) map[string][]string {
+	peers := make(map[string][]string)
+	add := func(name, ip string) {
+		for _, existing := range peers[name] {
+			if existing == ip {
+				return
+			}
+		}
+		peers[name] = append(peers[name], ip)
+	}
+	for _, podSpec := range attackPodSpecs {
+		add(PeerAttacker, podSpec.PodIP)
+	}
+	for _, podSpecs := range [][]kubeapi.RunningPodSpec{attackPodSpecs, targetPodSpecs, backgroundPodSpecs} {
+		for _, podSpec := range podSpecs {
+			add(podSpec.ContainerName, podSpec.PodIP)
+		}
+	}
+	return peers
+}
+
+// applyNetworkRules adds the tc filters of the rules with a named peer to the deployed pods, and records
+// the tc commands that shaped the traffic of every pod
+func applyNetworkRules(ctx context.Context, pods []shapedPod, peers map[string][]string) error {
+	var errs []error
+	for _, pod := range pods {
+		layout, err := pod.network.TCLayout()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("build tc layout of pod %s: %w", pod.podSpec.PodName, err))
+			continue
+		}
+		filters, err := pod.network.PeerFilterCommands(peers)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("network rules of pod %s: %w", pod.podSpec.PodName, err))
+			continue
+		}
+		if len(filters) > 0 {
+			log.Printf("Adding %d tc filters for network rules to pod %v", len(filters), pod.podSpec.PodName)
+			_, stde, err := execInTCContainer(ctx, pod.podSpec.PodName, strings.Join(filters, " && "))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("add tc filters to pod %s: %w", pod.podSpec.PodName, err))
+				continue
+			}
+			if stde != "" {
+				log.Printf("tc filters of pod %s stderr: %s", pod.podSpec.PodName, stde)
+			}
+		}
+		*pod.tcCommands = append(layout, filters...)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,137 @@
+package scenarios
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NetworkChangesFileName is the file in the output of a scenario that logs every applied network change
+const NetworkChangesFileName = "network-changes.csv"
+
+// networkShaper is implemented by scenarios whose pods are shaped by a network configuration
+type networkShaper interface {
+	shapedPods() []shapedPod
+}
+
+// scheduledChange is a change of the schedule of a pod, with the time it is applied
+type scheduledChange struct {
+	pod   shapedPod
+	index int
+	at    time.Time
+}
+
+// scheduledChanges returns the changes of the schedules of the pods, in the order they are applied
+func scheduledChanges(pods []shapedPod, start time.Time) ([]scheduledChange, error) {
+	var changes []scheduledChange
+	for _, pod := range pods {
+		for i, change := range pod.network.Schedule {
+			at, err := change.ChangeTime(start)
+			if err != nil {
+				return nil, fmt.Errorf("schedule of pod %s: %w", pod.podSpec.PodName, err)
+			}
+			changes = append(changes, scheduledChange{pod: pod, index: i, at: at})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].at.Before(changes[j].at)
+	})
+	return changes, nil
+}
+
+// startNetworkSchedules applies the network schedules of the pods of a scenario in the background, for an
+// attack that started at start, and logs the applied changes to the output directory. The returned function
+// stops applying changes and returns the error that stopped the schedules early, if any.
+func startNetworkSchedules(ctx context.Context, s ScenarioInterface, outputDir string, start time.Time) (func() error, error) {
+	stop := func() error { return nil }
+	shaper, ok := s.(networkShaper)
+	if !ok {
+		return stop, nil
+	}
+	changes, err := scheduledChanges(shaper.shapedPods(), start)
+	if err != nil || len(changes) == 0 {
+		return stop, err
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return stop, fmt.Errorf("create output directory: %w", err)
+	}
+	file, err := os.Create(filepath.Join(outputDir, NetworkChangesFileName))
+	if err != nil {
+		return stop, fmt.Errorf("create network changes log: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- runNetworkSchedules(ctx, changes, file)
+	}()
+	return func() error {
+		cancel()
+		err := <-done
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("write network changes log: %w", closeErr)
+		}
+		return err
+	}, nil
+}
+
+// runNetworkSchedules applies every change at its time until ctx is done, and logs the applied changes to w
+// as CSV rows with the time the change took effect. Changes whose time has passed are applied immediately.
+func runNetworkSchedules(ctx context.Context, changes []scheduledChange, w io.Writer) error {
+	csvWriter := csv.NewWriter(w)
+	write := func(record []string) error {
+		if err := csvWriter.Write(record); err != nil {
+			return fmt.Errorf("write network changes log: %w", err)
+		}
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return fmt.Errorf("write network changes log: %w", err)
+		}
+		return nil
+	}
+	if err := write([]string{"time", "pod", "change", "at", "settings"}); err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		timer := time.NewTimer(time.Until(change.at))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		podName := change.pod.podSpec.PodName
+		commands, err := change.pod.network.ScheduleCommands(change.index)
+		if err != nil {
+			return fmt.Errorf("network change %d of pod %s: %w", change.index, podName, err)
+		}
+		_, stde, err := execInTCContainer(ctx, podName, strings.Join(commands, " && "))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("apply network change %d to pod %s: %w", change.index, podName, err)
+		}
+		if stde != "" {
+			log.Printf("network change %d of pod %s stderr: %s", change.index, podName, stde)
+		}
+
+		settings := change.pod.network.Schedule[change.index].Network.settings()
+		log.Printf("Applied network change %d (%s) to pod %v", change.index, settings, podName)
+		if err := write([]string{time.Now().UTC().Format(time.RFC3339Nano), podName, strconv.Itoa(change.index),
+			change.pod.network.Schedule[change.index].At, settings}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package scenarios
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+)
+
+func TestNetworkSchedulesApplyAndLogChanges(t *testing.T) {
+	applied := make(chan string, 2)
+	original := execInTCContainer
+	execInTCContainer = func(ctx context.Context, podName, cmd string) (string, string, error) {
+		applied <- podName + ": " + cmd
+		return "", "", nil
+	}
+	defer func() {
+		execInTCContainer = original
+	}()
+
+	s := &SingleTargetScenario{
+		Attacker: Attacker{Network: Network{
+			Delay: "10ms",
+			Schedule: []NetworkChange{
+				{At: "1h", Network: Network{Loss: "5%"}},
+				{At: "0s", Network: Network{Delay: "80ms"}},
+			},
+		}},
+		Deployment: SingleTargetDeployment{
+			AttackPodSpec: kubeapi.RunningPodSpec{PodName: "scenario-a-A"},
+			TargetPodSpec: kubeapi.RunningPodSpec{PodName: "scenario-a-T-0"},
+		},
+	}
+	dir := t.TempDir()
+	stop, err := startNetworkSchedules(context.Background(), s, dir, time.Now())
+	if err != nil {
+		t.Fatalf("startNetworkSchedules returned error: %v", err)
+	}
+
+	select {
+	case got := <-applied:
+		if want := "scenario-a-A: tc qdisc change dev eth0 root netem delay 80ms"; got != want {
+			t.Fatalf("applied %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change at 0s was not applied")
+	}
+	// Stopping the schedules skips the change that is due after the attack
+	if err := stop(); err != nil {
+		t.Fatalf("stop returned error: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("applied %q after the schedules were stopped", <-applied)
+	}
+
+	file, err := os.Open(filepath.Join(dir, NetworkChangesFileName))
+	if err != nil {
+		t.Fatalf("open network changes log: %v", err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("parse network changes log: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("network changes log has %d records, want a header and one change: %q", len(records), records)
+	}
+	if got := records[1][1:]; got[0] != "scenario-a-A" || got[1] != "1" || got[2] != "0s" || got[3] != "delay=80ms" {
+		t.Fatalf("logged change = %q, want pod scenario-a-A, change 1 at 0s with delay=80ms", got)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, records[1][0]); err != nil {
+		t.Fatalf("logged time %q is not an RFC 3339 timestamp: %v", records[1][0], err)
+	}
+}
+
+func TestNetworkSchedulesWithoutScheduleWriteNothing(t *testing.T) {
+	s := &SingleTargetScenario{Attacker: Attacker{Network: Network{Delay: "10ms"}}}
+	dir := t.TempDir()
+	stop, err := startNetworkSchedules(context.Background(), s, dir, time.Now())
+	if err != nil {
+		t.Fatalf("startNetworkSchedules returned error: %v", err)
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("stop returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, NetworkChangesFileName)); !os.IsNotExist(err) {
+		t.Fatalf("network changes log exists without a schedule: %v", err)
+	}
+}
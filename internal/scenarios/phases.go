@@ -0,0 +1,32 @@
+package scenarios
+
+import (
+	"context"
+	"time"
+)
+
+// Phases of a scenario run, in the order they are executed
+const (
+	PhaseDeploy     = "deploy"
+	PhaseCapture    = "capture"
+	PhaseAttack     = "attack"
+	PhaseDownload   = "download"
+	PhaseProcessing = "processing"
+)
+
+// PhaseObserver is called with the duration of every phase of a scenario run, also when the phase fails
+type PhaseObserver func(phase string, duration time.Duration)
+
+type phaseObserverKey struct{}
+
+// WithPhaseObserver returns a context that reports the phase durations of the scenario executed with it to observer
+func WithPhaseObserver(ctx context.Context, observer PhaseObserver) context.Context {
+	return context.WithValue(ctx, phaseObserverKey{}, observer)
+}
+
+// ObservePhase reports the duration of a phase that started at start to the observer of the context, if any
+func ObservePhase(ctx context.Context, phase string, start time.Time) {
+	if observer, ok := ctx.Value(phaseObserverKey{}).(PhaseObserver); ok {
+		observer(phase, time.Since(start))
+	}
+}
@@ -2,6 +2,7 @@ package scenarios
 
 import (
 	"fmt"
+	"sort"
 
 	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
 	apiv1 "k8s.io/api/core/v1"
@@ -27,6 +28,8 @@ const (
 	TcpdumpContainerName = "tcpdump"
 	// ReordercapContainerName is the name of the container used to normalize pcap record order
 	ReordercapContainerName = "reordercap"
+	// TCContainerName is the name of the container that changes the qdisc layout of a pod after deployment
+	TCContainerName = "tc"
 	// DataMountPath is the path where captured data is stored in the tcpdump container
 	DataMountPath = "/data"
 	// DataVolumeName is the name of the volume used for storing captured data
@@ -39,6 +42,8 @@ const (
 	LabelConcap = "concap"
 	// LabelScenario is the label key used to identify the scenario
 	LabelScenario = "scenario"
+	// LabelSession is the label key used to identify the controller session that created a scenario pod
+	LabelSession = "concap-session"
 	// LabelAttackerPod is the label value for attacker pods
 	LabelAttackerPod = "attacker-pod"
 	// LabelTargetPod is the label value for target pods
@@ -60,6 +65,10 @@ const (
 	PodTerminationGracePeriodSeconds int64 = 5
 	// CapabilityNetAdmin is the capability required for network configuration
 	CapabilityNetAdmin = "NET_ADMIN"
+)
+
+// Node selector of scenario pods, set them before building pods
+var (
 	// NodeRoleLabel separates traffic generators and targets across physical hosts.
 	NodeRoleLabel = "concap-role"
 	// NodeRoleAttacker selects nodes intended to generate attack traffic.
@@ -68,6 +77,22 @@ const (
 	NodeRoleTarget = "target"
 )
 
+// Session is the journal session of the controller, set as the LabelSession of scenario pods so that a
+// restarted controller only removes the pods of sessions that are gone. Pods are not labelled when empty.
+var Session string
+
+// scenarioPodLabels returns the labels of an attacker, target or background pod of a scenario
+func scenarioPodLabels(podType, scenarioName string) map[string]string {
+	labels := map[string]string{
+		LabelConcap:   podType,
+		LabelScenario: scenarioName,
+	}
+	if Session != "" {
+		labels[LabelSession] = Session
+	}
+	return labels
+}
+
 // BuildAttackerPod creates a pod definition for an attacker
 func BuildAttackerPod(name string, attacker Attacker, scenarioName string) *apiv1.Pod {
 	resourceRequirements := apiv1.ResourceRequirements{
@@ -93,14 +118,11 @@ func BuildAttackerPod(name string, attacker Attacker, scenarioName string) *apiv
 			Privileged: func(b bool) *bool { return &b }(true),
 		}
 	}
-	return &apiv1.Pod{
+	pod := &apiv1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      CleanPodName(scenarioName + AttackerPodSuffix),
 			Namespace: kubeapi.WorkloadNamespace,
-			Labels: map[string]string{
-				LabelConcap:   LabelAttackerPod,
-				LabelScenario: scenarioName,
-			},
+			Labels:    scenarioPodLabels(LabelAttackerPod, scenarioName),
 		},
 		Spec: apiv1.PodSpec{
 			ImagePullSecrets:              []apiv1.LocalObjectReference{{Name: kubeapi.ImagePullSecretName}},
@@ -150,6 +172,22 @@ func BuildAttackerPod(name string, attacker Attacker, scenarioName string) *apiv
 			},
 		},
 	}
+
+	if attacker.Network.NeedsTCContainer() {
+		pod.Spec.Containers = append(pod.Spec.Containers, tcContainer())
+	}
+
+	// Stages with their own image run in an extra container sharing the attack log volume
+	for i, stage := range attacker.Stages {
+		if stage.Image == "" {
+			continue
+		}
+		container := pod.Spec.Containers[0]
+		container.Name = stageContainerName(attacker, i)
+		container.Image = stage.Image
+		pod.Spec.Containers = append(pod.Spec.Containers, container)
+	}
+	return pod
 }
 
 // BuildTargetPod creates a pod definition for a target from a TargetConfig
@@ -198,11 +236,17 @@ func BuildTargetPod(targetConfig TargetConfig, scenarioName string, index int) *
 		targetContainer.Args = []string{targetConfig.CommandArgs}
 	}
 	if len(targetConfig.Env) > 0 {
+		// Sort the variables so that the pod definition does not depend on map iteration order
+		keys := make([]string, 0, len(targetConfig.Env))
+		for key := range targetConfig.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
 		targetContainer.Env = make([]apiv1.EnvVar, 0, len(targetConfig.Env))
-		for key, value := range targetConfig.Env {
+		for _, key := range keys {
 			targetContainer.Env = append(targetContainer.Env, apiv1.EnvVar{
 				Name:  key,
-				Value: value,
+				Value: targetConfig.Env[key],
 			})
 		}
 	}
@@ -212,14 +256,11 @@ func BuildTargetPod(targetConfig TargetConfig, scenarioName string, index int) *
 		targetContainer.StartupProbe = targetConfig.StartupProbe
 	}
 
-	return &apiv1.Pod{
+	pod := &apiv1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      podName,
 			Namespace: kubeapi.WorkloadNamespace,
-			Labels: map[string]string{
-				LabelConcap:   LabelTargetPod,
-				LabelScenario: scenarioName,
-			},
+			Labels:    scenarioPodLabels(LabelTargetPod, scenarioName),
 		},
 		Spec: apiv1.PodSpec{
 			ImagePullSecrets:              []apiv1.LocalObjectReference{{Name: kubeapi.ImagePullSecretName}},
@@ -277,6 +318,25 @@ func BuildTargetPod(targetConfig TargetConfig, scenarioName string, index int) *
 			},
 		},
 	}
+	if targetConfig.Network.NeedsTCContainer() {
+		pod.Spec.Containers = append(pod.Spec.Containers, tcContainer())
+	}
+	return pod
+}
+
+// tcContainer returns the container that stays running so that the tc filters of rules with a named
+// peer can be added once the IPs of the other pods are known, and the schedule applied during the attack
+func tcContainer() apiv1.Container {
+	return apiv1.Container{
+		Name:    TCContainerName,
+		Image:   ImageIproute2,
+		Command: []string{"sh", "-c", DefaultIdleCommand},
+		SecurityContext: &apiv1.SecurityContext{
+			Capabilities: &apiv1.Capabilities{
+				Add: []apiv1.Capability{CapabilityNetAdmin},
+			},
+		},
+	}
 }
 
 func ProcessingPodSpec(processingPod *ProcessingPod) *apiv1.Pod {
@@ -285,7 +345,7 @@ func ProcessingPodSpec(processingPod *ProcessingPod) *apiv1.Pod {
 			Name:      processingPod.Name,
 			Namespace: kubeapi.WorkloadNamespace,
 			Labels: map[string]string{
-				"concap": "processing-pod",
+				LabelConcap: LabelProcessingPod,
 			},
 		},
 		Spec: apiv1.PodSpec{
@@ -100,6 +100,24 @@ func TestBuildTargetPodIncludesCaptureNormalizationSidecars(t *testing.T) {
 	}
 }
 
+func TestBuildAttackerPodAddsTCContainerForNamedPeers(t *testing.T) {
+	attacker := Attacker{Name: "nmap", Image: "instrumentisto/nmap", CPURequest: "100m", MemRequest: "128Mi"}
+	if pod := BuildAttackerPod(attacker.Name, attacker, "scenario-a"); len(pod.Spec.Containers) != 1 {
+		t.Fatalf("attacker pod without rules has %d containers, want 1", len(pod.Spec.Containers))
+	}
+
+	attacker.Network = Network{Rules: []NetworkRule{{Peer: "10.0.0.0/8"}, {Peer: "web-server-1", Network: Network{Loss: "5%"}}}}
+	pod := BuildAttackerPod(attacker.Name, attacker, "scenario-a")
+	tc := pod.Spec.Containers[len(pod.Spec.Containers)-1]
+	if tc.Name != TCContainerName || tc.Image != ImageIproute2 {
+		t.Fatalf("last container = %s (%s), want %s (%s)", tc.Name, tc.Image, TCContainerName, ImageIproute2)
+	}
+	if tc.SecurityContext == nil || tc.SecurityContext.Capabilities == nil || len(tc.SecurityContext.Capabilities.Add) != 1 ||
+		tc.SecurityContext.Capabilities.Add[0] != CapabilityNetAdmin {
+		t.Fatalf("tc container security context = %#v, want the %s capability", tc.SecurityContext, CapabilityNetAdmin)
+	}
+}
+
 func TestProcessingPodUsesConcapRuntimeContract(t *testing.T) {
 	pod := ProcessingPodSpec(&ProcessingPod{
 		Name:           "processor",
@@ -19,6 +19,10 @@ type ProcessingPod struct {
 	Command        string `yaml:"command"`
 	CPURequest     string `yaml:"cpuRequest"`
 	MemRequest     string `yaml:"memRequest"`
+	// FlowFormat selects one of the FlowFormats column mappings used for flow labeling
+	FlowFormat string `yaml:"flowFormat,omitempty"`
+	// FlowColumns overrides the column mapping for processors without a built-in FlowFormat
+	FlowColumns *FlowColumns `yaml:"flowColumns,omitempty"`
 }
 
 // ReadProcessingPod will unmarshall the yaml into the in-memory ProcessingPod representation
@@ -49,9 +53,30 @@ func ReadProcessingPod(filePath string) (*ProcessingPod, error) {
 		pod.MemRequest = "250Mi"
 	}
 
+	if pod.FlowFormat != "" && pod.FlowColumns != nil {
+		return nil, fmt.Errorf("processing pod %s: flowFormat and flowColumns are mutually exclusive", pod.Name)
+	}
+	if _, ok := FlowFormats[pod.FlowFormat]; pod.FlowFormat != "" && !ok {
+		return nil, fmt.Errorf("processing pod %s: unknown flowFormat %q (supported: %s)", pod.Name, pod.FlowFormat, strings.Join(FlowFormatNames(), ", "))
+	}
+	if pod.FlowColumns != nil {
+		if err := pod.FlowColumns.Validate(); err != nil {
+			return nil, fmt.Errorf("processing pod %s: %w", pod.Name, err)
+		}
+	}
+
 	return &pod, nil
 }
 
+// GetFlowColumns returns the configured flow column mapping, or an empty mapping when the
+// format should be detected from the CSV header.
+func (p *ProcessingPod) GetFlowColumns() FlowColumns {
+	if p.FlowColumns != nil {
+		return *p.FlowColumns
+	}
+	return FlowFormats[p.FlowFormat]
+}
+
 func (p *ProcessingPod) ProcessPcap(ctx context.Context, filePath string, scenarioName string, targetName string, outputDir string) error {
 	inputFileContainer := filepath.Join("/data/input", scenarioName+"-"+targetName+".pcap")
 	outputFileContainer := filepath.Join("/data/output", scenarioName+"-"+targetName+".csv")
@@ -0,0 +1,108 @@
+package scenarios
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// renderedPod is a pod definition with the commands concap runs in it after deployment
+type renderedPod struct {
+	pod *apiv1.Pod
+	// comments hold the commands executed in the pod once it is running
+	comments []string
+}
+
+func attackerRenderedPod(pod *apiv1.Pod, attacker Attacker) renderedPod {
+	if len(attacker.Stages) == 0 {
+		return renderedPod{pod: pod, comments: []string{"attack: " + attacker.AtkCommand}}
+	}
+	rendered := renderedPod{pod: pod}
+	for i, stage := range attacker.Stages {
+		rendered.comments = append(rendered.comments,
+			fmt.Sprintf("stage %s (%s): %s", stage.Name, stageContainerName(attacker, i), stage.AtkCommand))
+	}
+	return rendered
+}
+
+func targetRenderedPod(pod *apiv1.Pod, target TargetConfig) renderedPod {
+	return renderedPod{pod: pod, comments: []string{"tcpdump: " + tcpdumpCommand(target.Filter)}}
+}
+
+// RenderScenario writes the pod manifests of a scenario as a multi-document YAML stream without
+// deploying anything. Target pods are preceded by a comment holding the tcpdump command that is
+// started in them, with the IP placeholders of the filter left in place, and attacker pods by
+// their attack commands.
+func RenderScenario(w io.Writer, scenario ScenarioInterface) error {
+	var pods []renderedPod
+	switch s := scenario.(type) {
+	case *SingleTargetScenario:
+		pods = append(pods, attackerRenderedPod(s.AttackPod(), s.Attacker), targetRenderedPod(s.TargetPod(), s.Target))
+		pods = append(pods, backgroundRenderedPods(s.Name, s.Background)...)
+	case *MultiTargetScenario:
+		pods = append(pods, attackerRenderedPod(s.AttackPod(), s.Attacker))
+		for i, target := range s.Targets {
+			pods = append(pods, targetRenderedPod(s.TargetPod(i), target))
+		}
+		pods = append(pods, backgroundRenderedPods(s.Name, s.Background)...)
+	case *MultiAttackerScenario:
+		for i, attacker := range s.Attackers {
+			pods = append(pods, attackerRenderedPod(s.AttackPod(i), attacker))
+		}
+		for i, target := range s.Targets {
+			pods = append(pods, targetRenderedPod(s.TargetPod(i), target))
+		}
+		pods = append(pods, backgroundRenderedPods(s.Name, s.Background)...)
+	default:
+		return fmt.Errorf("rendering scenario type %T is not supported", scenario)
+	}
+
+	for _, rendered := range pods {
+		if err := writeManifest(w, rendered.pod, rendered.comments...); err != nil {
+			return fmt.Errorf("render scenario %s: %w", scenario.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// RenderProcessingPod writes the pod manifest of a processing pod as a YAML document
+func RenderProcessingPod(w io.Writer, processingPod *ProcessingPod) error {
+	if err := writeManifest(w, ProcessingPodSpec(processingPod), "command: "+processingPod.Command); err != nil {
+		return fmt.Errorf("render processing pod %s: %w", processingPod.Name, err)
+	}
+	return nil
+}
+
+func backgroundRenderedPods(scenarioName string, clients []BackgroundClient) []renderedPod {
+	pods := make([]renderedPod, 0, len(clients))
+	for i, client := range clients {
+		pods = append(pods, renderedPod{pod: BuildBackgroundPod(client, scenarioName, i), comments: []string{"background: " + client.Command}})
+	}
+	return pods
+}
+
+// writeManifest writes a pod as a YAML document preceded by the given comment lines
+func writeManifest(w io.Writer, pod *apiv1.Pod, comments ...string) error {
+	// Pods are created through the typed client which does not need the type information,
+	// add it so that the manifests can be used with kubectl
+	pod.TypeMeta.Kind = "Pod"
+	pod.TypeMeta.APIVersion = "v1"
+	b, err := yaml.Marshal(pod)
+	if err != nil {
+		return fmt.Errorf("marshal pod %s: %w", pod.Name, err)
+	}
+
+	var doc strings.Builder
+	doc.WriteString("---\n")
+	for _, comment := range comments {
+		for _, line := range strings.Split(strings.TrimSpace(comment), "\n") {
+			doc.WriteString("# " + line + "\n")
+		}
+	}
+	doc.Write(b)
+	_, err = io.WriteString(w, doc.String())
+	return err
+}
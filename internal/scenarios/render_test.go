@@ -0,0 +1,88 @@
+package scenarios
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// assertGolden compares got with the golden file, or rewrites the golden file when -update is set
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "render", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("update golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("rendered %s differs from the golden file, run go test -update to accept\ngot:\n%s", name, got)
+	}
+}
+
+func TestRenderScenarioMatchesGoldenFiles(t *testing.T) {
+	for _, name := range []string{
+		"scenario.yaml",
+		"nmap-multi-target-scan.yaml",
+		"hping-multi-attacker-flood.yaml",
+		"multi-stage-web-attack.yaml",
+		"nmap-with-background.yaml",
+	} {
+		t.Run(name, func(t *testing.T) {
+			scenario, err := CreateScenario(filepath.Join("..", "..", "example", "scenarios", name))
+			if err != nil {
+				t.Fatalf("CreateScenario() error = %v", err)
+			}
+
+			var out bytes.Buffer
+			if err := RenderScenario(&out, scenario); err != nil {
+				t.Fatalf("RenderScenario() error = %v", err)
+			}
+			assertGolden(t, name, out.Bytes())
+		})
+	}
+}
+
+func TestRenderProcessingPodMatchesGoldenFile(t *testing.T) {
+	processingPod, err := ReadProcessingPod(filepath.Join("..", "..", "example", "processingpods", "rustiflow.yaml"))
+	if err != nil {
+		t.Fatalf("ReadProcessingPod() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := RenderProcessingPod(&out, processingPod); err != nil {
+		t.Fatalf("RenderProcessingPod() error = %v", err)
+	}
+	assertGolden(t, "processingpod-rustiflow.yaml", out.Bytes())
+}
+
+func TestRenderScenarioKeepsFilterPlaceholders(t *testing.T) {
+	scenario, err := CreateScenario(filepath.Join("..", "..", "example", "scenarios", "scenario.yaml"))
+	if err != nil {
+		t.Fatalf("CreateScenario() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := RenderScenario(&out, scenario); err != nil {
+		t.Fatalf("RenderScenario() error = %v", err)
+	}
+	rendered := out.String()
+	if strings.Count(rendered, "---\n") != 2 {
+		t.Fatalf("rendered %d documents, want 2:\n%s", strings.Count(rendered, "---\n"), rendered)
+	}
+	for _, want := range []string{"# tcpdump: nohup tcpdump", "$ATTACKER_IP", "$TARGET_IP", "tbf rate 100mbit", "kind: Pod"} {
+		if !strings.Contains(rendered, want) {
+			t.Fatalf("rendered manifests missing %q:\n%s", want, rendered)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package scenarios
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RepeatScenarioSources expands every source into the runs requested by its repeat field, or by
+// override when it is positive. Runs are named <name>-run-<i> and write their output to
+// <name>/run-<i>, starting at 1. Sources that run once are returned unchanged.
+func RepeatScenarioSources(sources []ScenarioSource, override int) ([]ScenarioSource, error) {
+	if override < 0 {
+		return nil, fmt.Errorf("invalid repeat %d, must be positive", override)
+	}
+
+	var repeated []ScenarioSource
+	for _, source := range sources {
+		var config struct {
+			Repeat int `yaml:"repeat"`
+		}
+		if err := yaml.Unmarshal(source.YAML, &config); err != nil {
+			return nil, fmt.Errorf("error unmarshaling YAML to determine repeat of %s: %w", source.Name, err)
+		}
+		if config.Repeat < 0 {
+			return nil, fmt.Errorf("invalid repeat %d in %s, must be positive", config.Repeat, source.Path)
+		}
+
+		runs := config.Repeat
+		if override > 0 {
+			runs = override
+		}
+		if runs <= 1 {
+			repeated = append(repeated, source)
+			continue
+		}
+
+		for run := 1; run <= runs; run++ {
+			runSource := source
+			runSource.Name = fmt.Sprintf("%s-run-%d", source.Name, run)
+			runSource.Dir = filepath.Join(source.OutputDir(), fmt.Sprintf("run-%d", run))
+			runSource.Run = run
+			runSource.Repeat = runs
+			repeated = append(repeated, runSource)
+		}
+	}
+	return repeated, nil
+}
+
+// parseSeed parses a netem seed, an unsigned 64-bit integer like the seed of the netem qdisc
+func parseSeed(seed string) (uint64, error) {
+	return strconv.ParseUint(seed, 10, 64)
+}
+
+// deriveRunSeeds offsets the netem seed of every network, including its ingress, rules and schedule, by the
+// run number, so that loss and corruption patterns differ between runs. The first run keeps the configured
+// seed, an unset seed counts as 0. Derived seeds wrap around at the 64-bit limit of the seed.
+func deriveRunSeeds(networks []*Network, run int) error {
+	for _, network := range networks {
+		if err := deriveRunSeed(network, run, false, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deriveRunSeed offsets the seed of a network and the networks nested in it by the run number. With inherited,
+// an unset seed is left unset, because the network is merged over one whose seed is derived already, as rules
+// and schedule changes are. ingressInherited is the same for the ingress of the network.
+func deriveRunSeed(network *Network, run int, inherited, ingressInherited bool) error {
+	if network.Seed != "" || !inherited {
+		var seed uint64
+		if network.Seed != "" {
+			var err error
+			seed, err = parseSeed(network.Seed)
+			if err != nil {
+				return fmt.Errorf("invalid seed %q: %w", network.Seed, err)
+			}
+		}
+		network.Seed = strconv.FormatUint(seed+uint64(run-1), 10)
+	}
+	if network.Ingress != nil {
+		if err := deriveRunSeed(network.Ingress, run, ingressInherited, ingressInherited); err != nil {
+			return err
+		}
+	}
+	for i := range network.Rules {
+		if err := deriveRunSeed(&network.Rules[i].Network, run, true, true); err != nil {
+			return err
+		}
+	}
+	// The ingress of a change is merged over the ingress of the network, if it has one
+	for i := range network.Schedule {
+		if err := deriveRunSeed(&network.Schedule[i].Network, run, true, network.Ingress != nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
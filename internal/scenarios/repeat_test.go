@@ -0,0 +1,171 @@
+package scenarios
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepeatScenarioSourcesDerivesRunsAndSeeds(t *testing.T) {
+	path := writeScenarioFile(t, "scan.yaml", `repeat: 3
+attacker:
+  name: nmap
+  image: instrumentisto/nmap:latest
+  atkCommand: nmap $TARGET_IP
+target:
+  name: httpd
+  image: httpd:2.4.38
+  network:
+    seed: 100
+network:
+  loss: 1%
+`)
+	sources, err := LoadScenarioSources(path)
+	if err != nil {
+		t.Fatalf("LoadScenarioSources returned error: %v", err)
+	}
+	runs, err := RepeatScenarioSources(sources, 0)
+	if err != nil {
+		t.Fatalf("RepeatScenarioSources returned error: %v", err)
+	}
+	if len(runs) != 3 {
+		t.Fatalf("RepeatScenarioSources returned %d runs, want 3", len(runs))
+	}
+
+	seen := map[string]bool{}
+	for i, run := range runs {
+		scenario, err := CreateScenarioFromSource(run)
+		if err != nil {
+			t.Fatalf("CreateScenarioFromSource(run %d) returned error: %v", i+1, err)
+		}
+		s := scenario.(*SingleTargetScenario)
+		if got, want := run.OutputDir(), filepath.Join("scan", []string{"run-1", "run-2", "run-3"}[i]); got != want {
+			t.Fatalf("runs[%d].OutputDir() = %q, want %q", i, got, want)
+		}
+		if got, want := s.Name, []string{"scan-run-1", "scan-run-2", "scan-run-3"}[i]; got != want {
+			t.Fatalf("runs[%d] Name = %q, want %q", i, got, want)
+		}
+		if s.Run != i+1 || s.Repeat != 3 {
+			t.Fatalf("runs[%d] Run/Repeat = %d/%d, want %d/3", i, s.Run, s.Repeat, i+1)
+		}
+		if got, want := s.Attacker.Network.Seed, []string{"0", "1", "2"}[i]; got != want {
+			t.Fatalf("runs[%d] Attacker.Network.Seed = %q, want %q", i, got, want)
+		}
+		if got, want := s.Target.Network.Seed, []string{"100", "101", "102"}[i]; got != want {
+			t.Fatalf("runs[%d] Target.Network.Seed = %q, want %q", i, got, want)
+		}
+		if seen[s.UUID.String()] {
+			t.Fatalf("runs[%d] reuses UUID %s", i, s.UUID)
+		}
+		seen[s.UUID.String()] = true
+	}
+}
+
+func TestRepeatScenarioSourcesDerivesNestedSeeds(t *testing.T) {
+	path := writeScenarioFile(t, "scan.yaml", `repeat: 2
+attacker:
+  name: nmap
+  image: instrumentisto/nmap:latest
+  atkCommand: nmap $TARGET_IP
+target:
+  name: httpd
+  image: httpd:2.4.38
+  network:
+    seed: 100
+    loss: 1%
+    ingress:
+      loss: 2%
+    rules:
+      - peer: attacker
+        seed: 7
+      - peer: 10.0.0.0/8
+        delay: 10ms
+    schedule:
+      - at: 10s
+        seed: 50
+      - at: 20s
+        ingress:
+          loss: 5%
+`)
+	sources, err := LoadScenarioSources(path)
+	if err != nil {
+		t.Fatalf("LoadScenarioSources returned error: %v", err)
+	}
+	runs, err := RepeatScenarioSources(sources, 0)
+	if err != nil {
+		t.Fatalf("RepeatScenarioSources returned error: %v", err)
+	}
+	scenario, err := CreateScenarioFromSource(runs[1])
+	if err != nil {
+		t.Fatalf("CreateScenarioFromSource returned error: %v", err)
+	}
+	network := scenario.(*SingleTargetScenario).Target.Network
+
+	for name, tt := range map[string]struct{ got, want string }{
+		"seed":                     {network.Seed, "101"},
+		"ingress.seed":             {network.Ingress.Seed, "1"},
+		"rules[0].seed":            {network.Rules[0].Seed, "8"},
+		"rules[1].seed":            {network.Rules[1].Seed, ""},
+		"schedule[0].seed":         {network.Schedule[0].Seed, "51"},
+		"schedule[1].ingress.seed": {network.Schedule[1].Ingress.Seed, ""},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("run 2 %s = %q, want %q", name, tt.got, tt.want)
+		}
+	}
+	// Unset seeds of rules and changes inherit the derived seed of the network they are merged over
+	command := network.GetTCCommand()
+	for _, want := range []string{"netem delay 10ms loss random 1% seed 101", "netem loss random 1% seed 8", "netem loss random 2% seed 1"} {
+		if !strings.Contains(command, want) {
+			t.Errorf("GetTCCommand() = %q, missing %q", command, want)
+		}
+	}
+	for i, want := range []string{"seed 51", "loss random 5% seed 1"} {
+		commands, err := network.ScheduleCommands(i)
+		if err != nil {
+			t.Fatalf("ScheduleCommands(%d) returned error: %v", i, err)
+		}
+		if !strings.Contains(strings.Join(commands, "\n"), want) {
+			t.Errorf("ScheduleCommands(%d) = %q, missing %q", i, commands, want)
+		}
+	}
+}
+
+func TestRepeatScenarioSourcesOverride(t *testing.T) {
+	sources := []ScenarioSource{{Name: "scan", YAML: []byte("repeat: 3\n")}}
+
+	runs, err := RepeatScenarioSources(sources, 2)
+	if err != nil {
+		t.Fatalf("RepeatScenarioSources returned error: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("RepeatScenarioSources returned %d runs, want 2", len(runs))
+	}
+
+	runs, err = RepeatScenarioSources(sources, 1)
+	if err != nil {
+		t.Fatalf("RepeatScenarioSources returned error: %v", err)
+	}
+	if len(runs) != 1 || runs[0].OutputDir() != "scan" {
+		t.Fatalf("RepeatScenarioSources(1) = %#v, want the source unchanged", runs)
+	}
+}
+
+func TestDeriveRunSeedsWrapsAtSeedLimit(t *testing.T) {
+	// Seeds that pass validation must also derive, including those beyond 32 bits
+	networks := []*Network{{Seed: "18446744073709551615"}, {Seed: "4294967296"}}
+	for _, network := range networks {
+		if err := network.Validate(); err != nil {
+			t.Fatalf("Validate(seed %s) = %v", network.Seed, err)
+		}
+	}
+	if err := deriveRunSeeds(networks, 3); err != nil {
+		t.Fatalf("deriveRunSeeds returned error: %v", err)
+	}
+	if got := []string{networks[0].Seed, networks[1].Seed}; got[0] != "1" || got[1] != "4294967298" {
+		t.Fatalf("derived seeds = %v, want [1 4294967298]", got)
+	}
+	if err := (Network{Seed: "18446744073709551616"}).Validate(); err == nil {
+		t.Fatal("Validate accepted a seed beyond 64 bits")
+	}
+}
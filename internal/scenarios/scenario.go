@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
 	kubeexec "k8s.io/client-go/util/exec"
 )
 
@@ -25,6 +27,8 @@ type ScenarioInterface interface {
 	DownloadResults(ctx context.Context, outputDir string) error
 	// ProcessResults processes the results of the attack
 	ProcessResults(ctx context.Context, outputDir string, processingPods []*ProcessingPod) error
+	// LabelResults writes a labeled copy of every processor output
+	LabelResults(outputDir string, processingPods []*ProcessingPod) error
 	// DeleteAllPods deletes all pods for the scenario
 	DeleteAllPods(ctx context.Context) error
 	// Execute executes the entire scenario workflow
@@ -37,6 +41,10 @@ type partialResultsDownloader interface {
 	DownloadPartialResults(ctx context.Context, outputDir string) error
 }
 
+type diagnosticsCollector interface {
+	CollectDiagnostics(ctx context.Context, dir string)
+}
+
 // BaseScenario contains common fields and methods for all scenario types
 type BaseScenario struct {
 	UUID      uuid.UUID `yaml:"uuid"`
@@ -45,6 +53,11 @@ type BaseScenario struct {
 	StartTime time.Time `yaml:"startTime"`
 	StopTime  time.Time `yaml:"stopTime"`
 	Type      string    `yaml:"type"`
+	// Matrix records the parameter values of an expanded scenario matrix
+	Matrix map[string]string `yaml:"matrix,omitempty"`
+	// Repeat is the number of times the scenario is captured, Run the number of this capture
+	Repeat int `yaml:"repeat,omitempty"`
+	Run    int `yaml:"run,omitempty"`
 }
 
 // GetName returns the scenario name
@@ -52,41 +65,77 @@ func (s *BaseScenario) GetName() string {
 	return s.Name
 }
 
+func (s *BaseScenario) setMatrix(matrix map[string]string) {
+	s.Matrix = matrix
+}
+
+func (s *BaseScenario) setRun(run, repeat int) {
+	s.Run = run
+	s.Repeat = repeat
+}
+
 // ExecuteScenario executes the scenario from start to finish.
 // 1. Deploys the pods
 // 2. Start traffic capture on the target pod(s)
-// 3. Executes the attack
+// 3. Executes the attack, applying the network schedules of the pods meanwhile
 // 4. Downloads the pcap capture and updated scenario file
-// 5. Cleans up the pods
+// 5. Saves the state, events and logs of the pods to the k8s directory and cleans up the pods
 func ExecuteScenario(ctx context.Context, s ScenarioInterface, outputDir string) error {
-	// 1. Deploy the pods for this scenario
-	err := s.DeployAllPods(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to deploy pods for scenario: %w", err)
-	}
+	diagnosticsDir := filepath.Join(outputDir, kubeapi.DiagnosticsDirName)
+	ctx = kubeapi.WithDiagnosticsDir(ctx, diagnosticsDir)
 
-	// Defer pod deletion with error handling
+	// Defer pod deletion with error handling, this also removes the pods that were deployed
+	// when deploying the others failed so that the scenario can be run again
 	defer func() {
-		cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		// Keep the values of the context, such as the pod observer, but not its cancellation
+		if collector, ok := s.(diagnosticsCollector); ok {
+			// Diagnostics get their own deadline, so that slow log streams cannot use up the time to delete the pods
+			diagnosticsCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), kubeapi.DiagnosticsTimeout)
+			collector.CollectDiagnostics(diagnosticsCtx, diagnosticsDir)
+			cancel()
+		}
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
 		defer cancel()
 		if deleteErr := s.DeleteAllPods(cleanupCtx); deleteErr != nil {
 			log.Printf("Error: failed to clean up pods for scenario: %v", deleteErr)
 		}
 	}()
 
+	// 1. Deploy the pods for this scenario
+	start := time.Now()
+	err := s.DeployAllPods(ctx)
+	ObservePhase(ctx, PhaseDeploy, start)
+	if err != nil {
+		return fmt.Errorf("failed to deploy pods for scenario: %w", err)
+	}
+
 	// 2. Start traffic capture on the target pod(s)
+	start = time.Now()
 	err = s.StartTrafficCapture(ctx)
+	ObservePhase(ctx, PhaseCapture, start)
 	if err != nil {
 		return fmt.Errorf("failed to start traffic capture for scenario: %w", err)
 	}
 
-	// 3. Execute the attack
+	// 3. Execute the attack while the network schedules of the pods are applied
+	start = time.Now()
+	stopSchedules, err := startNetworkSchedules(ctx, s, outputDir, start)
+	if err != nil {
+		return fmt.Errorf("failed to start network schedules for scenario: %w", err)
+	}
 	err = s.ExecuteAttack(ctx)
+	if scheduleErr := stopSchedules(); err == nil && scheduleErr != nil {
+		err = fmt.Errorf("network schedule: %w", scheduleErr)
+	}
+	ObservePhase(ctx, PhaseAttack, start)
 	if err != nil {
 		attackErr := fmt.Errorf("failed to execute attack for scenario: %w", err)
 		if isAttackTimeout(err) {
 			if partialDownloader, ok := s.(partialResultsDownloader); ok {
-				if partialErr := partialDownloader.DownloadPartialResults(ctx, outputDir); partialErr != nil {
+				start = time.Now()
+				partialErr := partialDownloader.DownloadPartialResults(ctx, outputDir)
+				ObservePhase(ctx, PhaseDownload, start)
+				if partialErr != nil {
 					return errors.Join(attackErr, fmt.Errorf("failed to preserve partial results for scenario: %w", partialErr))
 				}
 			}
@@ -95,7 +144,9 @@ func ExecuteScenario(ctx context.Context, s ScenarioInterface, outputDir string)
 	}
 
 	// 4. Download the pcap capture and updated scenario file
+	start = time.Now()
 	err = s.DownloadResults(ctx, outputDir)
+	ObservePhase(ctx, PhaseDownload, start)
 	if err != nil {
 		return fmt.Errorf("failed to download results for scenario: %w", err)
 	}
@@ -107,3 +158,28 @@ func isAttackTimeout(err error) bool {
 	var exitErr kubeexec.ExitError
 	return errors.As(err, &exitErr) && exitErr.ExitStatus() == 124
 }
+
+// TargetOutput is the directory the capture and processor outputs of a target are written to
+type TargetOutput struct {
+	Name string
+	Dir  string
+}
+
+// TargetOutputs returns the output directory of every target of a scenario executed in outputDir.
+// A single target writes to outputDir itself, multiple targets each write to a directory named after the target.
+func TargetOutputs(s ScenarioInterface, outputDir string) []TargetOutput {
+	var outputs []TargetOutput
+	switch scenario := s.(type) {
+	case *SingleTargetScenario:
+		outputs = append(outputs, TargetOutput{Name: scenario.Target.Name, Dir: outputDir})
+	case *MultiTargetScenario:
+		for _, target := range scenario.Targets {
+			outputs = append(outputs, TargetOutput{Name: target.Name, Dir: filepath.Join(outputDir, target.Name)})
+		}
+	case *MultiAttackerScenario:
+		for _, target := range scenario.Targets {
+			outputs = append(outputs, TargetOutput{Name: target.Name, Dir: filepath.Join(outputDir, target.Name)})
+		}
+	}
+	return outputs
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
 	kubeexec "k8s.io/client-go/util/exec"
 )
 
@@ -26,6 +28,38 @@ func TestExecuteScenarioUsesCleanupContextForDeletion(t *testing.T) {
 	}
 }
 
+func TestExecuteScenarioDeletesPodsAfterSlowDiagnostics(t *testing.T) {
+	originalTimeout := kubeapi.DiagnosticsTimeout
+	kubeapi.DiagnosticsTimeout = 10 * time.Millisecond
+	defer func() { kubeapi.DiagnosticsTimeout = originalTimeout }()
+
+	for _, attackErr := range []error{nil, errors.New("attack failed")} {
+		scenario := &diagnosedScenario{fakeScenario: fakeScenario{executeAttackErr: attackErr}}
+		err := ExecuteScenario(context.Background(), scenario, t.TempDir())
+		if !errors.Is(err, attackErr) {
+			t.Fatalf("ExecuteScenario error = %v, want %v", err, attackErr)
+		}
+		if !scenario.deleteCalled || scenario.deleteCtxErr != nil {
+			t.Fatalf("DeleteAllPods called = %v with context error %v, want a fresh context after diagnostics timed out",
+				scenario.deleteCalled, scenario.deleteCtxErr)
+		}
+		if !scenario.collected {
+			t.Fatalf("CollectDiagnostics was not called for attack error %v", attackErr)
+		}
+	}
+}
+
+// diagnosedScenario collects diagnostics until its context is done, like a slow log stream
+type diagnosedScenario struct {
+	fakeScenario
+	collected bool
+}
+
+func (s *diagnosedScenario) CollectDiagnostics(ctx context.Context, dir string) {
+	s.collected = true
+	<-ctx.Done()
+}
+
 func TestExecuteScenarioPreservesPartialResultsOnTimeout(t *testing.T) {
 	sentinel := kubeexec.CodeExitError{Err: errors.New("timeout"), Code: 124}
 	scenario := &fakeScenario{
@@ -92,6 +126,10 @@ func (s *fakeScenario) ProcessResults(context.Context, string, []*ProcessingPod)
 	return nil
 }
 
+func (s *fakeScenario) LabelResults(string, []*ProcessingPod) error {
+	return nil
+}
+
 func (s *fakeScenario) DeleteAllPods(ctx context.Context) error {
 	s.deleteCalled = true
 	s.deleteCtxErr = ctx.Err()
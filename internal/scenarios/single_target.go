@@ -5,9 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -24,37 +22,41 @@ type SingleTargetScenario struct {
 	BaseScenario `yaml:",inline"`
 	Attacker     Attacker               `yaml:"attacker"`
 	Target       TargetConfig           `yaml:"target"`
+	Background   []BackgroundClient     `yaml:"background,omitempty"`
 	Network      Network                `yaml:"network,omitempty"`
 	Labels       map[string]string      `yaml:"labels,omitempty"`
 	Deployment   SingleTargetDeployment `yaml:"deployment"`
 }
 
 type SingleTargetDeployment struct {
-	AttackPodSpec kubeapi.RunningPodSpec
-	TargetPodSpec kubeapi.RunningPodSpec
+	AttackPodSpec      kubeapi.RunningPodSpec
+	TargetPodSpec      kubeapi.RunningPodSpec
+	BackgroundPodSpecs []kubeapi.RunningPodSpec
 }
 
 func (s SingleTargetDeployment) MarshalYAML() (interface{}, error) {
-	return map[string]string{
+	result := map[string]interface{}{
 		"attacker": s.AttackPodSpec.PodIP,
 		"target":   s.TargetPodSpec.PodIP,
-	}, nil
+	}
+	if len(s.BackgroundPodSpecs) > 0 {
+		result["background"] = backgroundPodIPs(s.BackgroundPodSpecs)
+	}
+	return result, nil
 }
 
 // FromYAML parses a YAML file into a SingleTargetScenario
 func (s *SingleTargetScenario) FromYAML(filePath string) error {
-	fileHandler, err := os.Open(filePath)
+	b, err := readScenarioFile(filePath)
 	if err != nil {
-		return fmt.Errorf("open scenario file %s: %w", filePath, err)
-	}
-	defer fileHandler.Close()
-
-	b, err := io.ReadAll(fileHandler)
-	if err != nil {
-		return fmt.Errorf("error reading YAML: %w", err)
+		return err
 	}
+	return s.parseYAML(b, scenarioNameFromPath(filePath))
+}
 
-	err = yaml.UnmarshalStrict(b, s)
+// parseYAML parses a scenario definition into a SingleTargetScenario with the given name
+func (s *SingleTargetScenario) parseYAML(b []byte, name string) error {
+	err := yaml.UnmarshalStrict(b, s)
 	if err != nil {
 		return fmt.Errorf("error unmarshaling YAML: %w", err)
 	}
@@ -63,25 +65,23 @@ func (s *SingleTargetScenario) FromYAML(filePath string) error {
 		return fmt.Errorf("no attack-image provided for attack: '%s'", s.Attacker.Name)
 	}
 
-	// Process attack time
-	atkTime, err := ParseToSeconds(s.Attacker.AtkTime)
-	if err != nil {
-		s.Attacker.AtkTime = EmptyAttackDuration
-	} else {
-		s.Attacker.AtkTime = atkTime
+	// Process attack time and wrap the attack command(s) in a timeout and the attack log
+	if err := prepareAttackCommands(&s.Attacker); err != nil {
+		return err
 	}
 
-	// Modify the attack command to include a timeout if a duration is provided
-	if s.Attacker.AtkTime != EmptyAttackDuration {
-		s.Attacker.AtkCommand = "timeout " + s.Attacker.AtkTime + " " + s.Attacker.AtkCommand
-	}
-	s.Attacker.AtkCommand = withAttackLogging(s.Attacker.AtkCommand)
-
 	s.UUID = uuid.New()
-	s.Name = CleanPodName(strings.TrimSuffix(filepath.Base(fileHandler.Name()), filepath.Ext(fileHandler.Name())))
+	s.Name = CleanPodName(name)
+
+	if err := prepareBackgroundClients(s.Background, s.Network); err != nil {
+		return err
+	}
 
 	if s.Target.Filter == "" {
 		s.Target.Filter = DefaultTcpdumpFilter
+		if len(s.Background) > 0 {
+			s.Target.Filter = DefaultBackgroundTcpdumpFilter
+		}
 	}
 
 	// Default resource requests to help K8s with scheduling
@@ -98,22 +98,10 @@ func (s *SingleTargetScenario) FromYAML(filePath string) error {
 		s.Target.MemRequest = "250Mi"
 	}
 
-	// Initialize an empty Network struct for attacker if not provided
-	// This ensures MergeNetworks will work correctly
-	if s.Attacker.Network == (Network{}) {
-		s.Attacker.Network = Network{}
-	}
-
 	// Merge the global network configuration with the attacker-specific one
 	// Attacker-specific configuration takes precedence over global configuration
 	s.Attacker.Network = MergeNetworks(s.Network, s.Attacker.Network)
 
-	// Initialize an empty Network struct for target if not provided
-	// This ensures MergeNetworks will work correctly
-	if s.Target.Network == (Network{}) {
-		s.Target.Network = Network{}
-	}
-
 	// Merge the global network configuration with the target-specific one
 	// Target-specific configuration takes precedence over global configuration
 	s.Target.Network = MergeNetworks(s.Network, s.Target.Network)
@@ -142,7 +130,20 @@ func (s *SingleTargetScenario) FromYAML(filePath string) error {
 		s.Target.StartupProbe = &startupProbe
 	}
 
-	return nil
+	networks := map[string]Network{"attacker": s.Attacker.Network, "target": s.Target.Network}
+	for _, client := range s.Background {
+		networks["background client '"+client.Name+"'"] = client.Network
+	}
+	return validateNetworks(networks)
+}
+
+// networks returns the merged network configuration of every pod in the scenario
+func (s *SingleTargetScenario) networks() []*Network {
+	networks := []*Network{&s.Attacker.Network, &s.Target.Network}
+	for i := range s.Background {
+		networks = append(networks, &s.Background[i].Network)
+	}
+	return networks
 }
 
 // AttackPod returns the pod definition for the attacker
@@ -171,10 +172,10 @@ func (s *SingleTargetScenario) DeployAllPods(ctx context.Context) error {
 	log.Println("Deploying pods for scenario: ", s.Name)
 	s.InitTime = time.Now()
 	var wg sync.WaitGroup
-	wg.Add(2) // 1 for attacker + 1 for target
+	wg.Add(3) // 1 for attacker + 1 for target + 1 for the background clients
 
 	// Channel to capture errors
-	errChan := make(chan error, 2)
+	errChan := make(chan error, 3)
 
 	// 1. Deploy the attacker pod
 	go func() {
@@ -200,6 +201,16 @@ func (s *SingleTargetScenario) DeployAllPods(ctx context.Context) error {
 		s.Deployment.TargetPodSpec = podspec
 	}()
 
+	// 3. Deploy the background client pods
+	go func() {
+		defer wg.Done()
+		podspecs, err := deployBackgroundPods(ctx, s.Name, s.Background)
+		s.Deployment.BackgroundPodSpecs = podspecs
+		if err != nil {
+			errChan <- err
+		}
+	}()
+
 	// 3. Wait for all pods to be ready
 	log.Println("Waiting for pods to be ready for scenario: ", s.Name)
 	wg.Wait()
@@ -213,14 +224,28 @@ func (s *SingleTargetScenario) DeployAllPods(ctx context.Context) error {
 		}
 	}
 
+	// 5. Add the tc filters of network rules now that the IPs of all pods are known
+	peers := networkPeers([]kubeapi.RunningPodSpec{s.Deployment.AttackPodSpec}, []kubeapi.RunningPodSpec{s.Deployment.TargetPodSpec}, s.Deployment.BackgroundPodSpecs)
+	if err := applyNetworkRules(ctx, s.shapedPods(), peers); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// shapedPods returns the deployed pods with their network configuration
+func (s *SingleTargetScenario) shapedPods() []shapedPod {
+	return append([]shapedPod{
+		{podSpec: s.Deployment.AttackPodSpec, network: &s.Attacker.Network, tcCommands: &s.Attacker.TCCommands},
+		{podSpec: s.Deployment.TargetPodSpec, network: &s.Target.Network, tcCommands: &s.Target.TCCommands},
+	}, backgroundShapedPods(s.Background, s.Deployment.BackgroundPodSpecs)...)
+}
+
 // StartTrafficCapture starts traffic capture on the target pod
 func (s *SingleTargetScenario) StartTrafficCapture(ctx context.Context) error {
 	log.Printf("Starting traffic capture on target pod %v for scenario %v", s.Deployment.TargetPodSpec.PodName, s.Name)
 	if err := startTcpdumpCapture(ctx, s.Deployment.TargetPodSpec.PodName, s.GetTrafficFilter()); err != nil {
-		return fmt.Errorf("error starting tcpdump in scenario %v, error: %v", s.Name, err)
+		return fmt.Errorf("error starting tcpdump in scenario %v, error: %w", s.Name, err)
 	}
 	return nil
 }
@@ -228,16 +253,14 @@ func (s *SingleTargetScenario) StartTrafficCapture(ctx context.Context) error {
 // ExecuteAttack executes the attack
 func (s *SingleTargetScenario) ExecuteAttack(ctx context.Context) error {
 	envVar := s.GetShellEnvVars()
-	log.Printf("Executing attack '%v' in scenario %v", s.Attacker.AtkCommand, s.Name)
-	s.StartTime = time.Now()
-	stdo, stde, err := kubeapi.ExecShellInContainerWithEnvVars(ctx, kubeapi.WorkloadNamespace, s.Deployment.AttackPodSpec.PodName, s.Deployment.AttackPodSpec.ContainerName, s.Attacker.AtkCommand, envVar)
-	s.StopTime = time.Now()
+	err := runWithBackgroundTraffic(ctx, s.Background, s.Deployment.BackgroundPodSpecs, []kubeapi.RunningPodSpec{s.Deployment.TargetPodSpec}, func() error {
+		s.StartTime = time.Now()
+		defer func() { s.StopTime = time.Now() }()
+		return runAttack(ctx, s.Name, &s.Attacker, s.Deployment.AttackPodSpec, envVar)
+	})
 	if err != nil {
 		return fmt.Errorf("error executing command in scenario %v: %w", s.Name, err)
 	}
-	if stde != "" {
-		log.Printf("%s : %s : stdout: %s\n\t stderr: %s", s.Name, s.Attacker.Name, stdo, stde)
-	}
 	log.Printf("Attack finished in scenario %v", s.Name)
 	return nil
 }
@@ -261,26 +284,26 @@ func (s *SingleTargetScenario) downloadResults(ctx context.Context, outputDir, p
 	targetPodName := s.Deployment.TargetPodSpec.PodName
 
 	if err := stopAndNormalizeCapture(ctx, targetPodName); err != nil {
-		return fmt.Errorf("failed to stop tcpdump in target pod: %v", err)
+		return fmt.Errorf("failed to stop tcpdump in target pod: %w", err)
 	}
 
 	// Download the pcap file and tcpdump log file from the target pod
 	log.Printf("Stopped traffic capture on target pod %v for scenario %v", targetPodName, s.Name)
 	err := kubeapi.CopyFileFromPod(ctx, targetPodName, TcpdumpContainerName, RawPcapPath, rawPcapPath, true)
 	if err != nil {
-		return fmt.Errorf("failed to download raw pcap file from target pod: %v", err)
+		return fmt.Errorf("failed to download raw pcap file from target pod: %w", err)
 	}
 	err = kubeapi.CopyFileFromPod(ctx, targetPodName, ReordercapContainerName, NormalizedPcapPath, pcapPath, true)
 	if err != nil {
-		return fmt.Errorf("failed to download pcap file from target pod: %v", err)
+		return fmt.Errorf("failed to download pcap file from target pod: %w", err)
 	}
 	err = kubeapi.CopyFileFromPod(ctx, targetPodName, TcpdumpContainerName, TcpdumpLogPath, tcpdumpLogPath, true)
 	if err != nil {
-		return fmt.Errorf("failed to download tcpdump log file from target pod: %v", err)
+		return fmt.Errorf("failed to download tcpdump log file from target pod: %w", err)
 	}
 	err = kubeapi.CopyFileFromPod(ctx, targetPodName, ReordercapContainerName, ReordercapLogPath, reordercapLogPath, true)
 	if err != nil {
-		return fmt.Errorf("failed to download reordercap log file from target pod: %v", err)
+		return fmt.Errorf("failed to download reordercap log file from target pod: %w", err)
 	}
 
 	// Download the attacker's output log (attack.log)
@@ -292,11 +315,12 @@ func (s *SingleTargetScenario) downloadResults(ctx context.Context, outputDir, p
 		log.Printf("warning: failed to download attack log from attacker pod: %v", err)
 		// Not fatal, continue
 	}
+	downloadBackgroundLogs(ctx, outputDir, prefix, s.Background, s.Deployment.BackgroundPodSpecs)
 
 	// Write the finished scenario to output directory
 	err = WriteScenarioToPath(s, filepath.Join(outputDir, prefix+"scenario.yaml"))
 	if err != nil {
-		return fmt.Errorf("error writing scenario file: %v", err)
+		return fmt.Errorf("error writing scenario file: %w", err)
 	}
 
 	return nil
@@ -333,44 +357,40 @@ func (s *SingleTargetScenario) ProcessResults(ctx context.Context, outputDir str
 	return nil
 }
 
+// LabelResults adds the scenario identity and the target's merged labels to every processor output
+func (s *SingleTargetScenario) LabelResults(outputDir string, processingPods []*ProcessingPod) error {
+	columns := ScenarioLabelColumns(s.Name, s.UUID, s.Target.Labels)
+	if err := LabelProcessorOutputs(outputDir, processingPods, columns, s.AttackWindows()); err != nil {
+		return fmt.Errorf("label results for scenario %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+// AttackWindows returns the attacker and target pair that was active during the attack, one window per stage if the attacker has stages
+func (s *SingleTargetScenario) AttackWindows() []AttackWindow {
+	return attackerWindows(s.Attacker, s.Deployment.AttackPodSpec.PodIP, s.Deployment.TargetPodSpec.PodIP, s.StartTime, s.StopTime)
+}
+
 // DeleteAllPods deletes all pods for the scenario
 func (s *SingleTargetScenario) DeleteAllPods(ctx context.Context) error {
 	podsToDelete := []string{
 		s.Deployment.AttackPodSpec.PodName,
 		s.Deployment.TargetPodSpec.PodName,
 	}
-
-	errCh := make(chan error, len(podsToDelete))
-	var wg sync.WaitGroup
-
-	for _, podName := range podsToDelete {
-		wg.Add(1)
-		go func(podName string) {
-			defer wg.Done()
-			if err := kubeapi.DeletePod(ctx, podName); err != nil {
-				errCh <- fmt.Errorf("failed to delete pod %s: %w", podName, err)
-			}
-		}(podName)
-	}
-
-	wg.Wait()
-	close(errCh)
-
-	var errs []error
-	for err := range errCh {
-		errs = append(errs, err)
+	for _, backgroundPodSpec := range s.Deployment.BackgroundPodSpecs {
+		podsToDelete = append(podsToDelete, backgroundPodSpec.PodName)
 	}
 
-	return errors.Join(errs...)
+	return deletePods(ctx, podsToDelete)
 }
 
 // GetTrafficFilter returns the tcpdump filter for the scenario with the placeholders replaced by the actual pod IPs
 func (s *SingleTargetScenario) GetTrafficFilter() string {
-	if s.Deployment != (SingleTargetDeployment{}) {
-		replacer := strings.NewReplacer(
+	if s.Deployment.AttackPodSpec != (kubeapi.RunningPodSpec{}) || s.Deployment.TargetPodSpec != (kubeapi.RunningPodSpec{}) {
+		replacements := append(backgroundFilterReplacements(s.Deployment.BackgroundPodSpecs),
 			"$ATTACKER_IP", s.Deployment.AttackPodSpec.PodIP,
 			"$TARGET_IP", s.Deployment.TargetPodSpec.PodIP)
-		return replacer.Replace(s.Target.Filter)
+		return strings.NewReplacer(replacements...).Replace(s.Target.Filter)
 	}
 	return s.Target.Filter
 }
@@ -0,0 +1,157 @@
+package scenarios
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+)
+
+// AttackStage is one step of an attack chain, such as recon, exploitation or exfiltration
+type AttackStage struct {
+	Name string `yaml:"name"`
+	// Image runs the stage in a dedicated container of the attacker pod, defaults to the attacker container
+	Image      string `yaml:"image,omitempty"`
+	AtkCommand string `yaml:"atkCommand"`
+	AtkTime    string `yaml:"atkTime,omitempty"`
+	// Delay is waited after the previous stage finished and before this stage starts
+	Delay string `yaml:"delay,omitempty"`
+	// Label is written to the flow label column for flows during this stage, defaults to the stage name
+	Label string `yaml:"label,omitempty"`
+	// StartTime and StopTime of the stage command, recorded during execution
+	StartTime time.Time `yaml:"startTime,omitempty"`
+	StopTime  time.Time `yaml:"stopTime,omitempty"`
+}
+
+// prepareAttackCommands applies the attack time and log redirection to the attacker command or,
+// when stages are configured, to the command of every stage.
+func prepareAttackCommands(attacker *Attacker) error {
+	if len(attacker.Stages) == 0 {
+		attacker.AtkCommand = withAttackTimeout(attacker.AtkCommand, attacker.AtkTime, &attacker.AtkTime)
+		return nil
+	}
+
+	if attacker.AtkCommand != "" {
+		return fmt.Errorf("attacker '%s' defines both atkCommand and stages", attacker.Name)
+	}
+
+	names := make(map[string]bool, len(attacker.Stages))
+	for i := range attacker.Stages {
+		stage := &attacker.Stages[i]
+		if stage.Name == "" {
+			stage.Name = fmt.Sprintf("stage-%d", i)
+		}
+		if names[stage.Name] {
+			return fmt.Errorf("attacker '%s' has duplicate stage name: '%s'", attacker.Name, stage.Name)
+		}
+		names[stage.Name] = true
+
+		if stage.AtkCommand == "" {
+			return fmt.Errorf("no atkCommand provided for stage '%s' of attacker '%s'", stage.Name, attacker.Name)
+		}
+		if stage.Delay != "" {
+			if _, err := time.ParseDuration(stage.Delay); err != nil {
+				return fmt.Errorf("invalid delay %q for stage '%s': %w", stage.Delay, stage.Name, err)
+			}
+		}
+		if stage.Label == "" {
+			stage.Label = stage.Name
+		}
+
+		// The attacker attack time is the default for every stage
+		if stage.AtkTime == "" {
+			stage.AtkTime = attacker.AtkTime
+		}
+		stage.AtkCommand = withAttackTimeout(stage.AtkCommand, stage.AtkTime, &stage.AtkTime)
+	}
+	attacker.AtkTime = EmptyAttackDuration
+	return nil
+}
+
+// withAttackTimeout normalizes atkTime into normalized and wraps the command in a timeout and the attack log
+func withAttackTimeout(cmd, atkTime string, normalized *string) string {
+	seconds, err := ParseToSeconds(atkTime)
+	if err != nil {
+		seconds = EmptyAttackDuration
+	}
+	*normalized = seconds
+
+	// Modify the attack command to include a timeout if a duration is provided
+	if seconds != EmptyAttackDuration {
+		cmd = "timeout " + seconds + " " + cmd
+	}
+	return withAttackLogging(cmd)
+}
+
+// stageContainerName returns the attacker pod container that runs a stage
+func stageContainerName(attacker Attacker, index int) string {
+	if attacker.Stages[index].Image == "" {
+		return CleanPodName(attacker.Name)
+	}
+	return fmt.Sprintf("stage-%d", index)
+}
+
+// runAttack executes the attacker command, or every stage in order, in the deployed attacker pod
+func runAttack(ctx context.Context, scenarioName string, attacker *Attacker, podSpec kubeapi.RunningPodSpec, envVars map[string]string) error {
+	if len(attacker.Stages) == 0 {
+		return execAttackCommand(ctx, scenarioName, attacker.Name, podSpec.PodName, podSpec.ContainerName, attacker.AtkCommand, envVars)
+	}
+
+	for i := range attacker.Stages {
+		stage := &attacker.Stages[i]
+		if stage.Delay != "" {
+			delay, _ := time.ParseDuration(stage.Delay) // Validated in prepareAttackCommands
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return fmt.Errorf("stage %s: %w", stage.Name, ctx.Err())
+			}
+		}
+
+		log.Printf("Starting stage %s of attacker %s in scenario %v", stage.Name, attacker.Name, scenarioName)
+		stage.StartTime = time.Now()
+		err := execAttackCommand(ctx, scenarioName, attacker.Name, podSpec.PodName, stageContainerName(*attacker, i), stage.AtkCommand, envVars)
+		stage.StopTime = time.Now()
+		if err != nil {
+			return fmt.Errorf("stage %s: %w", stage.Name, err)
+		}
+	}
+	return nil
+}
+
+func execAttackCommand(ctx context.Context, scenarioName, attackerName, podName, containerName, command string, envVars map[string]string) error {
+	log.Printf("Executing attack '%v' in scenario %v", command, scenarioName)
+	stdo, stde, err := kubeapi.ExecShellInContainerWithEnvVars(ctx, kubeapi.WorkloadNamespace, podName, containerName, command, envVars)
+	if err != nil {
+		return err
+	}
+	if stde != "" {
+		log.Printf("%s : %s : stdout: %s\n\t stderr: %s", scenarioName, attackerName, stdo, stde)
+	}
+	return nil
+}
+
+// attackerWindows returns the attack windows of one attacker and target pair. An attacker with
+// stages gets one window per stage, labeled with the stage label.
+func attackerWindows(attacker Attacker, attackerIP, targetIP string, start, stop time.Time) []AttackWindow {
+	if len(attacker.Stages) == 0 {
+		return []AttackWindow{{AttackerIP: attackerIP, TargetIP: targetIP, Start: start, Stop: stop}}
+	}
+
+	windows := make([]AttackWindow, 0, len(attacker.Stages))
+	for _, stage := range attacker.Stages {
+		if stage.StartTime.IsZero() {
+			continue // Stage never started
+		}
+		windows = append(windows, AttackWindow{
+			AttackerIP: attackerIP,
+			TargetIP:   targetIP,
+			Start:      stage.StartTime,
+			Stop:       stage.StopTime,
+			Label:      stage.Label,
+		})
+	}
+	return windows
+}
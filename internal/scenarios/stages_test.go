@@ -0,0 +1,140 @@
+package scenarios
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrepareAttackCommandsWrapsEveryStage(t *testing.T) {
+	attacker := Attacker{
+		Name:    "chain",
+		AtkTime: "1m",
+		Stages: []AttackStage{
+			{Name: "recon", AtkCommand: "nmap $TARGET_IP"},
+			{AtkCommand: "hydra $TARGET_IP", AtkTime: "10s", Delay: "5s", Label: "exploitation"},
+		},
+	}
+	if err := prepareAttackCommands(&attacker); err != nil {
+		t.Fatalf("prepareAttackCommands returned error: %v", err)
+	}
+
+	if attacker.AtkTime != EmptyAttackDuration {
+		t.Fatalf("AtkTime = %q, want %q", attacker.AtkTime, EmptyAttackDuration)
+	}
+	if got := attacker.Stages[0].AtkCommand; !strings.Contains(got, "(timeout 60s nmap $TARGET_IP)") {
+		t.Fatalf("Stages[0].AtkCommand = %q, want attacker atkTime as timeout", got)
+	}
+	if got := attacker.Stages[1].AtkCommand; !strings.Contains(got, "(timeout 10s hydra $TARGET_IP)") {
+		t.Fatalf("Stages[1].AtkCommand = %q, want stage atkTime as timeout", got)
+	}
+	if got, want := attacker.Stages[0].Label, "recon"; got != want {
+		t.Fatalf("Stages[0].Label = %q, want %q", got, want)
+	}
+	if got, want := attacker.Stages[1].Name, "stage-1"; got != want {
+		t.Fatalf("Stages[1].Name = %q, want %q", got, want)
+	}
+}
+
+func TestPrepareAttackCommandsRejectsInvalidStages(t *testing.T) {
+	tests := []struct {
+		name     string
+		attacker Attacker
+		want     string
+	}{
+		{
+			name:     "command and stages",
+			attacker: Attacker{Name: "a", AtkCommand: "nmap", Stages: []AttackStage{{AtkCommand: "nmap"}}},
+			want:     "both atkCommand and stages",
+		},
+		{
+			name:     "missing command",
+			attacker: Attacker{Name: "a", Stages: []AttackStage{{Name: "recon"}}},
+			want:     "no atkCommand",
+		},
+		{
+			name:     "duplicate name",
+			attacker: Attacker{Name: "a", Stages: []AttackStage{{Name: "x", AtkCommand: "a"}, {Name: "x", AtkCommand: "b"}}},
+			want:     "duplicate stage name",
+		},
+		{
+			name:     "invalid delay",
+			attacker: Attacker{Name: "a", Stages: []AttackStage{{AtkCommand: "a", Delay: "soon"}}},
+			want:     "invalid delay",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := prepareAttackCommands(&tt.attacker)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("prepareAttackCommands error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttackerWindowsLabelFlowsPerStage(t *testing.T) {
+	start := time.Date(2024, 7, 26, 17, 46, 41, 0, time.UTC)
+	attacker := Attacker{Stages: []AttackStage{
+		{Name: "recon", Label: "recon", StartTime: start, StopTime: start.Add(10 * time.Second)},
+		{Name: "exploit", Label: "exploitation", StartTime: start.Add(20 * time.Second), StopTime: start.Add(30 * time.Second)},
+		{Name: "exfil", Label: "exfiltration"},
+	}}
+
+	windows := attackerWindows(attacker, "10.0.0.1", "10.0.0.2", start, start.Add(30*time.Second))
+	if len(windows) != 2 {
+		t.Fatalf("attackerWindows returned %d windows, want 2 for the stages that ran", len(windows))
+	}
+
+	labeler, err := (&FlowLabeler{Columns: FlowFormats["nfstream"], Windows: windows}).bind(strings.Split(
+		"src_ip,src_port,dst_ip,dst_port,protocol,bidirectional_first_seen_ms,bidirectional_last_seen_ms", ","))
+	if err != nil {
+		t.Fatalf("bind flow labeler: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Time
+		want string
+	}{
+		{start.Add(5 * time.Second), "recon"},
+		{start.Add(15 * time.Second), FlowLabelBenign},
+		{start.Add(25 * time.Second), "exploitation"},
+	} {
+		millis := strconv.FormatInt(tt.at.UnixMilli(), 10)
+		got, err := labeler.Label([]string{"10.0.0.1", "4000", "10.0.0.2", "80", "6", millis, millis})
+		if err != nil {
+			t.Fatalf("Label at %v returned error: %v", tt.at, err)
+		}
+		if got != tt.want {
+			t.Fatalf("Label at %v = %q, want %q", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestBuildAttackerPodAddsStageContainers(t *testing.T) {
+	pod := BuildAttackerPod("chain", Attacker{
+		Name:       "chain",
+		Image:      "example/nmap:latest",
+		CPURequest: "100m",
+		MemRequest: "128Mi",
+		Stages: []AttackStage{
+			{Name: "recon", AtkCommand: "nmap"},
+			{Name: "exploit", Image: "example/hydra:latest", AtkCommand: "hydra"},
+		},
+	}, "scenario-a")
+
+	if len(pod.Spec.Containers) != 2 {
+		t.Fatalf("Containers = %d, want 2", len(pod.Spec.Containers))
+	}
+	stage := pod.Spec.Containers[1]
+	if got, want := stage.Name, "stage-1"; got != want {
+		t.Fatalf("stage container Name = %q, want %q", got, want)
+	}
+	if got, want := stage.Image, "example/hydra:latest"; got != want {
+		t.Fatalf("stage container Image = %q, want %q", got, want)
+	}
+	if len(stage.VolumeMounts) != 1 || stage.VolumeMounts[0].MountPath != "/logs" {
+		t.Fatalf("stage container VolumeMounts = %#v, want shared /logs mount", stage.VolumeMounts)
+	}
+}
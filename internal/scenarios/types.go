@@ -1,13 +1,24 @@
 package scenarios
 
-import apiv1 "k8s.io/api/core/v1"
+import (
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+)
 
 // Constants used across different scenario types
 const (
 	EmptyAttackDuration  = ""
 	SingleTargetType     = "single-target"
 	MultiTargetType      = "multi-target"
+	MultiAttackerType    = "multi-attacker"
 	DefaultTcpdumpFilter = "((dst host $ATTACKER_IP and src host $TARGET_IP) or (dst host $TARGET_IP and src host $ATTACKER_IP)) and not arp"
+	// DefaultMultiAttackerTcpdumpFilter captures the traffic between a target and any of the attackers
+	DefaultMultiAttackerTcpdumpFilter = "host $TARGET_IP and ($ATTACKER_HOSTS) and not arp"
+	// DefaultBackgroundTcpdumpFilter also captures the traffic of the background clients
+	DefaultBackgroundTcpdumpFilter = "host $TARGET_IP and (host $ATTACKER_IP or $BACKGROUND_HOSTS) and not arp"
+	// DefaultMultiAttackerBackgroundTcpdumpFilter also captures the traffic of the background clients
+	DefaultMultiAttackerBackgroundTcpdumpFilter = "host $TARGET_IP and ($ATTACKER_HOSTS or $BACKGROUND_HOSTS) and not arp"
 )
 
 // Common type definitions used across different scenario types
@@ -25,6 +36,13 @@ type Attacker struct {
 	Network Network `yaml:"network,omitempty"`
 	// Privileged mode for attacker pod
 	Privileged bool `yaml:"privileged,omitempty"`
+	// Stages run one after another instead of AtkCommand
+	Stages []AttackStage `yaml:"stages,omitempty"`
+	// StartTime and StopTime of this attacker's command, only recorded in multi-attacker scenarios
+	StartTime time.Time `yaml:"startTime,omitempty"`
+	StopTime  time.Time `yaml:"stopTime,omitempty"`
+	// TCCommands are the tc commands that shaped the traffic of the pod, recorded after deployment
+	TCCommands []string `yaml:"tcCommands,omitempty"`
 }
 
 type TargetConfig struct {
@@ -49,6 +67,8 @@ type TargetConfig struct {
 	StartupProbe *apiv1.Probe `yaml:"-"`
 	// Privileged mode for target pod
 	Privileged bool `yaml:"privileged,omitempty"`
+	// TCCommands are the tc commands that shaped the traffic of the pod, recorded after deployment
+	TCCommands []string `yaml:"tcCommands,omitempty"`
 }
 
 type Network struct {
@@ -62,4 +82,82 @@ type Network struct {
 	Corrupt      string `yaml:"corrupt"`
 	Duplicate    string `yaml:"duplicate"`
 	Seed         string `yaml:"seed"`
+	// Correlations of the delay, random loss, corruption and duplication of a packet with those of the
+	// previous packet, in percent
+	DelayCorrelation     string `yaml:"delayCorrelation,omitempty"`
+	LossCorrelation      string `yaml:"lossCorrelation,omitempty"`
+	CorruptCorrelation   string `yaml:"corruptCorrelation,omitempty"`
+	DuplicateCorrelation string `yaml:"duplicateCorrelation,omitempty"`
+	// LossState and LossGemodel replace random loss with a Markov model, for bursty loss
+	LossState   *LossState   `yaml:"lossState,omitempty"`
+	LossGemodel *LossGemodel `yaml:"lossGemodel,omitempty"`
+	// Reorder sends this percentage of packets without delay, so that they overtake the delayed ones.
+	// With Gap, every gap-th packet is sent without delay instead.
+	Reorder            string `yaml:"reorder,omitempty"`
+	ReorderCorrelation string `yaml:"reorderCorrelation,omitempty"`
+	Gap                string `yaml:"gap,omitempty"`
+	// Rate limits the rate within netem, counting the link layer overhead of every packet in bytes, and
+	// of every cell for links that send packets in cells of RateCellSize bytes
+	Rate               string `yaml:"rate,omitempty"`
+	RatePacketOverhead string `yaml:"ratePacketOverhead,omitempty"`
+	RateCellSize       string `yaml:"rateCellSize,omitempty"`
+	RateCellOverhead   string `yaml:"rateCellOverhead,omitempty"`
+	// Slot sends packets in bursts at the start of time slots, like the transmission slots of Wi-Fi and LTE
+	Slot *Slot `yaml:"slot,omitempty"`
+	// Ingress shapes the traffic the pod receives, with the same settings as the traffic it sends
+	Ingress *Network `yaml:"ingress,omitempty"`
+	// Rules shape the traffic exchanged with specific peers differently, the first matching rule applies
+	Rules []NetworkRule `yaml:"rules,omitempty"`
+	// Schedule changes the settings while the attack runs
+	Schedule []NetworkChange `yaml:"schedule,omitempty"`
+}
+
+// LossState is the 4-state Markov loss model of netem. The probabilities, in percent, are the transition
+// probabilities between good reception (1), good reception within a burst (2), burst loss (3) and
+// isolated loss (4). Every probability requires the ones before it.
+type LossState struct {
+	P13 string `yaml:"p13"`
+	P31 string `yaml:"p31,omitempty"`
+	P32 string `yaml:"p32,omitempty"`
+	P23 string `yaml:"p23,omitempty"`
+	P14 string `yaml:"p14,omitempty"`
+}
+
+// LossGemodel is the Gilbert-Elliott loss model of netem. P and R are the probabilities, in percent, of
+// moving to the bad and back to the good state. BadLoss (1-h) and GoodLoss (1-k) are the loss
+// probabilities in the bad and the good state. Every probability requires the ones before it.
+type LossGemodel struct {
+	P        string `yaml:"p"`
+	R        string `yaml:"r,omitempty"`
+	BadLoss  string `yaml:"badLoss,omitempty"`
+	GoodLoss string `yaml:"goodLoss,omitempty"`
+}
+
+// Slot delays packets to the start of the next time slot and sends at most Packets packets or Bytes
+// bytes per slot. Slots last between Min and Max, or Delay with Jitter following Distribution.
+type Slot struct {
+	Min          string `yaml:"min,omitempty"`
+	Max          string `yaml:"max,omitempty"`
+	Distribution string `yaml:"distribution,omitempty"`
+	Delay        string `yaml:"delay,omitempty"`
+	Jitter       string `yaml:"jitter,omitempty"`
+	Packets      string `yaml:"packets,omitempty"`
+	Bytes        string `yaml:"bytes,omitempty"`
+}
+
+// NetworkRule shapes the traffic exchanged with one peer. Its settings are merged over the network
+// configuration the rule belongs to.
+type NetworkRule struct {
+	// Peer is attacker (every attacker), the name of a target, attacker or background client,
+	// or an IPv4 address or CIDR
+	Peer    string `yaml:"peer"`
+	Network `yaml:",inline"`
+}
+
+// NetworkChange changes the network settings of a pod while the attack runs. Its settings are merged over
+// the network configuration the schedule belongs to, not over the previous change.
+type NetworkChange struct {
+	// At is an offset from the start of the attack, such as 30s, or an RFC 3339 timestamp
+	At      string `yaml:"at"`
+	Network `yaml:",inline"`
 }
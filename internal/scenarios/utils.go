@@ -1,12 +1,16 @@
 package scenarios
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
 	"gopkg.in/yaml.v2"
 )
 
@@ -24,6 +28,38 @@ func WriteScenarioToPath(scenario ScenarioInterface, outputPath string) error {
 	return os.WriteFile(outputPath, b, 0644)
 }
 
+// collectErrors drains a closed error channel into a slice
+func collectErrors(errCh <-chan error) []error {
+	var errs []error
+	for err := range errCh {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// deletePods deletes the named pods concurrently. Empty names, of pods that were never deployed, are skipped.
+func deletePods(ctx context.Context, podNames []string) error {
+	errCh := make(chan error, len(podNames))
+	var wg sync.WaitGroup
+	for _, podName := range podNames {
+		if podName == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(podName string) {
+			defer wg.Done()
+			if err := kubeapi.DeletePod(ctx, podName); err != nil {
+				errCh <- fmt.Errorf("failed to delete pod %s: %w", podName, err)
+			}
+		}(podName)
+	}
+	wg.Wait()
+	close(errCh)
+	return errors.Join(collectErrors(errCh)...)
+}
+
 // ParseToSeconds converts a time string (e.g., "10s", "2m", "1h") to a standardized
 // string representation of seconds (e.g., "600s" for "10m").
 func ParseToSeconds(s string) (string, error) {
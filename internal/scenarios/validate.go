@@ -0,0 +1,496 @@
+package scenarios
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	kubeapi "github.com/idlab-discover/concap/internal/kubernetes"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Severity of a validation problem
+type Severity string
+
+const (
+	// SeverityError marks problems that make the scenario fail or behave differently than written
+	SeverityError Severity = "error"
+	// SeverityWarning marks settings that have no effect
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is a validation problem in a scenario or processing pod file
+type Problem struct {
+	File string
+	// Scenario is the expanded scenario name, empty for problems that apply to the whole file
+	Scenario string
+	// Field is the location of the problem in the file, such as targets[1].network.delay
+	Field    string
+	Message  string
+	Severity Severity
+}
+
+func (p Problem) String() string {
+	location := p.File
+	if p.Scenario != "" {
+		location += " [" + p.Scenario + "]"
+	}
+	if p.Field != "" {
+		location += " " + p.Field
+	}
+	return fmt.Sprintf("%s: %s: %s", location, p.Severity, p.Message)
+}
+
+// HasErrors reports whether any of the problems is an error
+func HasErrors(problems []Problem) bool {
+	for _, problem := range problems {
+		if problem.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Placeholders are the variables the scenarios set for commands and filters. Commands are only
+// checked for variables with these prefixes since they can use any other shell variable.
+var commandPlaceholderPattern = regexp.MustCompile(`\$\{?((?:ATTACKER|TARGET|BACKGROUND)[A-Za-z0-9_]*)\}?`)
+var filterPlaceholderPattern = regexp.MustCompile(`\$[A-Za-z0-9_]*`)
+
+// Dummy pod IPs used to substitute the filter placeholders before checking the filter syntax
+const (
+	dummyAttackerSubnet   = "10.0.0."
+	dummyTargetSubnet     = "10.0.1."
+	dummyBackgroundSubnet = "10.0.2."
+)
+
+// scenarioLinter collects the problems of one expanded scenario
+type scenarioLinter struct {
+	file     string
+	scenario string
+	// peers are the cleaned names that network rules can use as peer
+	peers    map[string]bool
+	problems []Problem
+}
+
+func (l *scenarioLinter) add(severity Severity, field, format string, args ...interface{}) {
+	l.problems = append(l.problems, Problem{
+		File:     l.file,
+		Scenario: l.scenario,
+		Field:    field,
+		Message:  fmt.Sprintf(format, args...),
+		Severity: severity,
+	})
+}
+
+func (l *scenarioLinter) errorf(field, format string, args ...interface{}) {
+	l.add(SeverityError, field, format, args...)
+}
+
+func (l *scenarioLinter) warnf(field, format string, args ...interface{}) {
+	l.add(SeverityWarning, field, format, args...)
+}
+
+// ValidateScenarioFile checks every scenario a scenario file expands into, without deploying
+// anything. It reports all problems found rather than stopping at the first.
+func ValidateScenarioFile(filePath string) []Problem {
+	sources, err := LoadScenarioSources(filePath)
+	if err != nil {
+		return []Problem{{File: filePath, Message: err.Error(), Severity: SeverityError}}
+	}
+
+	var problems []Problem
+	for _, source := range sources {
+		scenario := ""
+		if len(sources) > 1 {
+			scenario = source.Name
+		}
+		l := &scenarioLinter{file: filePath, scenario: scenario}
+		_, err := CreateScenarioFromSource(source)
+		if err != nil && !errors.Is(err, ErrInvalidNetwork) {
+			l.errorf("", "%v", err)
+		}
+		l.lintSource(source)
+		// Invalid network configurations are reported per field by lintSource, unless only the merged one is invalid
+		if errors.Is(err, ErrInvalidNetwork) && !l.hasErrors() {
+			l.errorf("", "%v", err)
+		}
+		problems = append(problems, l.problems...)
+	}
+	return problems
+}
+
+// hasErrors reports whether an error was found in the scenario
+func (l *scenarioLinter) hasErrors() bool {
+	for _, problem := range l.problems {
+		if problem.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// lintSource checks the definition as written, before defaults are applied and networks are merged,
+// so that problems are reported at the field that causes them.
+func (l *scenarioLinter) lintSource(source ScenarioSource) {
+	var typeConfig ScenarioTypeConfig
+	if err := yaml.Unmarshal(source.YAML, &typeConfig); err != nil {
+		return // Reported by CreateScenarioFromSource
+	}
+
+	switch strings.ToLower(typeConfig.Type) {
+	case MultiTargetType:
+		var s MultiTargetScenario
+		if err := yaml.Unmarshal(source.YAML, &s); err != nil {
+			return
+		}
+		l.lintMultiTarget(&s)
+	case MultiAttackerType:
+		var s MultiAttackerScenario
+		if err := yaml.Unmarshal(source.YAML, &s); err != nil {
+			return
+		}
+		l.lintMultiAttacker(&s)
+	default:
+		var s SingleTargetScenario
+		if err := yaml.Unmarshal(source.YAML, &s); err != nil {
+			return
+		}
+		l.lintSingleTarget(&s)
+	}
+}
+
+func (l *scenarioLinter) lintSingleTarget(s *SingleTargetScenario) {
+	s.Deployment = SingleTargetDeployment{
+		AttackPodSpec:      dummyPodSpecs(dummyAttackerSubnet, 1)[0],
+		TargetPodSpec:      dummyPodSpecs(dummyTargetSubnet, 1)[0],
+		BackgroundPodSpecs: dummyPodSpecs(dummyBackgroundSubnet, len(s.Background)),
+	}
+	l.peers = peerNames([]string{s.Attacker.Name}, []TargetConfig{s.Target}, s.Background)
+
+	l.lintNetwork("network", s.Network, Network{})
+	l.lintAttacker("attacker", s.Attacker, s.Network, s.GetShellEnvVars())
+	l.lintTarget("target", s.Target, s.Network)
+	if s.Target.Filter != "" {
+		l.lintFilter("target.filter", s.GetTrafficFilter())
+	}
+	l.lintBackground(s.Background, s.Network, []kubeapi.RunningPodSpec{s.Deployment.TargetPodSpec})
+}
+
+func (l *scenarioLinter) lintMultiTarget(s *MultiTargetScenario) {
+	s.Deployment = MultiTargetDeployment{
+		AttackPodSpec:      dummyPodSpecs(dummyAttackerSubnet, 1)[0],
+		TargetPodSpecs:     dummyPodSpecs(dummyTargetSubnet, len(s.Targets)),
+		BackgroundPodSpecs: dummyPodSpecs(dummyBackgroundSubnet, len(s.Background)),
+	}
+	attacker := s.Attacker.Name
+	if attacker == "" {
+		attacker = "Attacker"
+	}
+	l.peers = peerNames([]string{attacker}, s.Targets, s.Background)
+
+	l.lintNetwork("network", s.Network, Network{})
+	l.lintAttacker("attacker", s.Attacker, s.Network, s.GetShellEnvVars())
+	l.lintTargets(s.Targets, s.Network, s.GetTrafficFilterForTarget)
+	l.lintBackground(s.Background, s.Network, s.Deployment.TargetPodSpecs)
+}
+
+func (l *scenarioLinter) lintMultiAttacker(s *MultiAttackerScenario) {
+	s.Deployment = MultiAttackerDeployment{
+		AttackPodSpecs:     dummyPodSpecs(dummyAttackerSubnet, len(s.Attackers)),
+		TargetPodSpecs:     dummyPodSpecs(dummyTargetSubnet, len(s.Targets)),
+		BackgroundPodSpecs: dummyPodSpecs(dummyBackgroundSubnet, len(s.Background)),
+	}
+	attackers := make([]string, len(s.Attackers))
+	for i, attacker := range s.Attackers {
+		attackers[i] = attacker.Name
+		if attackers[i] == "" {
+			attackers[i] = fmt.Sprintf("Attacker-%d", i)
+		}
+	}
+	l.peers = peerNames(attackers, s.Targets, s.Background)
+
+	if s.Stagger != "" {
+		if _, err := time.ParseDuration(s.Stagger); err != nil {
+			l.errorf("stagger", "invalid duration %q", s.Stagger)
+		}
+	}
+	l.lintNetwork("network", s.Network, Network{})
+	for i, attacker := range s.Attackers {
+		l.lintAttacker(fmt.Sprintf("attackers[%d]", i), attacker, s.Network, s.GetShellEnvVarsForAttacker(i))
+	}
+	l.lintTargets(s.Targets, s.Network, s.GetTrafficFilterForTarget)
+	l.lintBackground(s.Background, s.Network, s.Deployment.TargetPodSpecs)
+}
+
+// peerNames returns the cleaned names that network rules can use as peer, with the default names applied
+func peerNames(attackers []string, targets []TargetConfig, background []BackgroundClient) map[string]bool {
+	names := map[string]bool{PeerAttacker: true}
+	for _, name := range attackers {
+		names[CleanPodName(name)] = true
+	}
+	for i, target := range targets {
+		name := target.Name
+		if name == "" {
+			name = fmt.Sprintf("Target-%d", i)
+		}
+		names[CleanPodName(name)] = true
+	}
+	for i, client := range background {
+		name := client.Name
+		if name == "" {
+			name = fmt.Sprintf("Background-%d", i)
+		}
+		names[CleanPodName(name)] = true
+	}
+	return names
+}
+
+// dummyPodSpecs returns count running pod specs with IPs in the given /24 subnet
+func dummyPodSpecs(subnet string, count int) []kubeapi.RunningPodSpec {
+	podSpecs := make([]kubeapi.RunningPodSpec, count)
+	for i := range podSpecs {
+		podSpecs[i] = kubeapi.RunningPodSpec{
+			PodName: fmt.Sprintf("pod-%d", i),
+			PodIP:   fmt.Sprintf("%s%d", subnet, i+1),
+		}
+	}
+	return podSpecs
+}
+
+func (l *scenarioLinter) lintAttacker(field string, attacker Attacker, global Network, envVars map[string]string) {
+	l.lintResources(field, attacker.CPURequest, attacker.CPULimit, attacker.MemRequest, attacker.MemLimit)
+	l.lintNetwork(field+".network", attacker.Network, MergeNetworks(global, attacker.Network))
+	l.lintAttackTime(field+".atkTime", attacker.AtkTime)
+	l.lintCommand(field+".atkCommand", attacker.AtkCommand, envVars)
+
+	for i, stage := range attacker.Stages {
+		stageField := fmt.Sprintf("%s.stages[%d]", field, i)
+		l.lintAttackTime(stageField+".atkTime", stage.AtkTime)
+		if stage.Delay != "" {
+			if _, err := time.ParseDuration(stage.Delay); err != nil {
+				l.errorf(stageField+".delay", "invalid duration %q", stage.Delay)
+			}
+		}
+		l.lintCommand(stageField+".atkCommand", stage.AtkCommand, envVars)
+	}
+}
+
+// lintAttackTime checks an attack time, which is rounded down to whole seconds for the timeout command
+func (l *scenarioLinter) lintAttackTime(field, atkTime string) {
+	if atkTime == "" {
+		return
+	}
+	duration, err := time.ParseDuration(atkTime)
+	if err != nil {
+		l.errorf(field, "invalid duration %q, the attack would run without a timeout", atkTime)
+		return
+	}
+	if duration < time.Second {
+		l.errorf(field, "duration %q rounds down to 0s, which disables the timeout", atkTime)
+	}
+}
+
+func (l *scenarioLinter) lintTargets(targets []TargetConfig, global Network, filter func(int) string) {
+	names := make(map[string]int, len(targets))
+	for i, target := range targets {
+		field := fmt.Sprintf("targets[%d]", i)
+		name := target.Name
+		if name == "" {
+			name = fmt.Sprintf("Target-%d", i)
+		}
+		if first, ok := names[CleanPodName(name)]; ok {
+			l.errorf(field+".name", "duplicate target name %q, also used by targets[%d]", name, first)
+		} else {
+			names[CleanPodName(name)] = i
+		}
+
+		l.lintTarget(field, target, global)
+		if target.Filter != "" {
+			l.lintFilter(field+".filter", filter(i))
+		}
+	}
+}
+
+func (l *scenarioLinter) lintTarget(field string, target TargetConfig, global Network) {
+	l.lintResources(field, target.CPURequest, target.CPULimit, target.MemRequest, target.MemLimit)
+	l.lintNetwork(field+".network", target.Network, MergeNetworks(global, target.Network))
+}
+
+func (l *scenarioLinter) lintBackground(clients []BackgroundClient, global Network, targetPodSpecs []kubeapi.RunningPodSpec) {
+	envVars := backgroundEnvVars(targetPodSpecs)
+	for i, client := range clients {
+		field := fmt.Sprintf("background[%d]", i)
+		l.lintResources(field, client.CPURequest, client.CPULimit, client.MemRequest, client.MemLimit)
+		l.lintNetwork(field+".network", client.Network, MergeNetworks(global, client.Network))
+		l.lintCommand(field+".command", client.Command, envVars)
+	}
+}
+
+// lintResources checks the resource quantities, which would otherwise panic when the pod is built
+func (l *scenarioLinter) lintResources(field, cpuRequest, cpuLimit, memRequest, memLimit string) {
+	for _, quantity := range []struct{ name, value string }{
+		{"cpuRequest", cpuRequest},
+		{"cpuLimit", cpuLimit},
+		{"memRequest", memRequest},
+		{"memLimit", memLimit},
+	} {
+		if quantity.value == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(quantity.value); err != nil {
+			l.errorf(fieldPath(field, quantity.name), "invalid quantity %q", quantity.value)
+		}
+	}
+}
+
+// fieldPath joins a field name onto the location of its parent, which is empty at the top level
+func fieldPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// lintNetwork reports invalid tc parameters as written and ignored parameters after merging. An
+// ignored parameter inherited from the global network is reported once, at the global network.
+func (l *scenarioLinter) lintNetwork(field string, network, merged Network) {
+	l.lintNetworkAt(field, "network", network, merged)
+}
+
+// lintNetworkAt lints a network configuration whose inherited settings come from globalField, its rules
+// and its ingress
+func (l *scenarioLinter) lintNetworkAt(field, globalField string, network, merged Network) {
+	for _, issue := range network.issues() {
+		if !issue.warning {
+			l.errorf(fieldPath(field, issue.field), "%s", issue.message)
+		}
+	}
+	for i, rule := range network.Rules {
+		if rule.Peer == "" || strings.Contains(rule.Peer, "/") || net.ParseIP(rule.Peer) != nil {
+			continue // Checked by issues
+		}
+		if !l.peers[CleanPodName(rule.Peer)] {
+			l.errorf(fieldPath(field, fmt.Sprintf("rules[%d].peer", i)),
+				"unknown peer %q, expected attacker, the name of a target, attacker or background client, or an IPv4 address or CIDR", rule.Peer)
+		}
+	}
+	for _, issue := range merged.issues() {
+		if !issue.warning {
+			continue
+		}
+		location := fieldPath(field, issue.field)
+		// Rules and schedules are replaced as a whole, so the problems of inherited ones are at the global network
+		inherited := network.value(issue.field) == ""
+		if strings.HasPrefix(issue.field, "rules[") {
+			inherited = len(network.Rules) == 0
+		} else if strings.HasPrefix(issue.field, "schedule[") {
+			inherited = len(network.Schedule) == 0
+		}
+		if inherited {
+			location = fieldPath(globalField, issue.field)
+		}
+		if !l.hasProblem(location, issue.message) {
+			l.warnf(location, "%s", issue.message)
+		}
+	}
+	if network.Ingress != nil || merged.Ingress != nil {
+		var ingress, mergedIngress Network
+		if network.Ingress != nil {
+			ingress = *network.Ingress
+		}
+		if merged.Ingress != nil {
+			mergedIngress = *merged.Ingress
+		}
+		l.lintNetworkAt(fieldPath(field, "ingress"), fieldPath(globalField, "ingress"), ingress, mergedIngress)
+	}
+}
+
+func (l *scenarioLinter) hasProblem(field, message string) bool {
+	for _, problem := range l.problems {
+		if problem.Field == field && problem.Message == message {
+			return true
+		}
+	}
+	return false
+}
+
+// lintCommand reports scenario variables used in a command that are not set for it
+func (l *scenarioLinter) lintCommand(field, command string, envVars map[string]string) {
+	for _, name := range unknownPlaceholders(commandPlaceholderPattern, command, envVars) {
+		l.errorf(field, "unknown placeholder $%s, available: %s", name, placeholderList(envVars))
+	}
+}
+
+// lintFilter checks a filter with its placeholders replaced by dummy IPs
+func (l *scenarioLinter) lintFilter(field, filter string) {
+	if unknown := filterPlaceholderPattern.FindAllString(filter, -1); len(unknown) > 0 {
+		for _, placeholder := range unknown {
+			l.errorf(field, "unknown placeholder %s", placeholder)
+		}
+		return
+	}
+	if err := ValidateBPFFilter(filter); err != nil {
+		l.errorf(field, "invalid filter: %v", err)
+	}
+}
+
+// unknownPlaceholders returns the distinct variable names matched by pattern that are not in known
+func unknownPlaceholders(pattern *regexp.Regexp, s string, known map[string]string) []string {
+	var unknown []string
+	seen := make(map[string]bool)
+	for _, match := range pattern.FindAllStringSubmatch(s, -1) {
+		name := match[1]
+		if _, ok := known[name]; ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		unknown = append(unknown, name)
+	}
+	return unknown
+}
+
+func placeholderList(envVars map[string]string) string {
+	names := make([]string, 0, len(envVars))
+	for name := range envVars {
+		names = append(names, "$"+name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// processingPlaceholderPattern matches the variables set for processing pod commands
+var processingPlaceholderPattern = regexp.MustCompile(`\$\{?((?:INPUT|OUTPUT)[A-Za-z0-9_]*)\}?`)
+
+// ValidateProcessingPodFile checks a processing pod definition without deploying it
+func ValidateProcessingPodFile(filePath string) []Problem {
+	pod, err := ReadProcessingPod(filePath)
+	if err != nil {
+		return []Problem{{File: filePath, Message: err.Error(), Severity: SeverityError}}
+	}
+
+	l := &scenarioLinter{file: filePath}
+	if pod.Name == "" {
+		l.errorf("name", "no name provided")
+	}
+	if pod.ContainerImage == "" {
+		l.errorf("containerImage", "no container image provided")
+	}
+	if strings.TrimSpace(pod.Command) == "" {
+		l.errorf("command", "no command provided")
+	}
+	l.lintResources("", pod.CPURequest, "", pod.MemRequest, "")
+
+	envVars := map[string]string{"INPUT_FILE": "", "INPUT_FILE_NAME": "", "OUTPUT_FILE": ""}
+	for _, name := range unknownPlaceholders(processingPlaceholderPattern, pod.Command, envVars) {
+		l.errorf("command", "unknown placeholder $%s, available: %s", name, placeholderList(envVars))
+	}
+	if !strings.Contains(pod.Command, "OUTPUT_FILE") {
+		l.warnf("command", "command does not reference $OUTPUT_FILE, the output file may not be found")
+	}
+	return l.problems
+}
@@ -0,0 +1,154 @@
+package scenarios
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const invalidMultiTargetScenario = `type: multi-target
+attacker:
+  name: nmap
+  image: instrumentisto/nmap:latest
+  atkCommand: nmap $TARGET_IP $TARGET_IP_0
+  atkTime: 500ms
+  cpuRequest: lots
+targets:
+  - name: web_server
+    image: httpd:2.4.38
+    filter: host $TARGET_IP and host $ATTACKER_HOSTS
+    network:
+      reorder: 150%
+      lossState:
+        p31: 5%
+  - name: web-server
+    image: httpd:2.4.38
+    filter: host $TARGET_IP and (host $ATTACKER_IP
+    memLimit: 1Zi
+network:
+  bandwidth: 100Mbyte
+  delay: 10 ms
+  loss: 120%
+  distribution: normal
+  ingress:
+    delay: fast
+  rules:
+    - peer: web-servr
+    - peer: 10.0.0.0/33
+      jitter: soon
+  schedule:
+    - at: -5s
+      loss: 50%
+`
+
+func TestValidateScenarioFileReportsFieldLocations(t *testing.T) {
+	path := writeScenarioFile(t, "invalid.yaml", invalidMultiTargetScenario)
+
+	problems := ValidateScenarioFile(path)
+
+	want := []struct {
+		field    string
+		severity Severity
+	}{
+		{"network.bandwidth", SeverityError},
+		{"network.delay", SeverityError},
+		{"network.loss", SeverityError},
+		{"network.distribution", SeverityWarning},
+		{"network.ingress.delay", SeverityError},
+		{"network.rules[0].peer", SeverityError},
+		{"network.rules[1].peer", SeverityError},
+		{"network.rules[1].jitter", SeverityError},
+		{"network.schedule[0].at", SeverityError},
+		{"attacker.cpuRequest", SeverityError},
+		{"attacker.atkTime", SeverityError},
+		{"attacker.atkCommand", SeverityError},
+		{"targets[0].filter", SeverityError},
+		{"targets[0].network.reorder", SeverityError},
+		{"targets[0].network.lossState.p13", SeverityError},
+		{"targets[0].network.lossState.p31", SeverityError},
+		{"targets[1].name", SeverityError},
+		{"targets[1].memLimit", SeverityError},
+		{"targets[1].filter", SeverityError},
+	}
+	for _, w := range want {
+		found := false
+		for _, problem := range problems {
+			if problem.Field == w.field && problem.Severity == w.severity {
+				found = true
+				if problem.File != path {
+					t.Fatalf("problem %s File = %q, want %q", problem, problem.File, path)
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("ValidateScenarioFile() missing %s %s in %v", w.severity, w.field, problems)
+		}
+	}
+	if !HasErrors(problems) {
+		t.Fatal("HasErrors() = false, want true")
+	}
+}
+
+func TestValidateScenarioFileAcceptsKnownPlaceholders(t *testing.T) {
+	path := writeScenarioFile(t, "multi-attacker.yaml", `type: multi-attacker
+attackers:
+  - name: flood
+    image: utils/hping3
+    atkCommand: hping3 $TARGET_IP_0 -a $ATTACKER_IP_0 --count $ATTACKER_INDEX
+targets:
+  - name: web
+    image: httpd:2.4.38
+    filter: host $TARGET_IP and ($ATTACKER_HOSTS or host $ATTACKER_IP_0 or $BACKGROUND_HOSTS)
+background:
+  - name: browser
+    image: curlimages/curl
+    command: while true; do curl -s "http://${TARGET_IP}/"; done
+`)
+
+	if problems := ValidateScenarioFile(path); len(problems) != 0 {
+		t.Fatalf("ValidateScenarioFile() = %v, want no problems", problems)
+	}
+}
+
+func TestValidateScenarioFileNamesExpandedScenarios(t *testing.T) {
+	path := writeScenarioFile(t, "sweep.yaml", `attacker:
+  name: nmap
+  image: instrumentisto/nmap:latest
+  atkCommand: nmap $TARGET_IP
+target:
+  name: web
+  image: httpd:2.4.38
+network:
+  delay: 10ms
+matrix:
+  network.delay: [10ms, 10 ms]
+`)
+
+	problems := ValidateScenarioFile(path)
+	if len(problems) != 1 {
+		t.Fatalf("ValidateScenarioFile() = %v, want one problem", problems)
+	}
+	if problems[0].Scenario != "sweep-1" || problems[0].Field != "network.delay" {
+		t.Fatalf("problem = %s, want sweep-1 network.delay", problems[0])
+	}
+}
+
+func TestValidateProcessingPodFileReportsUnknownPlaceholders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "processor.yaml")
+	contents := `name: processor
+containerImage: processor:latest
+command: process $INPUT_FILE_NAME_fix.pcap > $OUTPUT_FILE
+cpuRequest: 1 core
+`
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("write processing pod: %v", err)
+	}
+
+	problems := ValidateProcessingPodFile(path)
+	if len(problems) != 2 {
+		t.Fatalf("ValidateProcessingPodFile() = %v, want two problems", problems)
+	}
+	if problems[0].Field != "cpuRequest" || problems[1].Field != "command" {
+		t.Fatalf("ValidateProcessingPodFile() fields = %q, %q, want cpuRequest, command", problems[0].Field, problems[1].Field)
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/idlab-discover/concap/internal/metrics"
+	"github.com/idlab-discover/concap/internal/scenarios"
+)
+
+// maxDefinitionSize bounds the size of a submitted scenario definition
+const maxDefinitionSize = 1 << 20
+
+// apiError is the body of every error response
+type apiError struct {
+	Error    string       `json:"error"`
+	Problems []apiProblem `json:"problems,omitempty"`
+}
+
+// apiProblem is a validation problem of a submitted definition
+type apiProblem struct {
+	Scenario string             `json:"scenario,omitempty"`
+	Field    string             `json:"field,omitempty"`
+	Severity scenarios.Severity `json:"severity"`
+	Message  string             `json:"message"`
+}
+
+// Handler returns the routes of the scenario API and the metrics endpoint. Every request except the health
+// check requires the bearer token of the server, as the artifacts hold the captured traffic:
+//
+//	POST /api/v1/scenarios?name=<name>              submit a scenario definition as YAML
+//	GET  /api/v1/scenarios                          list submitted scenarios
+//	GET  /api/v1/scenarios/{id}                     get the status of a scenario
+//	POST /api/v1/scenarios/{id}/cancel              cancel a queued or running scenario
+//	GET  /api/v1/scenarios/{id}/artifacts           download the output of a scenario as a .tar.gz
+//	GET  /api/v1/scenarios/{id}/artifacts/{path...} download a single output file
+//	GET  /metrics                                   Prometheus metrics
+//	GET  /healthz                                   health check, without token
+func (s *Server) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("POST /api/v1/scenarios", s.handleSubmit)
+	api.HandleFunc("GET /api/v1/scenarios", s.handleList)
+	api.HandleFunc("GET /api/v1/scenarios/{id}", s.handleGet)
+	api.HandleFunc("POST /api/v1/scenarios/{id}/cancel", s.handleCancel)
+	api.HandleFunc("GET /api/v1/scenarios/{id}/artifacts", s.handleArchive)
+	api.HandleFunc("GET /api/v1/scenarios/{id}/artifacts/{path...}", s.handleArtifact)
+	api.Handle("GET /metrics", metrics.Handler())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", handleHealth)
+	mux.Handle("/", s.requireToken(api))
+	return mux
+}
+
+// handleHealth reports that the server is up
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok\n")
+}
+
+// requireToken rejects requests that do not present the bearer token of the server
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.options.Token == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.options.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="concap"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"), nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	definition, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDefinitionSize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("read scenario definition: %w", err), nil)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "scenario"
+	}
+
+	runs, problems, err := s.Submit(name, definition)
+	switch {
+	case errors.Is(err, ErrInvalidName):
+		writeError(w, http.StatusBadRequest, err, nil)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err, nil)
+	case len(problems) > 0:
+		writeError(w, http.StatusUnprocessableEntity, errors.New("scenario definition is invalid"), problems)
+	default:
+		log.Printf("Queued %d scenarios from submission %s", len(runs), runs[0].Submission)
+		writeJSON(w, http.StatusCreated, runs)
+	}
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.List())
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("scenario %s not found", r.PathValue("id")), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.Cancel(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("scenario %s not found", r.PathValue("id")), nil)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	dir, ok := s.artifactDir(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("scenario %s not found", id), nil)
+		return
+	}
+	if _, err := os.Stat(dir); err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("scenario %s has no artifacts", id), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".tar.gz"))
+	if err := writeArchive(w, dir); err != nil {
+		// The status is sent already, the client sees a truncated archive
+		log.Printf("Error: failed to archive artifacts of scenario %s: %v", id, err)
+	}
+}
+
+func (s *Server) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	dir, ok := s.artifactDir(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("scenario %s not found", id), nil)
+		return
+	}
+	// Serving from an fs.FS rejects paths that escape the output directory
+	http.ServeFileFS(w, r, os.DirFS(dir), r.PathValue("path"))
+}
+
+// writeArchive writes the files below dir as a gzipped tar stream
+func writeArchive(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() && !entry.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if entry.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("Error: failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error, problems []scenarios.Problem) {
+	body := apiError{Error: err.Error()}
+	for _, problem := range problems {
+		body.Problems = append(body.Problems, apiProblem{
+			Scenario: problem.Scenario,
+			Field:    problem.Field,
+			Severity: problem.Severity,
+			Message:  problem.Message,
+		})
+	}
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,345 @@
+// Package server runs concap as a long-lived service that accepts scenarios over a REST API and
+// executes them on the scenario worker pool of the controller.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idlab-discover/concap/internal/controller"
+	"github.com/idlab-discover/concap/internal/metrics"
+	"github.com/idlab-discover/concap/internal/scenarios"
+)
+
+// RunStatus is the state of a submitted scenario
+type RunStatus string
+
+const (
+	RunQueued    RunStatus = "queued"
+	RunRunning   RunStatus = "running"
+	RunCompleted RunStatus = "completed"
+	RunFailed    RunStatus = "failed"
+	RunCancelled RunStatus = "cancelled"
+)
+
+// Finished reports whether the run reached a final state
+func (s RunStatus) Finished() bool {
+	return s == RunCompleted || s == RunFailed || s == RunCancelled
+}
+
+// Run is a submitted scenario as reported by the API
+type Run struct {
+	ID string `json:"id"`
+	// Submission groups the scenarios expanded from a single submitted definition
+	Submission string     `json:"submission"`
+	Scenario   string     `json:"scenario"`
+	Status     RunStatus  `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	SubmitTime time.Time  `json:"submitTime"`
+	StartTime  *time.Time `json:"startTime,omitempty"`
+	FinishTime *time.Time `json:"finishTime,omitempty"`
+	// Result holds the phase durations and capture statistics of a finished run
+	Result *controller.ScenarioResult `json:"result,omitempty"`
+}
+
+// run is the server-side state of a submitted scenario
+type run struct {
+	Run
+	source    scenarios.ScenarioSource
+	outputDir string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	// cancelled is set when the run was cancelled through the API
+	cancelled bool
+}
+
+// ErrInvalidName is returned when a scenario is submitted with a name that cannot be used in pod names
+var ErrInvalidName = errors.New("invalid scenario name")
+
+// scenarioNamePattern restricts submitted scenario names to names that are valid in pod names and file paths
+var scenarioNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Options configure a Server
+type Options struct {
+	// DataDir holds the submitted definitions under submissions/ and the scenario output under completed/
+	DataDir string
+	// Repeat overrides the repeat field of submitted scenarios when greater than 0
+	Repeat int
+	Retry  controller.RetryPolicy
+	// Token is the bearer token that every request except a GET must present. Without a token only
+	// GET requests are served.
+	Token string
+}
+
+// Server accepts scenarios over HTTP and feeds them to the scenario workers
+type Server struct {
+	options  Options
+	requests chan<- controller.ScenarioScheduleRequest
+
+	mu    sync.Mutex
+	runs  map[string]*run
+	queue []*run
+	// wake signals the dispatcher that a run was queued
+	wake chan struct{}
+}
+
+// New returns a server that sends scenario requests to the workers reading from requests
+func New(options Options, requests chan<- controller.ScenarioScheduleRequest) *Server {
+	return &Server{
+		options:  options,
+		requests: requests,
+		runs:     make(map[string]*run),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Run dispatches queued scenarios to the workers and records the results they send until the context is done.
+func (s *Server) Run(ctx context.Context, results <-chan controller.ScenarioResult) {
+	go s.dispatch(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case result, ok := <-results:
+			if !ok {
+				return
+			}
+			s.finish(result)
+		}
+	}
+}
+
+// ListenAndServe serves the API on addr until the context is done
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	server := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving the scenario API on http://%s/api/v1/scenarios", listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Submit stores a scenario definition and queues the scenarios it expands into. Definitions with
+// validation errors are rejected with the problems found.
+func (s *Server) Submit(name string, definition []byte) ([]Run, []scenarios.Problem, error) {
+	if !scenarioNamePattern.MatchString(name) {
+		return nil, nil, fmt.Errorf("%w %q, use lowercase letters, digits and dashes", ErrInvalidName, name)
+	}
+
+	submission := uuid.NewString()
+	submissionDir := filepath.Join(s.options.DataDir, "submissions", submission)
+	if err := os.MkdirAll(submissionDir, 0777); err != nil {
+		return nil, nil, fmt.Errorf("create submission directory: %w", err)
+	}
+	path := filepath.Join(submissionDir, name+".yaml")
+	if err := os.WriteFile(path, definition, 0644); err != nil {
+		return nil, nil, fmt.Errorf("store scenario definition: %w", err)
+	}
+
+	if problems := scenarios.ValidateScenarioFile(path); scenarios.HasErrors(problems) {
+		os.RemoveAll(submissionDir)
+		return nil, problems, nil
+	}
+	sources, err := scenarios.LoadScenarioSources(path)
+	if err == nil {
+		sources, err = scenarios.RepeatScenarioSources(sources, s.options.Repeat)
+	}
+	if err != nil {
+		os.RemoveAll(submissionDir)
+		return nil, nil, fmt.Errorf("load scenario: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var runs []Run
+	for _, source := range sources {
+		id := uuid.NewString()
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &run{
+			Run: Run{
+				ID:         id,
+				Submission: submission,
+				Scenario:   source.OutputDir(),
+				Status:     RunQueued,
+				SubmitTime: time.Now(),
+			},
+			source:    source,
+			outputDir: filepath.Join(s.options.DataDir, "completed", id),
+			ctx:       ctx,
+			cancel:    cancel,
+		}
+		s.runs[id] = r
+		s.queue = append(s.queue, r)
+		runs = append(runs, r.Run)
+	}
+	metrics.ScenariosQueued.Add(float64(len(runs)))
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return runs, nil, nil
+}
+
+// Get returns a submitted scenario
+func (s *Server) Get(id string) (Run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.runs[id]
+	if !ok {
+		return Run{}, false
+	}
+	return r.Run, true
+}
+
+// List returns all submitted scenarios, the most recent first
+func (s *Server) List() []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]Run, 0, len(s.runs))
+	for _, r := range s.runs {
+		runs = append(runs, r.Run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].SubmitTime.Equal(runs[j].SubmitTime) {
+			return runs[i].SubmitTime.After(runs[j].SubmitTime)
+		}
+		return runs[i].Scenario < runs[j].Scenario
+	})
+	return runs
+}
+
+// Cancel stops a queued or running scenario. A queued scenario is cancelled right away, a running
+// scenario once its pods are deleted.
+func (s *Server) Cancel(id string) (Run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.runs[id]
+	if !ok {
+		return Run{}, false
+	}
+	if r.Status.Finished() {
+		return r.Run, true
+	}
+	r.cancelled = true
+	r.cancel()
+	if r.Status == RunQueued {
+		now := time.Now()
+		r.Status = RunCancelled
+		r.FinishTime = &now
+	}
+	return r.Run, true
+}
+
+// artifactDir returns the output directory of a submitted scenario
+func (s *Server) artifactDir(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.runs[id]
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(r.outputDir, r.source.OutputDir()), true
+}
+
+// dispatch hands queued scenarios to the workers one at a time. The send on the unbuffered request
+// channel completes when a worker picks the scenario up, which is when it starts running. Cancelled
+// scenarios are handed over too, so that the worker that drops them also removes them from the
+// queued metric.
+func (s *Server) dispatch(ctx context.Context) {
+	for {
+		r := s.next()
+		if r == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+				continue
+			}
+		}
+
+		request := controller.ScenarioScheduleRequest{
+			ID:        r.ID,
+			Source:    r.source,
+			OutputDir: r.outputDir,
+			Retry:     s.options.Retry,
+			Context:   r.ctx,
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case s.requests <- request:
+			s.start(r)
+		}
+	}
+}
+
+// next removes the first scenario from the queue, whether it is still queued or was cancelled
+func (s *Server) next() *run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return nil
+	}
+	r := s.queue[0]
+	s.queue = s.queue[1:]
+	return r
+}
+
+func (s *Server) start(r *run) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The worker may have finished the scenario already
+	if r.Status == RunQueued {
+		now := time.Now()
+		r.Status = RunRunning
+		r.StartTime = &now
+	}
+}
+
+// finish records the result a worker sent for a scenario
+func (s *Server) finish(result controller.ScenarioResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.runs[result.ID]
+	if !ok {
+		log.Printf("Error: received the result of unknown scenario %s", result.ID)
+		return
+	}
+	defer r.cancel()
+
+	start, finish := result.StartTime, result.FinishTime
+	r.StartTime = &start
+	r.FinishTime = &finish
+	r.Result = &result
+	r.Error = result.Error
+	switch {
+	case r.cancelled && result.Status == controller.ScenarioFailed:
+		r.Status = RunCancelled
+	case result.Status == controller.ScenarioFailed:
+		r.Status = RunFailed
+	default:
+		r.Status = RunCompleted
+	}
+}
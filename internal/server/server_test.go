@@ -0,0 +1,314 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/idlab-discover/concap/internal/controller"
+	"github.com/idlab-discover/concap/internal/metrics"
+)
+
+// testContext returns a context that is cancelled when the test ends
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func readExample(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("..", "..", "example", "scenarios", name))
+	if err != nil {
+		t.Fatalf("read example scenario: %v", err)
+	}
+	return string(b)
+}
+
+// testToken is the bearer token of the servers in the tests
+const testToken = "s3cret"
+
+func do(t *testing.T, handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+testToken)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decode[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(recorder.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode response %q: %v", recorder.Body.String(), err)
+	}
+	return v
+}
+
+// waitForStatus polls the API until the scenario reaches the status
+func waitForStatus(t *testing.T, handler http.Handler, id string, status RunStatus) Run {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		run := decode[Run](t, do(t, handler, "GET", "/api/v1/scenarios/"+id, ""))
+		if run.Status == status {
+			return run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scenario %s is %s, want %s", id, run.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubmitRunAndDownloadArtifacts(t *testing.T) {
+	requests := make(chan controller.ScenarioScheduleRequest)
+	results := make(chan controller.ScenarioResult)
+	srv := New(Options{DataDir: t.TempDir(), Token: testToken}, requests)
+	handler := srv.Handler()
+	go srv.Run(testContext(t), results)
+
+	recorder := do(t, handler, "POST", "/api/v1/scenarios?name=nmap-scan", readExample(t, "scenario.yaml"))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("submit status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	runs := decode[[]Run](t, recorder)
+	if len(runs) != 1 || runs[0].Scenario != "nmap-scan" || runs[0].Status != RunQueued {
+		t.Fatalf("submitted runs = %+v, want one queued nmap-scan", runs)
+	}
+
+	// Act as a scenario worker
+	request := <-requests
+	if request.ID != runs[0].ID || request.Source.Name != "nmap-scan" {
+		t.Fatalf("worker received %s %s, want the submitted scenario", request.ID, request.Source.Name)
+	}
+	waitForStatus(t, handler, request.ID, RunRunning)
+	outputDir := filepath.Join(request.OutputDir, request.Source.OutputDir())
+	if err := os.MkdirAll(filepath.Join(outputDir, "web"), 0755); err != nil {
+		t.Fatalf("create output: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "web", "dump.pcap"), []byte("pcap"), 0644); err != nil {
+		t.Fatalf("write output: %v", err)
+	}
+	results <- controller.ScenarioResult{ID: request.ID, Scenario: "nmap-scan", Status: controller.ScenarioCompleted, Attempts: 1}
+
+	run := waitForStatus(t, handler, request.ID, RunCompleted)
+	if run.Result == nil || run.Result.Attempts != 1 {
+		t.Fatalf("completed run = %+v, want its result", run)
+	}
+	if list := decode[[]Run](t, do(t, handler, "GET", "/api/v1/scenarios", "")); len(list) != 1 || list[0].ID != run.ID {
+		t.Fatalf("listed runs = %+v, want the submitted run", list)
+	}
+
+	file := do(t, handler, "GET", "/api/v1/scenarios/"+run.ID+"/artifacts/web/dump.pcap", "")
+	if file.Code != http.StatusOK || file.Body.String() != "pcap" {
+		t.Fatalf("artifact = %d %q, want the output file", file.Code, file.Body)
+	}
+	if escape := do(t, handler, "GET", "/api/v1/scenarios/"+run.ID+"/artifacts/..%2f..%2fsubmissions", ""); escape.Code == http.StatusOK {
+		t.Fatalf("artifact outside the output directory was served: %s", escape.Body)
+	}
+
+	archive := do(t, handler, "GET", "/api/v1/scenarios/"+run.ID+"/artifacts", "")
+	if archive.Code != http.StatusOK {
+		t.Fatalf("archive status = %d", archive.Code)
+	}
+	gz, err := gzip.NewReader(archive.Body)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	if got, want := strings.Join(names, ","), "web/,web/dump.pcap"; got != want {
+		t.Fatalf("archive entries = %q, want %q", got, want)
+	}
+}
+
+func TestSubmitRejectsInvalidDefinitions(t *testing.T) {
+	srv := New(Options{DataDir: t.TempDir(), Token: testToken}, make(chan controller.ScenarioScheduleRequest))
+	handler := srv.Handler()
+
+	invalid := strings.Replace(readExample(t, "scenario.yaml"), "cpuRequest: 500m", "cpuRequest: lots", 1)
+	recorder := do(t, handler, "POST", "/api/v1/scenarios?name=scan", invalid)
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("submit status = %d, want %d, body %s", recorder.Code, http.StatusUnprocessableEntity, recorder.Body)
+	}
+	if body := decode[apiError](t, recorder); len(body.Problems) == 0 || body.Problems[0].Severity != "error" {
+		t.Fatalf("error body = %+v, want the validation problems", body)
+	}
+
+	if recorder := do(t, handler, "POST", "/api/v1/scenarios?name=../escape", readExample(t, "scenario.yaml")); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("submit with invalid name status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+	if list := srv.List(); len(list) != 0 {
+		t.Fatalf("rejected submissions were queued: %+v", list)
+	}
+	if recorder := do(t, handler, "GET", "/api/v1/scenarios/unknown", ""); recorder.Code != http.StatusNotFound {
+		t.Fatalf("get unknown status = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
+
+func TestCancelQueuedScenario(t *testing.T) {
+	requests := make(chan controller.ScenarioScheduleRequest)
+	srv := New(Options{DataDir: t.TempDir(), Token: testToken}, requests)
+	handler := srv.Handler()
+	ctx := testContext(t)
+	go srv.Run(ctx, make(chan controller.ScenarioResult))
+
+	queued := queuedScenarios(t)
+	runs := decode[[]Run](t, do(t, handler, "POST", "/api/v1/scenarios?name=scan", readExample(t, "scenario.yaml")))
+	recorder := do(t, handler, "POST", "/api/v1/scenarios/"+runs[0].ID+"/cancel", "")
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("cancel status = %d", recorder.Code)
+	}
+	if run := decode[Run](t, recorder); run.Status != RunCancelled {
+		t.Fatalf("cancelled run status = %s, want %s", run.Status, RunCancelled)
+	}
+	if got := queuedScenarios(t); got != queued+1 {
+		t.Fatalf("queued scenarios after cancel = %v, want %v until a worker drops it", got, queued+1)
+	}
+
+	// The dispatcher hands the cancelled scenario to a worker, which drops it and removes it from the queue
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go controller.ScheduleScenarioWorker(ctx, requests, make(chan controller.ScenarioResult), &wg)
+	deadline := time.Now().Add(5 * time.Second)
+	for queuedScenarios(t) != queued {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued scenarios = %v, want %v after the worker dropped the cancelled scenario", queuedScenarios(t), queued)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if run := decode[Run](t, do(t, handler, "GET", "/api/v1/scenarios/"+runs[0].ID, "")); run.Status != RunCancelled {
+		t.Fatalf("dropped run status = %s, want %s", run.Status, RunCancelled)
+	}
+}
+
+// queuedScenarios returns the value of the queued scenarios gauge
+func queuedScenarios(t *testing.T) float64 {
+	t.Helper()
+	var text strings.Builder
+	if err := metrics.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(text.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, "concap_scenarios_queued "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("parse %q: %v", line, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestCancelRunningScenario(t *testing.T) {
+	requests := make(chan controller.ScenarioScheduleRequest)
+	results := make(chan controller.ScenarioResult)
+	srv := New(Options{DataDir: t.TempDir(), Token: testToken}, requests)
+	handler := srv.Handler()
+	go srv.Run(testContext(t), results)
+
+	runs := decode[[]Run](t, do(t, handler, "POST", "/api/v1/scenarios?name=scan", readExample(t, "scenario.yaml")))
+	request := <-requests
+	waitForStatus(t, handler, runs[0].ID, RunRunning)
+
+	if recorder := do(t, handler, "POST", "/api/v1/scenarios/"+runs[0].ID+"/cancel", ""); decode[Run](t, recorder).Status != RunRunning {
+		t.Fatalf("running scenario should stay running until its worker stops")
+	}
+	select {
+	case <-request.Context.Done():
+	case <-time.After(time.Second):
+		t.Fatal("cancel did not cancel the request context")
+	}
+	results <- controller.ScenarioResult{ID: request.ID, Status: controller.ScenarioFailed, Error: "context canceled"}
+	waitForStatus(t, handler, runs[0].ID, RunCancelled)
+}
+
+func TestRequestsRequireBearerToken(t *testing.T) {
+	requests := make(chan controller.ScenarioScheduleRequest)
+	results := make(chan controller.ScenarioResult)
+	srv := New(Options{DataDir: t.TempDir(), Token: testToken}, requests)
+	handler := srv.Handler()
+	go srv.Run(testContext(t), results)
+
+	for _, authorization := range []string{"", "Bearer wrong", testToken} {
+		request := httptest.NewRequest("POST", "/api/v1/scenarios?name=scan", strings.NewReader(readExample(t, "scenario.yaml")))
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("submit with authorization %q status = %d, want %d", authorization, recorder.Code, http.StatusUnauthorized)
+		}
+	}
+	if list := srv.List(); len(list) != 0 {
+		t.Fatalf("unauthorized submissions were queued: %+v", list)
+	}
+
+	// Reading requires the token too, the artifacts hold the captured traffic
+	runs := decode[[]Run](t, do(t, handler, "POST", "/api/v1/scenarios?name=scan", readExample(t, "scenario.yaml")))
+	request := <-requests
+	outputDir := filepath.Join(request.OutputDir, request.Source.OutputDir())
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("create output: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "dump.pcap"), []byte("pcap"), 0644); err != nil {
+		t.Fatalf("write output: %v", err)
+	}
+	results <- controller.ScenarioResult{ID: request.ID, Status: controller.ScenarioCompleted}
+	waitForStatus(t, handler, runs[0].ID, RunCompleted)
+
+	for _, target := range []string{
+		"/api/v1/scenarios",
+		"/api/v1/scenarios/" + runs[0].ID,
+		"/api/v1/scenarios/" + runs[0].ID + "/artifacts",
+		"/api/v1/scenarios/" + runs[0].ID + "/artifacts/dump.pcap",
+		"/metrics",
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", target, nil))
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("GET %s without token status = %d, want %d", target, recorder.Code, http.StatusUnauthorized)
+		}
+	}
+	if recorder := do(t, handler, "GET", "/api/v1/scenarios/"+runs[0].ID+"/artifacts/dump.pcap", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("artifact with token status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("health check without token status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	// Without a token of its own the server accepts no requests at all
+	open := New(Options{DataDir: t.TempDir()}, make(chan controller.ScenarioScheduleRequest)).Handler()
+	if recorder := do(t, open, "POST", "/api/v1/scenarios?name=scan", readExample(t, "scenario.yaml")); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("submit to a server without token status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,318 @@
+// Package state keeps an on-disk journal of the scenario lifecycle so that a restarted controller
+// knows what happened in earlier runs and which pods they left behind.
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileName is the name of the journal in the output directory
+const FileName = "state.jsonl"
+
+// EventType is the kind of lifecycle transition an event records
+type EventType string
+
+const (
+	// EventStarted is recorded when a worker picks up a scenario
+	EventStarted EventType = "started"
+	// EventAttempt is recorded at the start of every attempt of a scenario
+	EventAttempt EventType = "attempt"
+	// EventPodCreated and EventPodDeleted are recorded for every scenario pod
+	EventPodCreated EventType = "pod-created"
+	EventPodDeleted EventType = "pod-deleted"
+	// EventPhase records the duration of a phase
+	EventPhase EventType = "phase"
+	// EventFinished is recorded with the status, error and artifacts of a scenario once it ends
+	EventFinished EventType = "finished"
+	// EventSkipped is recorded when --resume skips a scenario, it keeps the state of the run that produced the output
+	EventSkipped EventType = "skipped"
+	// EventInterrupted is recorded by a restarted controller for scenarios that never finished
+	EventInterrupted EventType = "interrupted"
+	// EventHeartbeat is recorded periodically while a session runs, EventClosed when it stops cleanly.
+	// They belong to the session rather than to a scenario.
+	EventHeartbeat EventType = "heartbeat"
+	EventClosed    EventType = "closed"
+)
+
+const (
+	// HeartbeatInterval is how often a running session records a heartbeat
+	HeartbeatInterval = 30 * time.Second
+	// SessionTimeout is how long after its last event a session that did not close counts as alive
+	SessionTimeout = 3 * HeartbeatInterval
+)
+
+// Status values of a scenario in the journal
+const (
+	StatusRunning     = "running"
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// Event is a single line of the journal
+type Event struct {
+	Time time.Time `json:"time"`
+	// Session identifies the controller process that recorded the event
+	Session string    `json:"session"`
+	Type    EventType `json:"type"`
+	// OutputDir is the output directory of the scenario, it identifies the scenario across runs
+	OutputDir string  `json:"outputDir"`
+	Scenario  string  `json:"scenario,omitempty"`
+	ID        string  `json:"id,omitempty"`
+	Attempt   int     `json:"attempt,omitempty"`
+	Pod       string  `json:"pod,omitempty"`
+	Phase     string  `json:"phase,omitempty"`
+	Seconds   float64 `json:"seconds,omitempty"`
+	Status    string  `json:"status,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	// Artifacts are the output files of a finished scenario, relative to its output directory
+	Artifacts []string `json:"artifacts,omitempty"`
+}
+
+// Journal appends events to a JSON-lines file. Every event is synced to disk before Record returns,
+// so the journal survives a crash of the controller.
+type Journal struct {
+	session string
+	mu      sync.Mutex
+	file    *os.File
+}
+
+// Open opens the journal at path for appending, creating it if needed. Events are recorded for session,
+// starting with a heartbeat so that the session counts as alive from the start.
+func Open(path, session string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	j := &Journal{session: session, file: file}
+	if err := j.Record(Event{Type: EventHeartbeat}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// Session returns the session the journal records events for, a nil journal has none
+func (j *Journal) Session() string {
+	if j == nil {
+		return ""
+	}
+	return j.session
+}
+
+// Record appends an event to the journal. A nil journal records nothing.
+func (j *Journal) Record(event Event) error {
+	if j == nil {
+		return nil
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Session = j.session
+	b, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write event: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// Close records that the session stopped and closes the journal file
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	recordErr := j.Record(Event{Type: EventClosed})
+	return errors.Join(recordErr, j.file.Close())
+}
+
+// ScenarioState is the state of a scenario folded from its events
+type ScenarioState struct {
+	OutputDir  string
+	Scenario   string
+	ID         string
+	Session    string
+	Status     string
+	Error      string
+	StartTime  time.Time
+	FinishTime time.Time
+	Attempts   int
+	// Phases are the phase durations of the last attempt in seconds
+	Phases map[string]float64
+	// Pods are the pods that were created and never deleted
+	Pods      []string
+	Artifacts []string
+}
+
+// Session is the liveness of a controller process that recorded events in the journal
+type Session struct {
+	ID string
+	// LastSeen is the time of the last event of the session
+	LastSeen time.Time
+	// Closed reports whether the session stopped cleanly
+	Closed bool
+}
+
+// Alive reports whether the session may still be running at now. A session that neither closed nor
+// recorded an event within SessionTimeout is presumed dead.
+func (s Session) Alive(now time.Time) bool {
+	return !s.Closed && !s.LastSeen.IsZero() && now.Sub(s.LastSeen) < SessionTimeout
+}
+
+// readEvents calls apply for every event of the journal at path. A missing journal has no events, a line
+// that cannot be parsed, such as a line cut off by a crash, is skipped.
+func readEvents(path string, apply func(Event)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("open journal: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			log.Printf("warning: skipping line %d of journal %s: %v", line, path, err)
+			continue
+		}
+		apply(event)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read journal: %w", err)
+	}
+	return nil
+}
+
+// ReadSessions returns the sessions that recorded events in the journal at path by ID
+func ReadSessions(path string) (map[string]Session, error) {
+	sessions := make(map[string]Session)
+	err := readEvents(path, func(event Event) {
+		session := sessions[event.Session]
+		session.ID = event.Session
+		if event.Time.After(session.LastSeen) {
+			session.LastSeen = event.Time
+		}
+		if event.Type == EventClosed {
+			session.Closed = true
+		}
+		sessions[event.Session] = session
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Read replays the journal at path into the latest state of every scenario, ordered by output directory.
+// A missing journal has no states, a line that cannot be parsed, such as a line cut off by a crash, is skipped.
+func Read(path string) ([]ScenarioState, error) {
+	states := make(map[string]*ScenarioState)
+	err := readEvents(path, func(event Event) {
+		if event.Type == EventHeartbeat || event.Type == EventClosed {
+			return
+		}
+		state, ok := states[event.OutputDir]
+		if !ok {
+			state = &ScenarioState{OutputDir: event.OutputDir}
+			states[event.OutputDir] = state
+		}
+		state.apply(event)
+	})
+	if err != nil || len(states) == 0 {
+		return nil, err
+	}
+
+	result := make([]ScenarioState, 0, len(states))
+	for _, state := range states {
+		result = append(result, *state)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].OutputDir < result[j].OutputDir
+	})
+	return result, nil
+}
+
+// apply folds an event into the state
+func (s *ScenarioState) apply(event Event) {
+	if event.Scenario != "" {
+		s.Scenario = event.Scenario
+	}
+	switch event.Type {
+	case EventStarted:
+		// A new run of the scenario, only the pods left behind by earlier runs carry over
+		*s = ScenarioState{
+			OutputDir: s.OutputDir,
+			Scenario:  s.Scenario,
+			ID:        event.ID,
+			Session:   event.Session,
+			Status:    StatusRunning,
+			StartTime: event.Time,
+			Pods:      s.Pods,
+		}
+	case EventAttempt:
+		s.Attempts = event.Attempt
+		s.Phases = nil
+	case EventPodCreated:
+		s.Pods = appendUnique(s.Pods, event.Pod)
+	case EventPodDeleted:
+		s.Pods = remove(s.Pods, event.Pod)
+	case EventPhase:
+		if s.Phases == nil {
+			s.Phases = make(map[string]float64)
+		}
+		s.Phases[event.Phase] += event.Seconds
+	case EventFinished:
+		s.Status = event.Status
+		s.Error = event.Error
+		s.FinishTime = event.Time
+		s.Artifacts = event.Artifacts
+		if s.StartTime.IsZero() {
+			s.StartTime = event.Time
+		}
+	case EventInterrupted:
+		s.Status = StatusInterrupted
+		s.FinishTime = event.Time
+	}
+}
+
+// Unfinished reports whether the scenario was still running when its controller stopped
+func (s ScenarioState) Unfinished() bool {
+	return s.Status == StatusRunning
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func remove(values []string, value string) []string {
+	var result []string
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func recordAll(t *testing.T, path, session string, events ...Event) {
+	t.Helper()
+	journal, err := Open(path, session)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, event := range events {
+		if err := journal.Record(event); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
+
+func TestReadReplaysScenarioLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	recordAll(t, path, "first",
+		Event{Type: EventStarted, OutputDir: "/out/scan", Scenario: "scan", ID: "a"},
+		Event{Type: EventAttempt, OutputDir: "/out/scan", Attempt: 1},
+		Event{Type: EventPodCreated, OutputDir: "/out/scan", Pod: "scan-target"},
+		Event{Type: EventPhase, OutputDir: "/out/scan", Phase: "deploy", Seconds: 3},
+		Event{Type: EventAttempt, OutputDir: "/out/scan", Attempt: 2},
+		Event{Type: EventPodCreated, OutputDir: "/out/scan", Pod: "scan-attacker"},
+		Event{Type: EventPhase, OutputDir: "/out/scan", Phase: "deploy", Seconds: 2},
+		Event{Type: EventPodDeleted, OutputDir: "/out/scan", Pod: "scan-target"},
+		Event{Type: EventFinished, OutputDir: "/out/scan", Status: StatusCompleted, Artifacts: []string{"dump.pcap"}},
+		Event{Type: EventStarted, OutputDir: "/out/brute", Scenario: "brute"},
+		Event{Type: EventPodCreated, OutputDir: "/out/brute", Pod: "brute-target"},
+	)
+
+	states, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("Read() returned %d states, want 2", len(states))
+	}
+
+	brute, scan := states[0], states[1]
+	if brute.Scenario != "brute" || !brute.Unfinished() || !reflect.DeepEqual(brute.Pods, []string{"brute-target"}) {
+		t.Fatalf("brute state = %+v, want an unfinished scenario with its pod", brute)
+	}
+	if scan.Status != StatusCompleted || scan.ID != "a" || scan.Session != "first" || scan.Attempts != 2 {
+		t.Fatalf("scan state = %+v, want the completed second attempt", scan)
+	}
+	if !reflect.DeepEqual(scan.Phases, map[string]float64{"deploy": 2}) {
+		t.Fatalf("scan phases = %v, want the phases of the last attempt", scan.Phases)
+	}
+	if !reflect.DeepEqual(scan.Pods, []string{"scan-attacker"}) {
+		t.Fatalf("scan pods = %v, want the pod that was never deleted", scan.Pods)
+	}
+	if !reflect.DeepEqual(scan.Artifacts, []string{"dump.pcap"}) {
+		t.Fatalf("scan artifacts = %v", scan.Artifacts)
+	}
+}
+
+func TestReadStartsOverForNewRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	recordAll(t, path, "first",
+		Event{Type: EventStarted, OutputDir: "/out/scan", Scenario: "scan"},
+		Event{Type: EventPodCreated, OutputDir: "/out/scan", Pod: "scan-target"},
+		Event{Type: EventPhase, OutputDir: "/out/scan", Phase: "deploy", Seconds: 3},
+	)
+	recordAll(t, path, "second",
+		Event{Type: EventInterrupted, OutputDir: "/out/scan"},
+		Event{Time: start, Type: EventStarted, OutputDir: "/out/scan"},
+		Event{Type: EventSkipped, OutputDir: "/out/other"},
+	)
+
+	states, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	scan := states[1]
+	if scan.Session != "second" || !scan.StartTime.Equal(start) || scan.Phases != nil || scan.Scenario != "scan" {
+		t.Fatalf("scan state = %+v, want the state of the new run", scan)
+	}
+	if !reflect.DeepEqual(scan.Pods, []string{"scan-target"}) {
+		t.Fatalf("scan pods = %v, want the pod left behind by the interrupted run", scan.Pods)
+	}
+}
+
+func TestReadSkipsTruncatedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	recordAll(t, path, "first", Event{Type: EventStarted, OutputDir: "/out/scan"})
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"type":"finished","outputDir":"/out/sc`)
+	file.Close()
+
+	states, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(states) != 1 || !states[0].Unfinished() {
+		t.Fatalf("Read() = %+v, want the scenario still running", states)
+	}
+}
+
+func TestReadMissingJournal(t *testing.T) {
+	states, err := Read(filepath.Join(t.TempDir(), FileName))
+	if err != nil || states != nil {
+		t.Fatalf("Read() = %v, %v, want no states", states, err)
+	}
+}
+
+func TestReadSessionsTracksLiveness(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	now := time.Now()
+	recordAll(t, path, "closed", Event{Type: EventStarted, OutputDir: "/out/scan"})
+	live, err := Open(path, "live")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer live.Close()
+	// A session that crashed stopped recording heartbeats without closing
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"time":"` + now.Add(-time.Hour).Format(time.RFC3339Nano) + `","session":"crashed","type":"heartbeat","outputDir":""}` + "\n")
+	file.Close()
+
+	sessions, err := ReadSessions(path)
+	if err != nil {
+		t.Fatalf("ReadSessions() error = %v", err)
+	}
+	if !sessions["closed"].Closed || sessions["closed"].Alive(now) {
+		t.Fatalf("closed session = %+v, want it closed and dead", sessions["closed"])
+	}
+	if !sessions["live"].Alive(now) {
+		t.Fatalf("live session = %+v, want it alive", sessions["live"])
+	}
+	if later := now.Add(SessionTimeout + time.Second); sessions["live"].Alive(later) {
+		t.Fatalf("live session is alive %s after its last heartbeat", SessionTimeout+time.Second)
+	}
+	if crashed := sessions["crashed"]; crashed.Closed || crashed.Alive(now) {
+		t.Fatalf("crashed session = %+v, want it dead without being closed", crashed)
+	}
+	if _, ok := sessions["unknown"]; ok || (Session{}).Alive(now) {
+		t.Fatal("a session without events is alive")
+	}
+
+	states, err := Read(path)
+	if err != nil || len(states) != 1 {
+		t.Fatalf("Read() = %+v, %v, want the heartbeats skipped", states, err)
+	}
+}